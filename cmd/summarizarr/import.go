@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+
+	"summarizarr/internal/config"
+	"summarizarr/internal/importer"
+	signalclient "summarizarr/internal/signal"
+)
+
+// runImport implements "summarizarr import", which loads chat history from
+// export files into the database. It returns the exit code.
+func runImport(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: summarizarr import [flags] FILE...")
+		fmt.Fprintln(flags.Output(), "\nImports signal-cli JSON, Signal Desktop export JSON or text transcripts. Use - for stdin.")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", importer.FormatAuto, "export format: auto, signal-cli, desktop or text")
+	account := flags.String("account", cfg.PhoneNumber, "Signal number the history belongs to")
+	groupID := flags.String("group", "", "Signal group ID of a text transcript")
+	groupName := flags.String("group-name", "", "group name of a text transcript")
+	timeZone := flags.String("tz", "Local", "time zone of text transcript timestamps")
+	dryRun := flags.Bool("dry-run", false, "report what would be imported without storing anything")
+	backfill := flags.Bool("backfill", false, "queue summaries of past windows that received messages")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if !importer.ValidFormat(*format) {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		return 2
+	}
+	if *backfill && *dryRun {
+		fmt.Fprintln(os.Stderr, "-backfill cannot be combined with -dry-run")
+		return 2
+	}
+	location, err := time.LoadLocation(*timeZone)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid time zone: %v\n", err)
+		return 2
+	}
+	if _, err := summarizationSchedule(cfg).Parse(); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid summarization schedule: %v\n", err)
+		return 2
+	}
+
+	opts := importer.ParseOptions{
+		Format:    *format,
+		Account:   *account,
+		GroupID:   *groupID,
+		GroupName: *groupName,
+		Location:  location,
+	}
+	var envelopes []*signalclient.Envelope
+	for _, path := range flags.Args() {
+		parsed, err := parseImportFile(path, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
+		}
+		envelopes = append(envelopes, parsed...)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		slog.Error("Failed to open database", "error", err)
+		return 1
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			slog.Error("Failed to close database", "error", err)
+		}
+	}()
+
+	imp := importer.New(db, summarizationSchedule(cfg))
+	report, err := imp.Import(ctx, envelopes, *dryRun)
+	if err != nil {
+		slog.Error("Import failed", "error", err)
+		return 1
+	}
+	if *backfill {
+		if err := imp.Backfill(report); err != nil {
+			slog.Error("Backfill failed", "error", err, "jobs", len(report.BackfillJobs))
+			printImportReport(os.Stdout, report)
+			return 1
+		}
+	}
+	printImportReport(os.Stdout, report)
+	return 0
+}
+
+func parseImportFile(path string, opts importer.ParseOptions) ([]*signalclient.Envelope, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	envelopes, err := importer.Parse(data, opts)
+	if err == nil && len(envelopes) == 0 {
+		err = errors.New("no messages found")
+	}
+	return envelopes, err
+}
+
+func printImportReport(w io.Writer, report *importer.Report) {
+	verb := "Imported"
+	if report.DryRun {
+		verb = "Would import"
+	}
+	fmt.Fprintf(w, "%s %d messages (%d duplicates, %d edits or deletions, %d skipped) from %d envelopes\n",
+		verb, report.Imported, report.Duplicates, report.Updates, report.Skipped, report.Envelopes)
+	for _, g := range report.Groups {
+		name := g.Name
+		if name == "" {
+			name = g.GroupID
+		}
+		line := fmt.Sprintf("  %s: %d new, %d duplicates", name, g.Imported, g.Duplicates)
+		if g.Imported > 0 {
+			line += fmt.Sprintf(", %s to %s",
+				time.UnixMilli(g.First).Format(time.DateTime), time.UnixMilli(g.Last).Format(time.DateTime))
+		}
+		fmt.Fprintln(w, line)
+	}
+	if len(report.BackfillJobs) > 0 {
+		fmt.Fprintf(w, "Queued %d summaries, generated by the running service\n", len(report.BackfillJobs))
+	}
+}
@@ -10,13 +10,19 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"summarizarr/internal/ai"
 	"summarizarr/internal/api"
+	"summarizarr/internal/bot"
 	"summarizarr/internal/config"
 	"summarizarr/internal/database"
+	"summarizarr/internal/delivery"
 	"summarizarr/internal/encryption"
 	"summarizarr/internal/frontend"
+	"summarizarr/internal/importer"
 	"summarizarr/internal/ollama"
+	"summarizarr/internal/schedule"
 	signalclient "summarizarr/internal/signal"
 	"summarizarr/internal/version"
 	"time"
@@ -27,6 +33,10 @@ func main() {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: cfg.LogLevel}))
 	slog.SetDefault(logger)
 
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImport(cfg, os.Args[2:]))
+	}
+
 	slog.Info("Summarizarr starting...", "version", version.GetVersion())
 
 	// Validate backend-specific configuration
@@ -38,40 +48,9 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
-	// Ensure the database directory exists
-	dbDir := filepath.Dir(cfg.DatabasePath)
-	if dbDir != "." && dbDir != "" {
-		if err := os.MkdirAll(dbDir, 0755); err != nil {
-			slog.Error("Failed to create database directory", "error", err, "path", dbDir)
-			os.Exit(1)
-		}
-	}
-
-	// Preflight: If an existing DB is plaintext (unencrypted), back it up and allow creation of a fresh encrypted DB
-	if err := backupIfPlaintext(cfg.DatabasePath); err != nil {
-		slog.Error("Preflight encryption check failed", "error", err)
-		os.Exit(1)
-	}
-
-	// Mandatory encryption: load or create key using manager
-	encMgr := encryption.NewManager(cfg.DatabasePath)
-	encKey, err := encMgr.LoadOrCreateKey()
-	if err != nil {
-		slog.Error("Failed to obtain encryption key", "error", err)
-		os.Exit(1)
-	}
-	// Log masked key fingerprint and source for troubleshooting in dev
-	{
-		finger := sha256.Sum256([]byte(encKey))
-		src := "generated"
-		if _, err := os.Stat(encMgr.SecretPath); err == nil { src = encMgr.SecretPath }
-		if _, err := os.Stat(encMgr.KeyFile); err == nil { src = encMgr.KeyFile }
-		slog.Info("Using encryption key", "source", src, "sha256_prefix", fmt.Sprintf("%x", finger)[:8])
-	}
-
-	db, err := database.NewDB(cfg.DatabasePath, encKey)
+	db, err := openDatabase(cfg)
 	if err != nil {
-		slog.Error("Failed to connect to database", "error", err)
+		slog.Error("Failed to open database", "error", err)
 		os.Exit(1)
 	}
 	defer func() {
@@ -80,28 +59,31 @@ func main() {
 		}
 	}()
 
-	if err := db.Init(); err != nil {
-		slog.Error("Failed to initialize database", "error", err)
-		os.Exit(1)
-	}
-
-	// Initialize AI backend based on configuration (switch improves readability, satisfies staticcheck suggestion)
-	switch cfg.AIProvider {
-	case "local":
-		slog.Info("AI_PROVIDER=local detected. Using external Ollama server...")
-	case "openai":
-		slog.Info("AI_PROVIDER=openai detected. Initializing OpenAI backend...")
-		if cfg.OpenAIAPIKey == "" { // Validate required OpenAI configuration
-			slog.Error("OPENAI_API_KEY environment variable is required when AI_PROVIDER=openai")
+	// Disappearing messages are purged shortly after their timer runs out
+	go db.RunExpirySweeper(ctx, time.Minute)
+
+	// Initialize AI backends based on configuration, later providers are fallbacks
+	for _, provider := range cfg.AIProviders {
+		switch provider {
+		case "local":
+			slog.Info("AI_PROVIDER=local detected. Using external Ollama server...")
+		case "openai":
+			slog.Info("AI_PROVIDER=openai detected. Initializing OpenAI backend...")
+			if cfg.OpenAIAPIKey == "" { // Validate required OpenAI configuration
+				slog.Error("OPENAI_API_KEY environment variable is required when AI_PROVIDER=openai")
+				os.Exit(1)
+			}
+		case "groq", "gemini", "claude":
+			// These are validated later in validateConfig/testAIProvider
+			// Log detection for observability
+			slog.Info("Detected AI provider", "provider", provider)
+		default:
+			slog.Error("Invalid AI_PROVIDER configuration", "provider", provider, "supported", "local, openai, groq, gemini, claude")
 			os.Exit(1)
 		}
-	case "groq", "gemini", "claude":
-		// These are validated later in validateConfig/testAIProvider
-		// Log detection for observability
-		slog.Info("Detected AI provider", "provider", cfg.AIProvider)
-	default:
-		slog.Error("Invalid AI_PROVIDER configuration", "provider", cfg.AIProvider, "supported", "local, openai, groq, gemini, claude")
-		os.Exit(1)
+	}
+	if len(cfg.AIProviders) > 1 {
+		slog.Info("AI provider fallback chain", "providers", strings.Join(cfg.AIProviders, " -> "))
 	}
 
 	// Create AI client
@@ -124,25 +106,46 @@ func main() {
 		frontendFS = nil
 	}
 
-	// API server listen address is configurable via LISTEN_ADDR (default :8080)
-	apiServer := api.NewServerWithAppDB(cfg.ListenAddr, db, frontendFS)
-
-	go apiServer.Start()
-
 	if cfg.PhoneNumber == "" {
 		slog.Error("SIGNAL_PHONE_NUMBER environment variable is required")
 		os.Exit(1)
 	}
 
-	// Use phone number and Signal URL from config
-	client := signalclient.NewClient(cfg.SignalURL, cfg.PhoneNumber, db)
+	// Summaries and command replies are posted through the REST API
+	deliverer := delivery.New(db, signalclient.NewSender(cfg.SignalURL), cfg.PhoneNumber, cfg.SummaryDigestGroup)
+
+	clientOptions := []signalclient.ClientOption{
+		// Group details come from the REST API, which a bare signal-cli daemon lacks
+		signalclient.WithGroupSync(cfg.SignalReceiveMode != signalclient.ReceiveModeJSONRPC),
+	}
+	if cfg.BotCommands {
+		// Validated in validateConfig
+		rateLimit, _ := time.ParseDuration(cfg.BotCommandRateLimit)
+		router := signalclient.NewCommandRouter(cfg.BotCommandPrefix, cfg.BotCommandAllowlist, rateLimit, deliverer)
+		bot.New(db, aiClient, cfg.BotCommandPrefix).Register(router)
+		clientOptions = append(clientOptions, signalclient.WithCommands(router))
+		slog.Info("In-chat commands enabled", "prefix", cfg.BotCommandPrefix, "allowlist_size", len(cfg.BotCommandAllowlist))
+		if len(cfg.BotCommandAllowlist) == 0 {
+			slog.Warn("BOT_COMMAND_ALLOWLIST is empty, every command will be ignored")
+		}
+	}
 
-	go func() {
-		if err := client.Listen(ctx); err != nil {
-			slog.Error("Signal listener error", "error", err)
+	// One listener per configured account, all using the Signal URL from config.
+	// Summaries and replies one account posts are not stored by the others.
+	clientOptions = append(clientOptions, signalclient.WithAccounts(signalclient.NewAccounts(cfg.PhoneNumbers)))
+	var clients []*signalclient.Client
+	var listeners []api.SignalStatusProvider
+	for _, number := range cfg.PhoneNumbers {
+		receiver, err := newSignalReceiver(cfg, number)
+		if err != nil {
+			slog.Error("Invalid Signal receiver configuration", "error", err)
 			os.Exit(1)
 		}
-	}()
+		client := signalclient.NewClient(cfg.SignalURL, number, db,
+			append(clientOptions, signalclient.WithReceiver(receiver))...)
+		clients = append(clients, client)
+		listeners = append(listeners, client)
+	}
 
 	// Parse summarization interval from config
 	summarizationInterval, err := time.ParseDuration(cfg.SummarizationInterval)
@@ -151,7 +154,39 @@ func main() {
 		os.Exit(1)
 	}
 
-	scheduler := ai.NewScheduler(db, aiClient, summarizationInterval)
+	// Summaries are posted to Signal for groups that opted in
+	// Validated in validateConfig
+	workers, _ := strconv.Atoi(cfg.SummaryWorkers)
+	maxAttempts, _ := strconv.Atoi(cfg.SummaryMaxAttempts)
+	retryBackoff, _ := time.ParseDuration(cfg.SummaryRetryBackoff)
+	scheduler := ai.NewScheduler(db, aiClient, summarizationInterval,
+		ai.WithDelivery(deliverer), ai.WithSchedule(summarizationSchedule(cfg)),
+		ai.WithWorkers(workers), ai.WithRetry(maxAttempts, retryBackoff))
+
+	// Validated in validateConfig, empty is no budget
+	monthlyBudget, _ := strconv.ParseFloat(cfg.MonthlyBudgetUSD, 64)
+
+	// API server listen address is configurable via LISTEN_ADDR (default :8080)
+	apiServer := api.NewServerWithAppDB(cfg.ListenAddr, db, frontendFS,
+		api.WithSignalStatus(listeners...),
+		api.WithImporter(importer.New(db, summarizationSchedule(cfg))),
+		api.WithSchedule(summarizationSchedule(cfg)),
+		api.WithSummaryQueue(scheduler),
+		api.WithMonthlyBudget(monthlyBudget),
+		api.WithProviderHealth(aiClient))
+
+	go apiServer.Start()
+
+	// Each listener supervises its own connection and only returns on shutdown,
+	// so a signal-cli restart never takes down the API server or scheduler.
+	for _, client := range clients {
+		go func() {
+			if err := client.Listen(ctx); err != nil {
+				slog.Error("Signal listener stopped unexpectedly", "error", err)
+			}
+		}()
+	}
+
 	go scheduler.Start(ctx)
 
 	// Rotation scheduler removed
@@ -163,6 +198,49 @@ func main() {
 	}
 }
 
+// openDatabase creates, unlocks and migrates the encrypted database.
+func openDatabase(cfg *config.Config) (*database.DB, error) {
+	// Ensure the database directory exists
+	dbDir := filepath.Dir(cfg.DatabasePath)
+	if dbDir != "." && dbDir != "" {
+		if err := os.MkdirAll(dbDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory %s: %w", dbDir, err)
+		}
+	}
+
+	// Preflight: If an existing DB is plaintext (unencrypted), back it up and allow creation of a fresh encrypted DB
+	if err := backupIfPlaintext(cfg.DatabasePath); err != nil {
+		return nil, fmt.Errorf("preflight encryption check failed: %w", err)
+	}
+
+	// Mandatory encryption: load or create key using manager
+	encMgr := encryption.NewManager(cfg.DatabasePath)
+	encKey, err := encMgr.LoadOrCreateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain encryption key: %w", err)
+	}
+	// Log masked key fingerprint and source for troubleshooting in dev
+	{
+		finger := sha256.Sum256([]byte(encKey))
+		src := "generated"
+		if _, err := os.Stat(encMgr.SecretPath); err == nil { src = encMgr.SecretPath }
+		if _, err := os.Stat(encMgr.KeyFile); err == nil { src = encMgr.KeyFile }
+		slog.Info("Using encryption key", "source", src, "sha256_prefix", fmt.Sprintf("%x", finger)[:8])
+	}
+
+	db, err := database.NewDB(cfg.DatabasePath, encKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := db.Init(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	db.DefaultEphemeralPolicy = cfg.EphemeralPolicy
+	db.StoreDirectMessages = cfg.DirectMessages
+	return db, nil
+}
+
 // backupIfPlaintext inspects the first 16 bytes of the DB file. If it matches the
 // plain SQLite header ("SQLite format 3\x00"), it moves the file (and sidecars) to a timestamped backup
 // so the application can create a new encrypted database on first run.
@@ -245,6 +323,9 @@ func validateDatabasePath(dbPath string) error {
 
 // testAIProvider tests the AI provider and ensures it's ready
 func testAIProvider(ctx context.Context, aiClient *ai.Client, cfg *config.Config, db *database.DB) error {
+	if len(cfg.AIProviders) > 1 {
+		return testProviderChain(ctx, aiClient, cfg)
+	}
 	switch cfg.AIProvider {
 	case "local":
 		return testOllamaBackend(ctx, aiClient, cfg, db)
@@ -327,50 +408,177 @@ func testOpenAIBackend(ctx context.Context, aiClient *ai.Client, cfg *config.Con
 	return nil
 }
 
+// testProviderChain tests a fallback chain end-to-end. A provider that is down
+// at startup is skipped until it recovers, so failures only log a warning.
+func testProviderChain(ctx context.Context, aiClient *ai.Client, cfg *config.Config) error {
+	slog.Info("Testing AI provider fallback chain...", "providers", cfg.AIProviders)
+
+	testMessages := []database.MessageForSummary{
+		{
+			UserID:      1,
+			UserName:    "TestUser",
+			Text:        "Hello, are you there?",
+			MessageType: "regular",
+		},
+	}
+
+	testCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	result, err := aiClient.SummarizeWithResult(testCtx, testMessages, ai.SummarizeOptions{})
+	if err != nil {
+		slog.Warn("No AI provider answered the test, but continuing startup", "error", err)
+		return nil
+	}
+
+	slog.Info("AI provider fallback chain is ready", "provider", result.Provider, "model", result.Model, "test_response_length", len(result.Text))
+	return nil
+}
+
 // validateConfig validates provider-specific configuration requirements
 func validateConfig(cfg *config.Config) error {
-	// Check required environment variables based on provider
-	switch cfg.AIProvider {
-	case "openai":
-		if cfg.OpenAIAPIKey == "" {
-			return fmt.Errorf("OPENAI_API_KEY is required when AI_PROVIDER=openai")
-		}
-		if cfg.OpenAIModel == "" {
-			return fmt.Errorf("OPENAI_MODEL is required when AI_PROVIDER=openai")
-		}
-		slog.Info("Using OpenAI provider", "model", cfg.OpenAIModel)
-	case "groq":
-		if cfg.GroqAPIKey == "" {
-			return fmt.Errorf("GROQ_API_KEY is required when AI_PROVIDER=groq")
-		}
-		slog.Info("Using Groq provider", "model", cfg.GroqModel)
-	case "gemini":
-		if cfg.GeminiAPIKey == "" {
-			return fmt.Errorf("GEMINI_API_KEY is required when AI_PROVIDER=gemini")
-		}
-		slog.Info("Using Gemini provider", "model", cfg.GeminiModel)
-	case "claude":
-		if cfg.ClaudeAPIKey == "" {
-			return fmt.Errorf("CLAUDE_API_KEY is required when AI_PROVIDER=claude")
-		}
-		slog.Info("Using Claude provider", "model", cfg.ClaudeModel)
-	case "local":
-		if cfg.LocalModel == "" {
-			return fmt.Errorf("LOCAL_MODEL is required when AI_PROVIDER=local")
+	// Check required environment variables of each provider in the chain
+	for _, provider := range cfg.AIProviders {
+		switch provider {
+		case "openai":
+			if cfg.OpenAIAPIKey == "" {
+				return fmt.Errorf("OPENAI_API_KEY is required when AI_PROVIDER includes openai")
+			}
+			if cfg.OpenAIModel == "" {
+				return fmt.Errorf("OPENAI_MODEL is required when AI_PROVIDER includes openai")
+			}
+			slog.Info("Using OpenAI provider", "model", cfg.OpenAIModel)
+		case "groq":
+			if cfg.GroqAPIKey == "" {
+				return fmt.Errorf("GROQ_API_KEY is required when AI_PROVIDER includes groq")
+			}
+			slog.Info("Using Groq provider", "model", cfg.GroqModel)
+		case "gemini":
+			if cfg.GeminiAPIKey == "" {
+				return fmt.Errorf("GEMINI_API_KEY is required when AI_PROVIDER includes gemini")
+			}
+			slog.Info("Using Gemini provider", "model", cfg.GeminiModel)
+		case "claude":
+			if cfg.ClaudeAPIKey == "" {
+				return fmt.Errorf("CLAUDE_API_KEY is required when AI_PROVIDER includes claude")
+			}
+			slog.Info("Using Claude provider", "model", cfg.ClaudeModel)
+		case "local":
+			if cfg.LocalModel == "" {
+				return fmt.Errorf("LOCAL_MODEL is required when AI_PROVIDER includes local")
+			}
+			slog.Info("Using Ollama provider", "model", cfg.LocalModel, "host", cfg.OllamaHost)
+		default:
+			return fmt.Errorf("unsupported AI_PROVIDER: %s (supported: 'local', 'openai', 'groq', 'gemini', 'claude')", provider)
 		}
-		slog.Info("Using Ollama provider", "model", cfg.LocalModel, "host", cfg.OllamaHost)
-	default:
-		return fmt.Errorf("unsupported AI_PROVIDER: %s (supported: 'local', 'openai', 'groq', 'gemini', 'claude')", cfg.AIProvider)
 	}
 
 	// Check required general settings
 	if cfg.PhoneNumber == "" {
 		return fmt.Errorf("SIGNAL_PHONE_NUMBER is required")
 	}
+	if !database.ValidEphemeralPolicy(cfg.EphemeralPolicy) {
+		return fmt.Errorf("unsupported EPHEMERAL_POLICY: %s (supported: 'respect', 'skip', 'keep')", cfg.EphemeralPolicy)
+	}
+	if _, err := newSignalReceiver(cfg, cfg.PhoneNumber); err != nil {
+		return err
+	}
+	for name, value := range map[string]string{
+		"SUMMARY_MIN_MESSAGES":     cfg.SummaryMinMessages,
+		"SUMMARY_MIN_PARTICIPANTS": cfg.SummaryMinParticipants,
+		"SUMMARY_MIN_CHARS":        cfg.SummaryMinChars,
+	} {
+		if n, err := strconv.Atoi(value); value != "" && (err != nil || n < 0) {
+			return fmt.Errorf("invalid %s: %s", name, value)
+		}
+	}
+	for name, value := range map[string]string{
+		"AI_CONTEXT_TOKENS":    cfg.AIContextTokens,
+		"LOCAL_CONTEXT_TOKENS": cfg.LocalContextTokens,
+	} {
+		if n, err := strconv.Atoi(value); value != "" && (err != nil || n < 1) {
+			return fmt.Errorf("invalid %s: %s", name, value)
+		}
+	}
+	if _, err := ai.ParsePrices(cfg.LLMPrices); err != nil {
+		return fmt.Errorf("invalid LLM_PRICES: %w", err)
+	}
+	if budget, err := strconv.ParseFloat(cfg.MonthlyBudgetUSD, 64); cfg.MonthlyBudgetUSD != "" && (err != nil || budget < 0) {
+		return fmt.Errorf("invalid MONTHLY_BUDGET_USD: %s", cfg.MonthlyBudgetUSD)
+	}
+	if _, err := schedule.ParseQuietHours(cfg.SummaryQuietHours, time.UTC); err != nil {
+		return fmt.Errorf("invalid SUMMARY_QUIET_HOURS: %w", err)
+	}
+	if _, err := summarizationSchedule(cfg).Parse(); err != nil {
+		return fmt.Errorf("invalid SUMMARIZATION_SCHEDULE: %w", err)
+	}
+	if n, err := strconv.Atoi(cfg.SummaryWorkers); err != nil || n < 1 {
+		return fmt.Errorf("invalid SUMMARY_WORKERS: %s", cfg.SummaryWorkers)
+	}
+	if n, err := strconv.Atoi(cfg.SummaryMaxAttempts); err != nil || n < 1 {
+		return fmt.Errorf("invalid SUMMARY_MAX_ATTEMPTS: %s", cfg.SummaryMaxAttempts)
+	}
+	if d, err := time.ParseDuration(cfg.SummaryRetryBackoff); err != nil || d <= 0 {
+		return fmt.Errorf("invalid SUMMARY_RETRY_BACKOFF: %s", cfg.SummaryRetryBackoff)
+	}
+	if cfg.BotCommands {
+		if cfg.BotCommandPrefix == "" || strings.ContainsAny(cfg.BotCommandPrefix, " \t\n") {
+			return fmt.Errorf("invalid BOT_COMMAND_PREFIX: %q", cfg.BotCommandPrefix)
+		}
+		if d, err := time.ParseDuration(cfg.BotCommandRateLimit); err != nil || d < 0 {
+			return fmt.Errorf("invalid BOT_COMMAND_RATE_LIMIT: %s", cfg.BotCommandRateLimit)
+		}
+	}
 
 	return nil
 }
 
+// summarizationSchedule is the schedule of groups without their own.
+func summarizationSchedule(cfg *config.Config) schedule.Config {
+	spec := cfg.SummarizationSchedule
+	if spec == "" {
+		spec = cfg.SummarizationInterval
+	}
+	// Validated in validateConfig
+	minimum := func(value string) *int {
+		if value == "" {
+			return nil
+		}
+		n, _ := strconv.Atoi(value)
+		return &n
+	}
+	return schedule.Config{
+		Spec:            spec,
+		TimeZone:        cfg.SummarizationTimeZone,
+		QuietHours:      cfg.SummaryQuietHours,
+		MinMessages:     minimum(cfg.SummaryMinMessages),
+		MinParticipants: minimum(cfg.SummaryMinParticipants),
+		MinChars:        minimum(cfg.SummaryMinChars),
+	}
+}
+
+// newSignalReceiver creates the receiver selected by SIGNAL_RECEIVE_MODE for
+// one account.
+func newSignalReceiver(cfg *config.Config, number string) (signalclient.Receiver, error) {
+	switch cfg.SignalReceiveMode {
+	case signalclient.ReceiveModeWebSocket:
+		return signalclient.NewWebSocketReceiver(cfg.SignalURL, number), nil
+	case signalclient.ReceiveModePoll:
+		interval, err := time.ParseDuration(cfg.SignalPollInterval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid SIGNAL_POLL_INTERVAL: %s", cfg.SignalPollInterval)
+		}
+		return signalclient.NewPollingReceiver(cfg.SignalURL, number, interval), nil
+	case signalclient.ReceiveModeJSONRPC:
+		if cfg.SignalJSONRPCAddr == "" {
+			return nil, fmt.Errorf("SIGNAL_JSONRPC_ADDR is required when SIGNAL_RECEIVE_MODE=jsonrpc")
+		}
+		return signalclient.NewJSONRPCReceiver(cfg.SignalJSONRPCAddr, number), nil
+	default:
+		return nil, fmt.Errorf("unsupported SIGNAL_RECEIVE_MODE: %s (supported: 'websocket', 'poll', 'jsonrpc')", cfg.SignalReceiveMode)
+	}
+}
+
 // validateOllamaStartup performs comprehensive validation of the external Ollama server with retry logic
 func validateOllamaStartup(ctx context.Context, cfg *config.Config) error {
 	client := ollama.NewClient(cfg.OllamaHost, cfg.LocalModel)
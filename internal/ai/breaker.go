@@ -0,0 +1,118 @@
+package ai
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// breakerThreshold consecutive failures take a provider out of the chain
+	breakerThreshold = 3
+	// breakerCooldown is how long a provider is skipped before it is tried again
+	breakerCooldown = time.Minute
+	// maxBreakerCooldown bounds the cooldown, which doubles while a provider
+	// keeps failing
+	maxBreakerCooldown = 30 * time.Minute
+)
+
+// Circuit states reported on /health.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// circuitBreaker stops calls to a provider that keeps failing. After the
+// cooldown one call is let through, which closes the circuit again if it
+// succeeds.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	failures  int
+	cooldown  time.Duration
+	openUntil time.Time
+	// probing is when the call after the cooldown started, zero if none
+	probing   time.Time
+	lastError string
+}
+
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{now: time.Now, cooldown: breakerCooldown}
+}
+
+// allow reports whether the provider may be called.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < breakerThreshold {
+		return true
+	}
+	now := b.now()
+	if now.Before(b.openUntil) {
+		return false
+	}
+	// A probe that never reported back, e.g. after a shutdown, expires
+	if !b.probing.IsZero() && now.Sub(b.probing) < b.cooldown {
+		return false
+	}
+	b.probing = now
+	return true
+}
+
+// success closes the circuit.
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.cooldown = breakerCooldown
+	b.probing = time.Time{}
+	b.lastError = ""
+}
+
+// failure counts a failed call and opens the circuit at the threshold. A
+// failed probe opens it again for twice as long.
+func (b *circuitBreaker) failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastError = err.Error()
+	if !b.probing.IsZero() {
+		b.probing = time.Time{}
+		b.cooldown = min(2*b.cooldown, maxBreakerCooldown)
+	}
+	b.failures++
+	if b.failures >= breakerThreshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+// ProviderHealth is the state of the circuit of a provider.
+type ProviderHealth struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model,omitempty"`
+	// State is closed while the provider is called, open while it is skipped
+	// and half-open while a call tests whether it recovered
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	LastError           string     `json:"lastError,omitempty"`
+	RetryAt             *time.Time `json:"retryAt,omitempty"`
+}
+
+func (b *circuitBreaker) health() ProviderHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	h := ProviderHealth{State: CircuitClosed, ConsecutiveFailures: b.failures, LastError: b.lastError}
+	if b.failures >= breakerThreshold {
+		switch {
+		case !b.probing.IsZero() && b.now().Sub(b.probing) < b.cooldown:
+			h.State = CircuitHalfOpen
+		case b.now().Before(b.openUntil):
+			h.State = CircuitOpen
+			retryAt := b.openUntil
+			h.RetryAt = &retryAt
+		default:
+			// The next call is let through
+			h.State = CircuitHalfOpen
+		}
+	}
+	return h
+}
@@ -0,0 +1,210 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"summarizarr/internal/database"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// minChunkTokens stops tiny contexts from splitting a window into
+	// hundreds of chunks
+	minChunkTokens = 512
+	// chunkWorkers bounds how many chunks of a window are summarized at once
+	// by a hosted provider. A local Ollama runs one prompt at a time.
+	chunkWorkers = 4
+)
+
+// MergePrompt combines the summaries of the chunks of a long conversation.
+const MergePrompt = `The following are summaries of consecutive parts of one Signal group conversation, in order. Combine them into one concise summary of the whole conversation using the following exact markdown format:
+
+## Key topics discussed
+- [List each main topic as a bullet point]
+
+## Important decisions or conclusions
+- [List each decision or conclusion as a bullet point]
+
+## Action items or next steps
+- [List each action item as a bullet point]
+
+## Notable reactions or responses
+- [List notable reactions as bullet points]
+
+IMPORTANT: Use exactly the header format shown above (## Header name). Merge points that appear in several parts, and prefer later decisions over earlier ones. Keep participant names such as user_3 exactly as written.
+
+Summaries of the parts:
+{{.Messages}}`
+
+// chunkTokens returns how many tokens of conversation fit in one prompt.
+func (c *Client) chunkTokens(provider, template string) int {
+	if template == "" {
+		template = SummarizationPrompt
+	}
+	return max(c.contextTokens(provider)-responseTokens-EstimateTokens(template), minChunkTokens)
+}
+
+// chunkWorkers returns how many prompts are sent to a provider at once.
+func (c *Client) chunkWorkers(provider string) int {
+	if provider == "" && c.cfg != nil {
+		provider = c.cfg.AIProvider
+	}
+	if provider == "local" {
+		return 1
+	}
+	return chunkWorkers
+}
+
+// chunkMessages splits messages into consecutive chunks whose formatted text
+// fits in maxTokens. Messages longer than that are trimmed to fit.
+func chunkMessages(messages []database.MessageForSummary, maxTokens int) [][]database.MessageForSummary {
+	var chunks [][]database.MessageForSummary
+	var chunk []database.MessageForSummary
+	tokens := 0
+	for _, msg := range messages {
+		n := EstimateTokens(FormatMessagesForLLM([]database.MessageForSummary{msg}))
+		if n > maxTokens {
+			msg, n = trimMessage(msg, maxTokens)
+		}
+		if len(chunk) > 0 && tokens+n > maxTokens {
+			chunks = append(chunks, chunk)
+			chunk, tokens = nil, 0
+		}
+		chunk = append(chunk, msg)
+		tokens += n
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// trimMessage shortens the text and quote of a message so that it formats
+// to at most maxTokens, if they are long enough to. It returns the message
+// and its estimated tokens.
+func trimMessage(msg database.MessageForSummary, maxTokens int) (database.MessageForSummary, int) {
+	// Offsets of mentions do not survive trimming, resolve them first
+	msg.Text = replaceMentions(msg.Text, msg.Mentions)
+	msg.Mentions = nil
+	msg.QuoteText = truncateRunes(msg.QuoteText, maxTokens)
+
+	n := EstimateTokens(FormatMessagesForLLM([]database.MessageForSummary{msg}))
+	if excess := (n - maxTokens) * 4; excess > 0 {
+		msg.Text = truncateRunes(msg.Text, max(utf8.RuneCountInString(msg.Text)-excess, 1))
+		n = EstimateTokens(FormatMessagesForLLM([]database.MessageForSummary{msg}))
+	}
+	return msg, n
+}
+
+// summarizeChunks summarizes a conversation that does not fit in one prompt:
+// every chunk is summarized on its own, then the summaries are merged.
+func (c *Client) summarizeChunks(ctx context.Context, backend AIClient, messages []database.MessageForSummary, opts SummarizeOptions) (string, Usage, error) {
+	chunks := chunkMessages(messages, c.chunkTokens(opts.Provider, SummarizationPrompt))
+	prompts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		header := fmt.Sprintf("This is part %d of %d of a long conversation.\n\n", i+1, len(chunks))
+		prompts[i] = header + buildPrompt("", FormatMessagesForLLM(chunk))
+	}
+
+	partials, usage, err := c.summarizeAll(ctx, backend, prompts, opts)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	summary, mergeUsage, err := c.mergeSummaries(ctx, backend, partials, opts)
+	usage.add(mergeUsage)
+	return summary, usage, err
+}
+
+// mergeSummaries combines the summaries of consecutive chunks into one. If
+// they do not fit in one prompt, they are merged in groups first.
+func (c *Client) mergeSummaries(ctx context.Context, backend AIClient, partials []string, opts SummarizeOptions) (string, Usage, error) {
+	maxTokens := c.chunkTokens(opts.Provider, MergePrompt)
+	var usage Usage
+	for {
+		var groups []string
+		var group strings.Builder
+		for i, partial := range partials {
+			part := fmt.Sprintf("### Part %d\n%s\n\n", i+1, strings.TrimSpace(partial))
+			if group.Len() > 0 && EstimateTokens(group.String()+part) > maxTokens {
+				groups = append(groups, group.String())
+				group.Reset()
+			}
+			group.WriteString(part)
+		}
+		groups = append(groups, group.String())
+
+		if len(groups) == 1 {
+			template := MergePrompt
+			if opts.Prompt != "" {
+				template = opts.Prompt
+			}
+			summary, mergeUsage, err := c.complete(ctx, backend, opts, buildPrompt(template, groups[0]))
+			usage.add(mergeUsage)
+			return summary, usage, err
+		}
+		if len(groups) == len(partials) {
+			// Every summary fills a prompt on its own, merging cannot shrink them
+			return "", usage, fmt.Errorf("chunk summaries exceed the context of %d tokens", c.contextTokens(opts.Provider))
+		}
+
+		prompts := make([]string, len(groups))
+		for i, g := range groups {
+			prompts[i] = buildPrompt(MergePrompt, g)
+		}
+		var groupUsage Usage
+		var err error
+		if partials, groupUsage, err = c.summarizeAll(ctx, backend, prompts, opts); err != nil {
+			return "", usage, err
+		}
+		usage.add(groupUsage)
+	}
+}
+
+// summarizeAll sends prompts to the backend, a few at a time, and returns
+// the responses in order. It stops at the first error.
+func (c *Client) summarizeAll(ctx context.Context, backend AIClient, prompts []string, opts SummarizeOptions) ([]string, Usage, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]string, len(prompts))
+	usages := make([]Usage, len(prompts))
+	var failed error
+	var once sync.Once
+	sem := make(chan struct{}, c.chunkWorkers(opts.Provider))
+	var wg sync.WaitGroup
+	for i, prompt := range prompts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+			var err error
+			if results[i], usages[i], err = c.complete(ctx, backend, opts, prompt); err != nil {
+				// Parts cancelled after the first failure do not hide it
+				once.Do(func() {
+					failed = fmt.Errorf("failed to summarize part %d of %d: %w", i+1, len(prompts), err)
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if failed != nil {
+		return nil, Usage{}, failed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, Usage{}, err
+	}
+
+	var usage Usage
+	for _, u := range usages {
+		usage.add(u)
+	}
+	return results, usage, nil
+}
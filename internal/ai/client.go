@@ -6,12 +6,15 @@ import (
 	"fmt"
 	"log/slog"
 	"regexp"
+	"strconv"
 	"strings"
 	"summarizarr/internal/config"
 	"summarizarr/internal/database"
 	"summarizarr/internal/llm"
 	"summarizarr/internal/ollama"
+	"sync"
 	"time"
+	"unicode/utf16"
 )
 
 // Pre-compiled regex patterns to prevent ReDoS attacks
@@ -48,7 +51,7 @@ const SummarizationPrompt = `Please provide a concise summary of this Signal gro
 
 IMPORTANT: Use exactly the header format shown above (## Header name). Each section should be a proper markdown header followed by bullet points.
 
-Conversation format: Regular messages, quoted replies (shown as 'replying to: "original text"'), and emoji reactions.
+Conversation format: Regular messages, quoted replies (shown as 'replying to: "original text"'), shared media (shown as 'shared an image'), @mentions of other participants (shown as '@user_N'), emoji reactions (shown as 'message from user_N "..." got 👍x2'), and group changes (shown as 'user_N joined the group').
 
 Conversation:
 {{.Messages}}`
@@ -63,27 +66,174 @@ func FormatMessagesForLLM(messages []database.MessageForSummary) string {
 	var content strings.Builder
 
 	for _, msg := range messages {
+		text := replaceMentions(msg.Text, msg.Mentions)
+
 		switch msg.MessageType {
+		case database.MessageTypeEarlierMessage:
+			// Only shown for the reactions it received in this window
+			writeReactions(&content, msg, text)
+			continue
+		case database.MessageTypeGroupEvent:
+			if line := describeGroupEvent(msg); line != "" {
+				content.WriteString(line + "\n")
+			}
+			continue
 		case "reaction":
 			if msg.ReactionEmoji != "" {
 				content.WriteString(fmt.Sprintf("user_%d reacted with %s\n", msg.UserID, msg.ReactionEmoji))
 			}
+			continue
 		case "quote":
-			if msg.QuoteText != "" && msg.Text != "" {
-				content.WriteString(fmt.Sprintf("user_%d (replying to: \"%s\"): %s\n", msg.UserID, msg.QuoteText, msg.Text))
-			} else if msg.Text != "" {
-				content.WriteString(fmt.Sprintf("user_%d: %s\n", msg.UserID, msg.Text))
+			quoteText := msg.QuoteText
+			if quoteText == "" {
+				// Replies to media-only messages have no quote text
+				quoteText = describeQuotedAttachments(msg.Attachments)
+			}
+			if quoteText != "" && text != "" {
+				content.WriteString(fmt.Sprintf("user_%d (replying to: \"%s\"): %s\n", msg.UserID, quoteText, text))
+			} else if text != "" {
+				content.WriteString(fmt.Sprintf("user_%d: %s\n", msg.UserID, text))
 			}
 		default: // regular message
-			if msg.Text != "" {
-				content.WriteString(fmt.Sprintf("user_%d: %s\n", msg.UserID, msg.Text))
+			if text != "" {
+				content.WriteString(fmt.Sprintf("user_%d: %s\n", msg.UserID, text))
+			}
+		}
+
+		for _, att := range msg.Attachments {
+			if att.IsQuote {
+				continue
+			}
+			content.WriteString(fmt.Sprintf("user_%d shared %s", msg.UserID, describeAttachment(att)))
+			if att.Caption != "" {
+				content.WriteString(fmt.Sprintf(" (caption: %s)", att.Caption))
 			}
+			content.WriteString("\n")
 		}
+
+		writeReactions(&content, msg, text)
 	}
 
 	return content.String()
 }
 
+// maxReactionSnippet bounds how much of a reacted-to message is repeated.
+const maxReactionSnippet = 60
+
+// writeReactions adds one aggregated line for the reactions a message got,
+// e.g. `message from user_2 "see you at 8" got 👍x4 ❤️x2`.
+func writeReactions(content *strings.Builder, msg database.MessageForSummary, text string) {
+	if len(msg.Reactions) == 0 {
+		return
+	}
+
+	content.WriteString(fmt.Sprintf("message from user_%d", msg.UserID))
+	if snippet := truncateRunes(text, maxReactionSnippet); snippet != "" {
+		content.WriteString(fmt.Sprintf(" \"%s\"", snippet))
+	} else {
+		for _, att := range msg.Attachments {
+			if !att.IsQuote {
+				content.WriteString(fmt.Sprintf(" (%s)", describeAttachment(att)))
+				break
+			}
+		}
+	}
+	content.WriteString(" got")
+	for _, r := range msg.Reactions {
+		content.WriteString(fmt.Sprintf(" %sx%d", r.Emoji, r.Count))
+	}
+	content.WriteString("\n")
+}
+
+// truncateRunes shortens s to at most n runes, marking the cut with an ellipsis.
+func truncateRunes(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// describeGroupEvent renders a membership or settings change as a system line.
+func describeGroupEvent(msg database.MessageForSummary) string {
+	actor := "someone"
+	if msg.UserID > 0 {
+		actor = fmt.Sprintf("user_%d", msg.UserID)
+	}
+	switch msg.EventType {
+	case database.GroupEventMemberJoined:
+		return actor + " joined the group"
+	case database.GroupEventMemberLeft:
+		return actor + " left the group"
+	case database.GroupEventRenamed:
+		return fmt.Sprintf("%s renamed the group to \"%s\"", actor, msg.Text)
+	case database.GroupEventDescriptionChanged:
+		return actor + " changed the group description"
+	case database.GroupEventUpdated:
+		return actor + " updated the group settings"
+	default:
+		return ""
+	}
+}
+
+// replaceMentions swaps the placeholder spans Signal uses for @mentions with
+// anonymized @user_N tokens. Offsets are UTF-16 code units; spans that do not
+// fit the text are left untouched.
+func replaceMentions(text string, mentions []database.MentionForSummary) string {
+	if len(mentions) == 0 {
+		return text
+	}
+
+	units := utf16.Encode([]rune(text))
+	var out []uint16
+	pos := 0
+	for _, m := range mentions {
+		end := m.Start + m.Length
+		if m.Start < pos || m.Length <= 0 || end > len(units) {
+			continue
+		}
+		out = append(out, units[pos:m.Start]...)
+		out = append(out, utf16.Encode([]rune(fmt.Sprintf("@user_%d", m.UserID)))...)
+		pos = end
+	}
+	out = append(out, units[pos:]...)
+
+	return string(utf16.Decode(out))
+}
+
+// describeAttachment renders a short, human-readable kind for an attachment.
+// Filenames are only included for documents, where they usually carry meaning.
+func describeAttachment(att database.AttachmentForSummary) string {
+	contentType := strings.ToLower(att.ContentType)
+	switch {
+	case att.VoiceNote:
+		return "a voice note"
+	case contentType == "image/gif":
+		return "a GIF"
+	case strings.HasPrefix(contentType, "image/"):
+		return "an image"
+	case strings.HasPrefix(contentType, "video/"):
+		return "a video"
+	case strings.HasPrefix(contentType, "audio/"):
+		return "an audio file"
+	case att.Filename != "":
+		return fmt.Sprintf("a file (%s)", att.Filename)
+	default:
+		return "a file"
+	}
+}
+
+// describeQuotedAttachments summarizes the media of a quoted message, if any.
+func describeQuotedAttachments(attachments []database.AttachmentForSummary) string {
+	for _, att := range attachments {
+		if att.IsQuote {
+			return describeAttachment(att)
+		}
+	}
+	return ""
+}
+
 // SanitizeSummaryFormat ensures consistent markdown formatting for summaries with security safeguards
 func SanitizeSummaryFormat(summary string) string {
 	// Input validation to prevent DoS attacks
@@ -162,6 +312,35 @@ func SanitizeSummaryFormat(summary string) string {
 type Client struct {
 	backend AIClient
 	db      DB
+
+	// cfg configures the backends of other providers than the default one
+	cfg       *config.Config
+	mu        sync.Mutex
+	providers map[string]AIClient
+	// breakers skip providers of the fallback chain that keep failing
+	breakers map[string]*circuitBreaker
+
+	// prices turns the tokens of calls into costs
+	prices PriceTable
+	// budget pauses cloud providers once the month cost more USD, 0 is
+	// unlimited
+	budget float64
+}
+
+// ErrProviderUnavailable is returned when a summary asks for a provider that
+// is not configured.
+var ErrProviderUnavailable = errors.New("AI provider not available")
+
+// SummarizeOptions overrides the configured provider and prompt of a summary.
+type SummarizeOptions struct {
+	Provider string
+	// Prompt replaces SummarizationPrompt. The conversation is appended
+	// unless it contains {{.Messages}}.
+	Prompt string
+
+	// Group and job that calls to the provider are recorded for
+	GroupID int64
+	JobID   int64
 }
 
 // validateProviderConfig validates provider-specific configuration requirements
@@ -220,12 +399,43 @@ func NewClient(cfg *config.Config, db DB) (*Client, error) {
 		return nil, fmt.Errorf("provider validation failed: %w", err)
 	}
 
+	backend, err := newBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+	prices, err := ParsePrices(cfg.LLMPrices)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LLM_PRICES: %w", err)
+	}
+	var budget float64
+	if cfg.MonthlyBudgetUSD != "" {
+		if budget, err = strconv.ParseFloat(cfg.MonthlyBudgetUSD, 64); err != nil || budget < 0 {
+			return nil, fmt.Errorf("invalid MONTHLY_BUDGET_USD: %s", cfg.MonthlyBudgetUSD)
+		}
+	}
+	c := &Client{backend: backend, db: db, cfg: cfg, prices: prices, budget: budget}
+	// The fallback providers are created up front so a typo fails at startup
+	for _, provider := range cfg.AIProviders {
+		if _, err := c.backendFor(provider); err != nil {
+			return nil, fmt.Errorf("provider validation failed: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// newBackend creates the backend of cfg.AIProvider.
+func newBackend(cfg *config.Config) (AIClient, error) {
 	var backend AIClient
 	provider := cfg.AIProvider
 
 	switch provider {
 	case "local":
-		backend = ollama.NewClient(cfg.OllamaHost, cfg.LocalModel)
+		client := ollama.NewClient(cfg.OllamaHost, cfg.LocalModel)
+		// Validated in validateConfig
+		if n, err := strconv.Atoi(cfg.LocalContextTokens); err == nil && n > 0 {
+			client.WithContextSize(n)
+		}
+		backend = client
 	case "openai":
 		backend = llm.NewClient(llm.Config{
 			APIKey:  cfg.OpenAIAPIKey,
@@ -254,28 +464,141 @@ func NewClient(cfg *config.Config, db DB) (*Client, error) {
 		// This should never be reached due to validation above, but keeping for safety
 		return nil, fmt.Errorf("unsupported AI provider: %s (supported: 'local', 'openai', 'groq', 'gemini', 'claude')", provider)
 	}
-	return &Client{backend: backend, db: db}, nil
+	return backend, nil
+}
+
+// ValidateProvider checks that a provider can be used for a summary. An
+// empty provider is the configured one.
+func (c *Client) ValidateProvider(provider string) error {
+	_, err := c.backendFor(provider)
+	return err
+}
+
+// backendFor returns the backend of a provider, created on first use from
+// the credentials in the configuration.
+func (c *Client) backendFor(provider string) (AIClient, error) {
+	if provider == "" || (c.cfg != nil && provider == c.cfg.AIProvider) {
+		return c.backend, nil
+	}
+	if c.cfg == nil {
+		return nil, fmt.Errorf("%w: %s", ErrProviderUnavailable, provider)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if backend, ok := c.providers[provider]; ok {
+		return backend, nil
+	}
+	cfg := *c.cfg
+	cfg.AIProvider = provider
+	if err := validateProviderConfig(&cfg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	backend, err := newBackend(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	if c.providers == nil {
+		c.providers = make(map[string]AIClient)
+	}
+	c.providers[provider] = backend
+	return backend, nil
+}
+
+// providerName returns the name of a provider, the configured one if empty.
+func (c *Client) providerName(provider string) string {
+	if provider == "" && c.cfg != nil {
+		return c.cfg.AIProvider
+	}
+	return provider
+}
+
+// CheckBudget returns ErrBudgetExceeded if a provider may not be called
+// because the calls of this month used up MONTHLY_BUDGET_USD. Local models
+// are never paused. An empty provider passes while any provider of the
+// fallback chain may be called.
+func (c *Client) CheckBudget(provider string) error {
+	var err error
+	for _, p := range c.providerChain(provider) {
+		if err = c.checkBudget(p); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (c *Client) checkBudget(provider string) error {
+	if c.budget <= 0 || c.db == nil || c.providerName(provider) == "local" {
+		return nil
+	}
+	spent, err := c.db.LLMCostSince(BudgetPeriodStart(time.Now()).UnixMilli())
+	if err != nil {
+		return err
+	}
+	if spent >= c.budget {
+		return fmt.Errorf("%w: spent $%.2f of $%.2f", ErrBudgetExceeded, spent, c.budget)
+	}
+	return nil
+}
+
+// buildPrompt fills a prompt template with the formatted conversation.
+func buildPrompt(template, formatted string) string {
+	if template == "" {
+		template = SummarizationPrompt
+	} else if !strings.Contains(template, "{{.Messages}}") {
+		template += "\n\nConversation:\n{{.Messages}}"
+	}
+	return strings.Replace(template, "{{.Messages}}", formatted, 1)
 }
 
 // Summarize formats messages, creates prompt, calls backend, and handles post-processing
 func (c *Client) Summarize(ctx context.Context, messages []database.MessageForSummary) (string, error) {
+	return c.SummarizeWithOptions(ctx, messages, SummarizeOptions{})
+}
+
+// SummarizeWithOptions summarizes messages like Summarize, with another
+// provider or prompt.
+func (c *Client) SummarizeWithOptions(ctx context.Context, messages []database.MessageForSummary, opts SummarizeOptions) (string, error) {
+	summary, _, err := c.SummarizeWithUsage(ctx, messages, opts)
+	return summary, err
+}
+
+// SummarizeWithUsage summarizes messages like SummarizeWithOptions, and
+// returns the tokens all calls to the provider used.
+func (c *Client) SummarizeWithUsage(ctx context.Context, messages []database.MessageForSummary, opts SummarizeOptions) (string, Usage, error) {
+	result, err := c.SummarizeWithResult(ctx, messages, opts)
+	return result.Text, result.Usage, err
+}
+
+// summarize summarizes messages with the provider of opts alone.
+func (c *Client) summarize(ctx context.Context, messages []database.MessageForSummary, opts SummarizeOptions) (string, Usage, error) {
+	backend, err := c.backendFor(opts.Provider)
+	if err != nil {
+		return "", Usage{}, err
+	}
+
 	// Format messages with anonymization
 	formatted := FormatMessagesForLLM(messages)
 
-	// Create prompt using template
-	prompt := strings.Replace(SummarizationPrompt, "{{.Messages}}", formatted, 1)
-
-	// Call backend with constructed prompt
-	summary, err := c.backend.Summarize(ctx, prompt)
+	var summary string
+	var usage Usage
+	if EstimateTokens(formatted) <= c.chunkTokens(opts.Provider, opts.Prompt) {
+		// Create prompt using template and call backend with it
+		summary, usage, err = c.complete(ctx, backend, opts, buildPrompt(opts.Prompt, formatted))
+	} else {
+		// Too long for one prompt, summarize it in parts
+		summary, usage, err = c.summarizeChunks(ctx, backend, messages, opts)
+	}
 	if err != nil {
-		return "", err
+		return "", Usage{}, err
 	}
 
 	// Sanitize format for consistency
 	summary = SanitizeSummaryFormat(summary)
 
 	// Post-process: substitute user IDs with real names
-	return c.substituteUserNames(summary, messages)
+	summary, err = c.substituteUserNames(summary, messages)
+	return summary, usage, err
 }
 
 // substituteUserNames replaces user_ID placeholders with real names in the summary
@@ -283,7 +606,14 @@ func (c *Client) substituteUserNames(summary string, messages []database.Message
 	// Build map of unique user IDs from messages
 	userIDs := make(map[int64]struct{})
 	for _, msg := range messages {
-		userIDs[msg.UserID] = struct{}{}
+		// Group events without a known actor have no user
+		if msg.UserID > 0 {
+			userIDs[msg.UserID] = struct{}{}
+		}
+		// Mentioned members may not have written anything themselves
+		for _, m := range msg.Mentions {
+			userIDs[m.UserID] = struct{}{}
+		}
 	}
 
 	// Substitute each user ID with real name from database
@@ -0,0 +1,123 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"summarizarr/internal/config"
+	"summarizarr/internal/database"
+	"sync"
+	"testing"
+)
+
+// chunkBackend records the prompts it is sent from several goroutines
+type chunkBackend struct {
+	mu      sync.Mutex
+	prompts []string
+	fail    string
+}
+
+func (b *chunkBackend) Summarize(ctx context.Context, prompt string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prompts = append(b.prompts, prompt)
+	if b.fail != "" && strings.Contains(prompt, b.fail) {
+		return "", errors.New("backend unavailable")
+	}
+	if strings.HasPrefix(prompt, "The following are summaries") {
+		return "## Key topics discussed\n- Merged by user_1", nil
+	}
+	return fmt.Sprintf("## Key topics discussed\n- Part %d", len(b.prompts)), nil
+}
+
+func longConversation(n int) []database.MessageForSummary {
+	messages := make([]database.MessageForSummary, n)
+	for i := range messages {
+		messages[i] = database.MessageForSummary{UserID: int64(i%3 + 1), Text: fmt.Sprintf("message %04d %s", i, strings.Repeat("word ", 40))}
+	}
+	return messages
+}
+
+func TestChunkMessages(t *testing.T) {
+	messages := longConversation(100)
+	chunks := chunkMessages(messages, 1000)
+	if len(chunks) < 2 {
+		t.Fatalf("Expected several chunks, got %d", len(chunks))
+	}
+
+	var joined []database.MessageForSummary
+	for _, chunk := range chunks {
+		if tokens := EstimateTokens(FormatMessagesForLLM(chunk)); tokens > 1000 {
+			t.Errorf("Expected chunks of at most 1000 tokens, got %d", tokens)
+		}
+		joined = append(joined, chunk...)
+	}
+	if len(joined) != len(messages) {
+		t.Fatalf("Expected %d messages in the chunks, got %d", len(messages), len(joined))
+	}
+	for i := range joined {
+		if joined[i].Text != messages[i].Text {
+			t.Fatalf("Expected the chunks to keep the order of the messages, message %d differs", i)
+		}
+	}
+
+	// Messages over the budget are trimmed to fit
+	long := database.MessageForSummary{UserID: 1, Text: "@x " + strings.Repeat("long ", 2000), Mentions: []database.MentionForSummary{{UserID: 2, Start: 0, Length: 2}}}
+	chunks = chunkMessages([]database.MessageForSummary{messages[0], long}, 500)
+	if len(chunks) != 2 || len(chunks[1]) != 1 {
+		t.Fatalf("Expected the long message in a chunk of its own, got %d chunks", len(chunks))
+	}
+	formatted := FormatMessagesForLLM(chunks[1])
+	if tokens := EstimateTokens(formatted); tokens > 500 || !strings.HasPrefix(formatted, "user_1: @user_2 long") || !strings.HasSuffix(formatted, "…\n") {
+		t.Errorf("Expected the message trimmed to 500 tokens, got %d tokens: %.40q", tokens, formatted)
+	}
+	if long.Mentions == nil || len(long.Text) < 10000 {
+		t.Error("Expected the original message to be left alone")
+	}
+}
+
+func TestClient_SummarizeLongConversation(t *testing.T) {
+	backend := &chunkBackend{}
+	client := &Client{backend: backend, cfg: &config.Config{AIProvider: "openai", AIContextTokens: "3000"}}
+
+	summary, err := client.Summarize(context.Background(), longConversation(200))
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if !strings.Contains(summary, "Merged by User 1") {
+		t.Errorf("Expected the merged summary with names substituted, got %q", summary)
+	}
+
+	chunks := 0
+	for _, prompt := range backend.prompts {
+		if tokens := EstimateTokens(prompt); tokens > 3000-responseTokens {
+			t.Errorf("Expected prompts to fit in the context, got %d tokens", tokens)
+		}
+		if strings.HasPrefix(prompt, "This is part ") {
+			chunks++
+		}
+	}
+	if chunks < 2 || len(backend.prompts) <= chunks {
+		t.Fatalf("Expected several chunks and a merge, got %d prompts for %d chunks", len(backend.prompts), chunks)
+	}
+	last := backend.prompts[len(backend.prompts)-1]
+	if !strings.HasPrefix(last, "The following are summaries") || !strings.Contains(last, fmt.Sprintf("### Part %d\n", chunks)) {
+		t.Errorf("Expected the summaries of all chunks to be merged last, got %.200q", last)
+	}
+
+	// A conversation that fits is summarized in one call
+	backend.prompts = nil
+	if _, err := client.Summarize(context.Background(), longConversation(5)); err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if len(backend.prompts) != 1 || !strings.HasPrefix(backend.prompts[0], "Please provide a concise summary") {
+		t.Errorf("Expected one call with the summarization prompt, got %d", len(backend.prompts))
+	}
+
+	// A failed chunk fails the summary
+	backend.fail = "message 0150"
+	if _, err := client.Summarize(context.Background(), longConversation(200)); err == nil {
+		t.Error("Expected the failed chunk to fail the summary")
+	}
+}
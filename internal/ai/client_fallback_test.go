@@ -0,0 +1,157 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"summarizarr/internal/config"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyBackend counts its calls and fails while err is set
+type flakyBackend struct {
+	mu    sync.Mutex
+	calls int
+	err   error
+}
+
+func (b *flakyBackend) Summarize(ctx context.Context, prompt string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls++
+	if b.err != nil {
+		return "", b.err
+	}
+	return "## Key topics discussed\n- Plans", nil
+}
+
+func newFallbackClient(db DB, openai, groq AIClient) *Client {
+	return &Client{
+		backend:   openai,
+		providers: map[string]AIClient{"groq": groq},
+		db:        db,
+		cfg: &config.Config{
+			AIProvider:  "openai",
+			AIProviders: []string{"openai", "groq"},
+			OpenAIModel: "gpt-4o-mini",
+			GroqModel:   "llama3-8b-8192",
+		},
+	}
+}
+
+func TestClient_FallsBackToNextProvider(t *testing.T) {
+	db := &costDB{}
+	openai := &flakyBackend{err: errors.New("503 Service Unavailable")}
+	groq := &flakyBackend{}
+	client := newFallbackClient(db, openai, groq)
+	ctx := context.Background()
+
+	result, err := client.SummarizeWithResult(ctx, longConversation(1), SummarizeOptions{GroupID: 1})
+	if err != nil {
+		t.Fatalf("SummarizeWithResult failed: %v", err)
+	}
+	if result.Provider != "groq" || result.Model != "llama3-8b-8192" || !strings.Contains(result.Text, "Plans") {
+		t.Errorf("Expected the summary of groq, got %+v", result)
+	}
+	if len(db.calls) != 2 || db.calls[0].Provider != "openai" || db.calls[0].Error == "" ||
+		db.calls[1].Provider != "groq" || db.calls[1].Error != "" {
+		t.Errorf("Expected the failed and the successful call, got %+v", db.calls)
+	}
+
+	// The circuit opens after the threshold and openai is skipped
+	for i := 1; i < breakerThreshold+2; i++ {
+		if _, err := client.SummarizeWithResult(ctx, longConversation(1), SummarizeOptions{}); err != nil {
+			t.Fatalf("SummarizeWithResult failed: %v", err)
+		}
+	}
+	if openai.calls != breakerThreshold {
+		t.Errorf("Expected openai to be skipped once the circuit opened, got %d calls", openai.calls)
+	}
+	health := client.ProviderHealth()
+	if len(health) != 2 || health[0].Provider != "openai" || health[0].State != CircuitOpen || health[0].RetryAt == nil ||
+		health[0].LastError != "503 Service Unavailable" || health[1].State != CircuitClosed {
+		t.Errorf("Unexpected health: %+v", health)
+	}
+
+	// After the cooldown one call probes openai, a failure doubles the cooldown
+	breaker := client.breaker("openai")
+	later := time.Now().Add(breakerCooldown + time.Second)
+	breaker.now = func() time.Time { return later }
+	if result, _ := client.SummarizeWithResult(ctx, longConversation(1), SummarizeOptions{}); result.Provider != "groq" || openai.calls != breakerThreshold+1 {
+		t.Errorf("Expected a failed probe, got %+v after %d calls", result, openai.calls)
+	}
+	later = later.Add(breakerCooldown + time.Second)
+	if client.SummarizeWithResult(ctx, longConversation(1), SummarizeOptions{}); openai.calls != breakerThreshold+1 {
+		t.Errorf("Expected openai to be skipped for twice the cooldown, got %d calls", openai.calls)
+	}
+
+	// A successful probe closes the circuit
+	openai.err = nil
+	later = later.Add(breakerCooldown)
+	if result, err := client.SummarizeWithResult(ctx, longConversation(1), SummarizeOptions{}); err != nil || result.Provider != "openai" {
+		t.Errorf("Expected openai to recover, got %+v %v", result, err)
+	}
+	if health := client.ProviderHealth(); health[0].State != CircuitClosed || health[0].ConsecutiveFailures != 0 {
+		t.Errorf("Expected the circuit to close, got %+v", health[0])
+	}
+}
+
+func TestClient_FallbackErrors(t *testing.T) {
+	openai := &flakyBackend{err: errors.New("503 Service Unavailable")}
+	groq := &flakyBackend{err: errors.New("429 Too Many Requests")}
+	client := newFallbackClient(nil, openai, groq)
+	ctx := context.Background()
+
+	for i := 0; i < breakerThreshold+1; i++ {
+		_, err := client.SummarizeWithResult(ctx, longConversation(1), SummarizeOptions{})
+		if err == nil || !strings.Contains(err.Error(), "all AI providers failed") {
+			t.Fatalf("Expected every provider to fail, got %v", err)
+		}
+	}
+	// The last provider is tried even with an open circuit
+	if openai.calls != breakerThreshold || groq.calls != breakerThreshold+1 {
+		t.Errorf("Expected groq to be tried every time, got %d and %d calls", openai.calls, groq.calls)
+	}
+
+	// A provider asked for explicitly is tried alone and fails with its error
+	_, err := client.SummarizeWithResult(ctx, longConversation(1), SummarizeOptions{Provider: "groq"})
+	if err == nil || err.Error() != "429 Too Many Requests" || openai.calls != breakerThreshold {
+		t.Errorf("Expected the error of groq alone, got %v", err)
+	}
+}
+
+func TestClient_FallbackSkipsProvidersOverBudget(t *testing.T) {
+	db := &costDB{spent: 5}
+	openai := &flakyBackend{}
+	local := &flakyBackend{}
+	client := &Client{
+		backend:   openai,
+		providers: map[string]AIClient{"local": local},
+		db:        db,
+		cfg:       &config.Config{AIProvider: "openai", AIProviders: []string{"openai", "local"}},
+		budget:    1,
+	}
+
+	if err := client.CheckBudget(""); err != nil {
+		t.Errorf("Expected the chain to pass with local in it, got %v", err)
+	}
+	result, err := client.SummarizeWithResult(context.Background(), longConversation(1), SummarizeOptions{})
+	if err != nil || result.Provider != "local" || openai.calls != 0 {
+		t.Errorf("Expected local to summarize over the budget, got %+v %v", result, err)
+	}
+	// Over the budget is not an outage
+	if health := client.ProviderHealth(); health[0].State != CircuitClosed {
+		t.Errorf("Expected the circuit of openai to stay closed, got %+v", health[0])
+	}
+
+	client.cfg.AIProviders = []string{"openai", "groq"}
+	client.providers["groq"] = &flakyBackend{}
+	if err := client.CheckBudget(""); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded, got %v", err)
+	}
+	if _, err := client.SummarizeWithResult(context.Background(), longConversation(1), SummarizeOptions{}); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded with every provider over the budget, got %v", err)
+	}
+}
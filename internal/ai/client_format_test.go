@@ -0,0 +1,105 @@
+package ai
+
+import (
+	"summarizarr/internal/database"
+	"testing"
+)
+
+func TestFormatMessagesForLLM_Attachments(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []database.MessageForSummary
+		expected string
+	}{
+		{
+			name: "media-only message",
+			messages: []database.MessageForSummary{
+				{UserID: 3, Attachments: []database.AttachmentForSummary{{ContentType: "image/jpeg", Caption: "the new office"}}},
+			},
+			expected: "user_3 shared an image (caption: the new office)\n",
+		},
+		{
+			name: "text with attachments",
+			messages: []database.MessageForSummary{
+				{UserID: 1, Text: "Agenda attached", Attachments: []database.AttachmentForSummary{
+					{ContentType: "application/pdf", Filename: "agenda.pdf"},
+					{ContentType: "audio/aac", VoiceNote: true},
+				}},
+			},
+			expected: "user_1: Agenda attached\nuser_1 shared a file (agenda.pdf)\nuser_1 shared a voice note\n",
+		},
+		{
+			name: "reply to media-only message",
+			messages: []database.MessageForSummary{
+				{UserID: 2, MessageType: "quote", Text: "Looks great", Attachments: []database.AttachmentForSummary{
+					{ContentType: "video/mp4", IsQuote: true},
+				}},
+			},
+			expected: "user_2 (replying to: \"a video\"): Looks great\n",
+		},
+		{
+			name: "mentions are anonymized",
+			messages: []database.MessageForSummary{
+				{UserID: 1, Text: "\ufffc and \ufffc please review", Mentions: []database.MentionForSummary{
+					{UserID: 7, Start: 0, Length: 1},
+					{UserID: 9, Start: 6, Length: 1},
+				}},
+			},
+			expected: "user_1: @user_7 and @user_9 please review\n",
+		},
+		{
+			name: "mention offsets count UTF-16 units",
+			messages: []database.MessageForSummary{
+				{UserID: 2, Text: "🎉 \ufffc congrats", Mentions: []database.MentionForSummary{{UserID: 5, Start: 3, Length: 1}}},
+			},
+			expected: "user_2: 🎉 @user_5 congrats\n",
+		},
+		{
+			name: "out of range mention is ignored",
+			messages: []database.MessageForSummary{
+				{UserID: 2, Text: "hi", Mentions: []database.MentionForSummary{{UserID: 5, Start: 10, Length: 1}}},
+			},
+			expected: "user_2: hi\n",
+		},
+		{
+			name: "group events become system lines",
+			messages: []database.MessageForSummary{
+				{UserID: 4, MessageType: database.MessageTypeGroupEvent, EventType: database.GroupEventMemberJoined},
+				{UserID: 4, Text: "hello everyone"},
+				{UserID: 2, MessageType: database.MessageTypeGroupEvent, EventType: database.GroupEventRenamed, Text: "Book Club"},
+				{UserID: 5, MessageType: database.MessageTypeGroupEvent, EventType: database.GroupEventMemberLeft},
+				{MessageType: database.MessageTypeGroupEvent, EventType: database.GroupEventUpdated},
+			},
+			expected: "user_4 joined the group\nuser_4: hello everyone\nuser_2 renamed the group to \"Book Club\"\nuser_5 left the group\nsomeone updated the group settings\n",
+		},
+		{
+			name: "reactions are aggregated per message",
+			messages: []database.MessageForSummary{
+				{UserID: 2, Text: "Dinner at 8?", Reactions: []database.ReactionCount{{Emoji: "👍", Count: 4}, {Emoji: "❤️", Count: 2}}},
+				{UserID: 3, Attachments: []database.AttachmentForSummary{{ContentType: "image/jpeg"}}, Reactions: []database.ReactionCount{{Emoji: "😂", Count: 1}}},
+				{UserID: 1, MessageType: database.MessageTypeEarlierMessage, Text: "This announcement is long enough that it has to be cut short in the prompt", Reactions: []database.ReactionCount{{Emoji: "🎉", Count: 3}}},
+			},
+			expected: "user_2: Dinner at 8?\n" +
+				"message from user_2 \"Dinner at 8?\" got 👍x4 ❤️x2\n" +
+				"user_3 shared an image\n" +
+				"message from user_3 (an image) got 😂x1\n" +
+				"message from user_1 \"This announcement is long enough that it has to be cut shor…\" got 🎉x3\n",
+		},
+		{
+			name: "image filenames are not leaked",
+			messages: []database.MessageForSummary{
+				{UserID: 4, Attachments: []database.AttachmentForSummary{{ContentType: "image/png", Filename: "Screenshot from Bob's phone.png"}}},
+			},
+			expected: "user_4 shared an image\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := FormatMessagesForLLM(tt.messages)
+			if result != tt.expected {
+				t.Errorf("FormatMessagesForLLM() = %q, expected %q", result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"math"
+	"summarizarr/internal/config"
+	"summarizarr/internal/database"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParsePrices(t *testing.T) {
+	prices, err := ParsePrices("gpt-4o-mini=1/2, My-Model = 0.5/0")
+	if err != nil {
+		t.Fatalf("ParsePrices failed: %v", err)
+	}
+	tests := []struct {
+		model    string
+		expected float64
+	}{
+		// Overridden, and the longer prefix beats gpt-4o
+		{"gpt-4o-mini-2024-07-18", 1 + 2*0.5},
+		{"gpt-4o", 2.50 + 10*0.5},
+		{"models/my-model-v2", 0.5},
+		{"llama3.2:1b", 0},
+	}
+	for _, tt := range tests {
+		if cost := prices.Cost(tt.model, 1_000_000, 500_000); math.Abs(cost-tt.expected) > 1e-9 {
+			t.Errorf("Cost(%q) = %v, expected %v", tt.model, cost, tt.expected)
+		}
+	}
+
+	for _, invalid := range []string{"gpt-4o", "gpt-4o=1", "=1/2", "gpt-4o=x/1", "gpt-4o=1/-2"} {
+		if _, err := ParsePrices(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestBudgetPeriodStart(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	got := BudgetPeriodStart(time.Date(2024, 3, 1, 0, 30, 0, 0, berlin))
+	if want := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Expected the UTC month, got %s", got)
+	}
+}
+
+// costDB records calls to providers and reports what they cost
+type costDB struct {
+	MockDB
+	mu    sync.Mutex
+	calls []database.LLMCall
+	spent float64
+}
+
+func (d *costDB) RecordLLMCall(call database.LLMCall) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls = append(d.calls, call)
+	d.spent += call.Cost
+	return nil
+}
+
+func (d *costDB) LLMCostSince(since int64) (float64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.spent, nil
+}
+
+func TestClient_RecordsCallsAndEnforcesBudget(t *testing.T) {
+	db := &costDB{}
+	prices, _ := ParsePrices("")
+	client := &Client{
+		backend: &usageBackend{},
+		db:      db,
+		cfg:     &config.Config{AIProvider: "openai", OpenAIModel: "gpt-4o-mini", LocalModel: "llama3.2:1b", OllamaHost: "localhost:11434"},
+		prices:  prices,
+		budget:  0.0003,
+	}
+
+	opts := SummarizeOptions{GroupID: 3, JobID: 9}
+	if _, _, err := client.SummarizeWithUsage(context.Background(), longConversation(1), opts); err != nil {
+		t.Fatalf("SummarizeWithUsage failed: %v", err)
+	}
+	if len(db.calls) != 1 {
+		t.Fatalf("Expected one recorded call, got %d", len(db.calls))
+	}
+	call := db.calls[0]
+	if call.GroupID != 3 || call.JobID != 9 || call.Provider != "openai" || call.Model != "gpt-4o-mini" ||
+		call.PromptTokens != 1000 || call.CompletionTokens != 50 || math.Abs(call.Cost-0.00018) > 1e-9 || call.Error != "" {
+		t.Errorf("Unexpected call: %+v", call)
+	}
+
+	// The first call used up most of the budget, the second all of it
+	if _, _, err := client.SummarizeWithUsage(context.Background(), longConversation(1), opts); err != nil {
+		t.Fatalf("SummarizeWithUsage failed: %v", err)
+	}
+	if _, _, err := client.SummarizeWithUsage(context.Background(), longConversation(1), opts); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("Expected ErrBudgetExceeded, got %v", err)
+	}
+	if len(db.calls) != 2 {
+		t.Errorf("Expected no call over the budget, got %d calls", len(db.calls))
+	}
+	// Local models are not paused
+	if err := client.CheckBudget("local"); err != nil {
+		t.Errorf("Expected local models to run over the budget, got %v", err)
+	}
+
+	// Failed calls are recorded without tokens
+	client.budget = 0
+	client.backend = &MockAIClient{shouldError: true, errorMsg: "rate limited"}
+	if _, _, err := client.SummarizeWithUsage(context.Background(), longConversation(1), opts); err == nil {
+		t.Fatal("Expected the call to fail")
+	}
+	if call := db.calls[len(db.calls)-1]; call.Error != "mock error: rate limited" || call.PromptTokens != 0 || call.Cost != 0 {
+		t.Errorf("Expected the failed call, got %+v", call)
+	}
+}
@@ -3,6 +3,7 @@ package ai
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -683,3 +684,33 @@ func TestProviderSpecificFeatures(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_ProviderOverride(t *testing.T) {
+	cfg := &config.Config{
+		AIProvider: "local",
+		OllamaHost: "http://localhost:11434",
+		LocalModel: "llama3",
+		GroqAPIKey: "gsk-test",
+		GroqModel:  "llama-3.1-8b-instant",
+	}
+	client, err := NewClient(cfg, &MockDB{})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	for _, provider := range []string{"", "local", "groq"} {
+		if err := client.ValidateProvider(provider); err != nil {
+			t.Errorf("Expected %q to be available, got %v", provider, err)
+		}
+	}
+	groq, _ := client.backendFor("groq")
+	if cached, _ := client.backendFor("groq"); cached != groq || groq == client.backend {
+		t.Error("Expected one separate backend for groq")
+	}
+	// Providers without credentials and unknown ones are rejected
+	for _, provider := range []string{"openai", "mistral"} {
+		if err := client.ValidateProvider(provider); !errors.Is(err, ErrProviderUnavailable) {
+			t.Errorf("Expected %q to be unavailable, got %v", provider, err)
+		}
+	}
+}
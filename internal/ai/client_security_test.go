@@ -30,13 +30,98 @@ func (m *MockDB) GetGroups() ([]int64, error) {
 	return nil, nil
 }
 
-func (m *MockDB) SaveSummary(groupID int64, summaryText string, start, end int64) error {
+func (m *MockDB) SaveSummary(groupID int64, summaryText string, start, end int64) (int64, error) {
+	if m.shouldError {
+		return 0, fmt.Errorf("mock error: %s", m.errorMsg)
+	}
+	return 1, nil
+}
+
+func (m *MockDB) GetGroupSchedule(groupID int64) (database.GroupSchedule, error) {
+	if m.shouldError {
+		return database.GroupSchedule{}, fmt.Errorf("mock error: %s", m.errorMsg)
+	}
+	return database.GroupSchedule{GroupID: groupID}, nil
+}
+
+func (m *MockDB) EnqueueSummaryJob(groupID, start, end int64, deliver bool) (bool, error) {
+	if m.shouldError {
+		return false, fmt.Errorf("mock error: %s", m.errorMsg)
+	}
+	return true, nil
+}
+
+func (m *MockDB) EnqueueSummaryRequest(req database.SummaryRequest) (int64, error) {
+	if m.shouldError {
+		return 0, fmt.Errorf("mock error: %s", m.errorMsg)
+	}
+	return 1, nil
+}
+
+func (m *MockDB) ClaimSummaryJob(now int64) (*database.SummaryJob, error) {
+	if m.shouldError {
+		return nil, fmt.Errorf("mock error: %s", m.errorMsg)
+	}
+	return nil, nil
+}
+
+func (m *MockDB) CompleteSummaryJob(jobID int64, result database.SummaryResult) (int64, error) {
+	if m.shouldError {
+		return 0, fmt.Errorf("mock error: %s", m.errorMsg)
+	}
+	return 1, nil
+}
+
+func (m *MockDB) RecordLLMCall(call database.LLMCall) error {
+	return nil
+}
+
+func (m *MockDB) LLMCostSince(since int64) (float64, error) {
+	return 0, nil
+}
+
+func (m *MockDB) RollSummaryJob(jobID int64) error {
+	if m.shouldError {
+		return fmt.Errorf("mock error: %s", m.errorMsg)
+	}
+	return nil
+}
+
+func (m *MockDB) DeferSummaryJob(jobID int64, runAfter int64) error {
+	if m.shouldError {
+		return fmt.Errorf("mock error: %s", m.errorMsg)
+	}
+	return nil
+}
+
+func (m *MockDB) RetrySummaryJob(jobID int64, lastError string, runAfter int64) error {
 	if m.shouldError {
 		return fmt.Errorf("mock error: %s", m.errorMsg)
 	}
 	return nil
 }
 
+func (m *MockDB) FailSummaryJob(jobID int64, lastError string) error {
+	if m.shouldError {
+		return fmt.Errorf("mock error: %s", m.errorMsg)
+	}
+	return nil
+}
+
+func (m *MockDB) ResetRunningSummaryJobs() (int64, error) {
+	if m.shouldError {
+		return 0, fmt.Errorf("mock error: %s", m.errorMsg)
+	}
+	return 0, nil
+}
+
+func (m *MockDB) PruneSummaryJobs(before int64) (int64, error) {
+	if m.shouldError {
+		return 0, fmt.Errorf("mock error: %s", m.errorMsg)
+	}
+	return 0, nil
+}
+
 func (m *MockDB) GetUserNameByID(userID int64) (string, error) {
 	if m.shouldError {
 		return "", fmt.Errorf("mock error: %s", m.errorMsg)
@@ -286,6 +371,21 @@ func TestSubstituteUserNames_ErrorHandling(t *testing.T) {
 			expected:    "Alice and User 456 were chatting",
 			expectError: false,
 		},
+		{
+			name: "mentioned user who did not write",
+			mockDB: &MockDB{
+				users: map[int64]string{
+					123: "Alice",
+					456: "Bob",
+				},
+			},
+			summary: "user_123 asked @user_456 to book the venue",
+			messages: []database.MessageForSummary{
+				{UserID: 123, Text: "\ufffc can you book it?", Mentions: []database.MentionForSummary{{UserID: 456, Start: 0, Length: 1}}},
+			},
+			expected:    "Alice asked @Bob to book the venue",
+			expectError: false,
+		},
 		{
 			name: "no user placeholders",
 			mockDB: &MockDB{
@@ -0,0 +1,98 @@
+package ai
+
+import (
+	"context"
+	"strings"
+	"summarizarr/internal/config"
+	"sync"
+	"testing"
+)
+
+func TestContextTokens(t *testing.T) {
+	tests := []struct {
+		provider, model string
+		expected        int
+	}{
+		{"openai", "gpt-4o-mini", 128_000},
+		{"openai", "gpt-4.1-nano", 1_047_576},
+		{"openai", "GPT-4", 8192},
+		{"groq", "llama3-8b-8192", 8192},
+		{"groq", "llama-3.1-8b-instant", 131_072},
+		{"gemini", "models/gemini-2.5-flash", 1_048_576},
+		{"claude", "claude-3-5-haiku-latest", 200_000},
+		// Unknown models get the size of their provider
+		{"openai", "my-finetune", 128_000},
+		{"local", "llama3.1:8b", localContextTokens},
+		{"mistral", "", defaultContextTokens},
+	}
+	for _, tt := range tests {
+		if n := ContextTokens(tt.provider, tt.model); n != tt.expected {
+			t.Errorf("ContextTokens(%q, %q) = %d, expected %d", tt.provider, tt.model, n, tt.expected)
+		}
+	}
+}
+
+func TestClient_ContextTokens(t *testing.T) {
+	if n := (&Client{}).contextTokens(""); n != defaultContextTokens {
+		t.Errorf("Expected the default context without configuration, got %d", n)
+	}
+	client := &Client{cfg: &config.Config{AIProvider: "local", LocalModel: "llama3.2:1b", ClaudeModel: "claude-3-5-haiku-latest"}}
+	if n := client.contextTokens(""); n != localContextTokens {
+		t.Errorf("Expected the Ollama context, got %d", n)
+	}
+	if n := client.contextTokens("claude"); n != 200_000 {
+		t.Errorf("Expected the context of the requested provider, got %d", n)
+	}
+	client.cfg.LocalContextTokens = "16384"
+	if n := client.contextTokens(""); n != 16384 {
+		t.Errorf("Expected LOCAL_CONTEXT_TOKENS for Ollama, got %d", n)
+	}
+	client.cfg.AIContextTokens = "32768"
+	if n := client.contextTokens("local"); n != 32768 {
+		t.Errorf("Expected AI_CONTEXT_TOKENS to override the configured provider, got %d", n)
+	}
+	if n := client.contextTokens("claude"); n != 200_000 {
+		t.Errorf("Expected AI_CONTEXT_TOKENS to leave other providers alone, got %d", n)
+	}
+}
+
+// usageBackend reports the tokens of every call
+type usageBackend struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (b *usageBackend) Summarize(ctx context.Context, prompt string) (string, error) {
+	return "", nil
+}
+
+func (b *usageBackend) SummarizeWithUsage(ctx context.Context, prompt string) (string, int, int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls++
+	return "## Key topics discussed\n- Plans", 1000, 50, nil
+}
+
+func TestClient_SummarizeWithUsage(t *testing.T) {
+	backend := &usageBackend{}
+	client := &Client{backend: backend, cfg: &config.Config{AIProvider: "openai", AIContextTokens: "3000"}}
+
+	// Reported counts are summed over the chunks and the merge
+	_, usage, err := client.SummarizeWithUsage(context.Background(), longConversation(200), SummarizeOptions{})
+	if err != nil {
+		t.Fatalf("SummarizeWithUsage failed: %v", err)
+	}
+	if backend.calls < 3 || usage != (Usage{PromptTokens: 1000 * backend.calls, CompletionTokens: 50 * backend.calls}) {
+		t.Errorf("Expected the usage of %d calls, got %+v", backend.calls, usage)
+	}
+
+	// Backends that do not report usage are estimated
+	client.backend = &MockAIClient{response: strings.Repeat("x", 400)}
+	_, usage, err = client.SummarizeWithUsage(context.Background(), longConversation(1), SummarizeOptions{})
+	if err != nil {
+		t.Fatalf("SummarizeWithUsage failed: %v", err)
+	}
+	if usage.PromptTokens < EstimateTokens(SummarizationPrompt) || usage.CompletionTokens != 100 {
+		t.Errorf("Expected estimated usage, got %+v", usage)
+	}
+}
@@ -0,0 +1,127 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"summarizarr/internal/database"
+)
+
+// ErrCircuitOpen is returned for a provider that is skipped because its last
+// calls failed.
+var ErrCircuitOpen = errors.New("AI provider circuit open")
+
+// Result is a summary and the provider that generated it.
+type Result struct {
+	Text     string
+	Provider string
+	Model    string
+	Usage
+}
+
+// providerChain returns the providers a summary is tried with, in order. A
+// provider asked for explicitly is tried alone.
+func (c *Client) providerChain(provider string) []string {
+	if provider != "" {
+		return []string{provider}
+	}
+	if c.cfg != nil && len(c.cfg.AIProviders) > 0 {
+		return c.cfg.AIProviders
+	}
+	return []string{""}
+}
+
+// breaker returns the circuit breaker of a provider.
+func (c *Client) breaker(provider string) *circuitBreaker {
+	name := c.providerName(provider)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b, ok := c.breakers[name]; ok {
+		return b
+	}
+	if c.breakers == nil {
+		c.breakers = make(map[string]*circuitBreaker)
+	}
+	b := newCircuitBreaker()
+	c.breakers[name] = b
+	return b
+}
+
+// SummarizeWithResult summarizes messages like SummarizeWithOptions, trying
+// the providers of AI_PROVIDER in order until one succeeds. Providers over
+// the budget or with an open circuit are skipped, except for the last one,
+// which is always tried.
+func (c *Client) SummarizeWithResult(ctx context.Context, messages []database.MessageForSummary, opts SummarizeOptions) (Result, error) {
+	chain := c.providerChain(opts.Provider)
+	var failures []string
+	var lastErr error
+	overBudget := true
+	for i, provider := range chain {
+		name := c.providerName(provider)
+		last := i == len(chain)-1
+
+		if err := c.checkBudget(provider); err != nil {
+			lastErr = err
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		overBudget = false
+		breaker := c.breaker(provider)
+		if !breaker.allow() && !last {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, ErrCircuitOpen))
+			continue
+		}
+
+		o := opts
+		o.Provider = provider
+		text, usage, err := c.summarize(ctx, messages, o)
+		if err == nil {
+			breaker.success()
+			if i > 0 {
+				slog.Info("Summary generated by fallback AI provider", "provider", name, "group_id", opts.GroupID)
+			}
+			result := Result{Text: text, Provider: name, Usage: usage}
+			if c.cfg != nil {
+				result.Model = providerModel(c.cfg, name)
+			}
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return Result{}, err
+		}
+		// A provider without credentials is not down
+		if !errors.Is(err, ErrProviderUnavailable) {
+			breaker.failure(err)
+		}
+		if !last {
+			slog.Warn("AI provider failed, trying the next one", "provider", name, "next", c.providerName(chain[i+1]), "error", err)
+		}
+		lastErr = err
+		failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+	}
+
+	// A single provider fails with its own error, so callers can tell a
+	// budget or configuration problem from an outage
+	if len(chain) == 1 || overBudget {
+		return Result{}, lastErr
+	}
+	return Result{}, fmt.Errorf("all AI providers failed: %s", strings.Join(failures, "; "))
+}
+
+// ProviderHealth returns the circuit state of each provider of the fallback
+// chain.
+func (c *Client) ProviderHealth() []ProviderHealth {
+	chain := c.providerChain("")
+	health := make([]ProviderHealth, 0, len(chain))
+	for _, provider := range chain {
+		h := c.breaker(provider).health()
+		h.Provider = c.providerName(provider)
+		if c.cfg != nil {
+			h.Model = providerModel(c.cfg, h.Provider)
+		}
+		health = append(health, h)
+	}
+	return health
+}
@@ -0,0 +1,98 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrBudgetExceeded is returned instead of calling a cloud provider once the
+// calls of the month cost more than MONTHLY_BUDGET_USD.
+var ErrBudgetExceeded = errors.New("monthly AI budget exceeded")
+
+// Price is the cost in USD of a million prompt and completion tokens.
+type Price struct {
+	Prompt     float64
+	Completion float64
+}
+
+// PriceTable prices models by name prefix. The longest matching prefix wins.
+type PriceTable map[string]Price
+
+// defaultPrices are the list prices of common models when this was written.
+// LLM_PRICES adds to and overrides them.
+var defaultPrices = PriceTable{
+	"gpt-4o-mini":             {0.15, 0.60},
+	"gpt-4o":                  {2.50, 10},
+	"gpt-4.1-nano":            {0.10, 0.40},
+	"gpt-4.1-mini":            {0.40, 1.60},
+	"gpt-4.1":                 {2, 8},
+	"llama3-8b-8192":          {0.05, 0.08},
+	"llama-3.1-8b-instant":    {0.05, 0.08},
+	"llama-3.3-70b-versatile": {0.59, 0.79},
+	"gemini-2.0-flash":        {0.10, 0.40},
+	"gemini-2.5-flash":        {0.30, 2.50},
+	"gemini-2.5-pro":          {1.25, 10},
+	"claude-3-5-haiku":        {0.80, 4},
+	"claude-3-7-sonnet":       {3, 15},
+	"claude-sonnet-4":         {3, 15},
+	"claude-opus-4":           {15, 75},
+}
+
+// ParsePrices reads a price table like
+// "gpt-4o-mini=0.15/0.60,my-model=1/2", in USD per million prompt/completion
+// tokens, on top of the default prices.
+func ParsePrices(s string) (PriceTable, error) {
+	prices := make(PriceTable, len(defaultPrices))
+	for model, price := range defaultPrices {
+		prices[model] = price
+	}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		model, rates, ok := strings.Cut(entry, "=")
+		promptStr, completionStr, ok2 := strings.Cut(rates, "/")
+		model = strings.ToLower(strings.TrimSpace(model))
+		if !ok || !ok2 || model == "" {
+			return nil, fmt.Errorf("invalid price %q, expected model=prompt/completion", entry)
+		}
+		prompt, err := strconv.ParseFloat(strings.TrimSpace(promptStr), 64)
+		if err != nil || prompt < 0 {
+			return nil, fmt.Errorf("invalid prompt price in %q", entry)
+		}
+		completion, err := strconv.ParseFloat(strings.TrimSpace(completionStr), 64)
+		if err != nil || completion < 0 {
+			return nil, fmt.Errorf("invalid completion price in %q", entry)
+		}
+		prices[model] = Price{Prompt: prompt, Completion: completion}
+	}
+	return prices, nil
+}
+
+// Cost returns the cost in USD of a call to a model. Models without a price
+// cost nothing.
+func (t PriceTable) Cost(model string, promptTokens, completionTokens int) float64 {
+	model = strings.ToLower(model)
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	var price Price
+	matched := -1
+	for prefix, p := range t {
+		if len(prefix) > matched && strings.HasPrefix(model, prefix) {
+			price, matched = p, len(prefix)
+		}
+	}
+	return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1_000_000
+}
+
+// BudgetPeriodStart returns the start of the calendar month, in UTC, that
+// the monthly budget of t counts from.
+func BudgetPeriodStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
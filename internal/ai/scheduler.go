@@ -2,39 +2,160 @@ package ai
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"strings"
 	"summarizarr/internal/database"
+	"summarizarr/internal/schedule"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
-// Scheduler is a scheduler for the AI summarization service.
+const (
+	// maxCheckInterval bounds how long a window that is due waits to be
+	// queued.
+	maxCheckInterval = time.Minute
+	// jobPollInterval is how often idle workers look for retries that are due
+	jobPollInterval = 5 * time.Second
+	// maxRetryDelay caps the exponential backoff between attempts
+	maxRetryDelay = time.Hour
+	// jobRetention is how long finished jobs are kept
+	jobRetention = 7 * 24 * time.Hour
+	// maxCarrySpan is how long rolled windows are held back: a window that
+	// would roll them further is summarized despite the minimums
+	maxCarrySpan = 7 * 24 * time.Hour
+)
+
+// Scheduler is a scheduler for the AI summarization service. Each group is
+// summarized in consecutive windows that end at the times of its schedule,
+// starting where the previous window ended, so windows missed while
+// summarizarr was down are caught up on and every message is covered by
+// exactly one summary. Windows with less activity than the group's minimums
+// are rolled into the next window, for up to a week, and no summaries are
+// generated during quiet hours.
+//
+// Windows that are due are queued in the summary_jobs table and processed by
+// a fixed number of workers, so a local model is not sent a request per group
+// at once. Failed windows are retried with exponential backoff.
 type Scheduler struct {
 	db       DB
 	aiClient *Client
 	interval time.Duration
+	schedule schedule.Config
+	delivery SummaryDeliverer
+	now      func() time.Time
+
+	workers     int
+	maxAttempts int
+	retryDelay  time.Duration
+	maxCarry    time.Duration
+	// wake tells an idle worker that a job was queued
+	wake chan struct{}
 }
 
 // DB is the interface for the database.
 type DB interface {
 	GetMessagesForSummarization(groupID int64, start, end int64) ([]database.MessageForSummary, error)
 	GetGroups() ([]int64, error)
-	SaveSummary(groupID int64, summaryText string, start, end int64) error
+	GetGroupSchedule(groupID int64) (database.GroupSchedule, error)
+	EnqueueSummaryJob(groupID, start, end int64, deliver bool) (bool, error)
+	EnqueueSummaryRequest(req database.SummaryRequest) (int64, error)
+	ClaimSummaryJob(now int64) (*database.SummaryJob, error)
+	CompleteSummaryJob(jobID int64, result database.SummaryResult) (int64, error)
+	RollSummaryJob(jobID int64) error
+	DeferSummaryJob(jobID int64, runAfter int64) error
+	RetrySummaryJob(jobID int64, lastError string, runAfter int64) error
+	FailSummaryJob(jobID int64, lastError string) error
+	ResetRunningSummaryJobs() (int64, error)
+	PruneSummaryJobs(before int64) (int64, error)
 	GetUserNameByID(userID int64) (string, error)
 	GetGroupNameByID(groupID int64) (string, error)
+	RecordLLMCall(call database.LLMCall) error
+	LLMCostSince(since int64) (float64, error)
+}
+
+// SummaryDeliverer posts a saved summary back to Signal.
+type SummaryDeliverer interface {
+	DeliverSummary(ctx context.Context, summaryID, groupID int64, summary string) error
+}
+
+// SchedulerOption configures a Scheduler.
+type SchedulerOption func(*Scheduler)
+
+// WithDelivery posts every saved summary through d.
+func WithDelivery(d SummaryDeliverer) SchedulerOption {
+	return func(s *Scheduler) {
+		s.delivery = d
+	}
 }
 
-// NewScheduler creates a new scheduler.
-func NewScheduler(db DB, aiClient *Client, interval time.Duration) *Scheduler {
-	return &Scheduler{
-		db:       db,
-		aiClient: aiClient,
-		interval: interval,
+// WithSchedule sets the schedule of groups without their own, instead of
+// windows of one interval.
+func WithSchedule(config schedule.Config) SchedulerOption {
+	return func(s *Scheduler) {
+		s.schedule = config
 	}
 }
 
-// Start starts the scheduler.
+// WithWorkers sets how many windows are summarized at the same time.
+func WithWorkers(n int) SchedulerOption {
+	return func(s *Scheduler) {
+		s.workers = max(n, 1)
+	}
+}
+
+// WithRetry sets how often a window is attempted, and the delay before the
+// first retry, which doubles with every attempt.
+func WithRetry(maxAttempts int, delay time.Duration) SchedulerOption {
+	return func(s *Scheduler) {
+		s.maxAttempts = max(maxAttempts, 1)
+		s.retryDelay = delay
+	}
+}
+
+// NewScheduler creates a new scheduler. interval is the default schedule.
+func NewScheduler(db DB, aiClient *Client, interval time.Duration, options ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		db:          db,
+		aiClient:    aiClient,
+		interval:    interval,
+		schedule:    schedule.Config{Spec: interval.String()},
+		now:         time.Now,
+		workers:     1,
+		maxAttempts: 5,
+		retryDelay:  time.Minute,
+		maxCarry:    maxCarrySpan,
+		wake:        make(chan struct{}, 1),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// Start queues the windows missed while summarizarr was down, then keeps
+// queueing windows as they end until ctx is done. The workers stop with it.
 func (s *Scheduler) Start(ctx context.Context) {
-	ticker := time.NewTicker(s.interval)
+	if n, err := s.db.ResetRunningSummaryJobs(); err != nil {
+		slog.Error("Error resetting interrupted summary jobs", "error", err)
+	} else if n > 0 {
+		slog.Info("Resuming interrupted summary jobs", "count", n)
+	}
+
+	var wg sync.WaitGroup
+	for range s.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx)
+		}()
+	}
+	defer wg.Wait()
+
+	s.enqueueDue(ctx)
+
+	ticker := time.NewTicker(min(s.interval, maxCheckInterval))
 	defer ticker.Stop()
 
 	for {
@@ -42,13 +163,15 @@ func (s *Scheduler) Start(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			s.runSummarization(ctx)
+			s.enqueueDue(ctx)
 		}
 	}
 }
 
-func (s *Scheduler) runSummarization(ctx context.Context) {
-	slog.Info("Running summarization...")
+// enqueueDue queues the windows of every group that ended since the last
+// check.
+func (s *Scheduler) enqueueDue(ctx context.Context) {
+	slog.Debug("Queueing summarization windows...")
 
 	groups, err := s.db.GetGroups()
 	if err != nil {
@@ -56,41 +179,290 @@ func (s *Scheduler) runSummarization(ctx context.Context) {
 		return
 	}
 
+	queued := 0
 	for _, groupID := range groups {
-		go s.summarizeGroup(ctx, groupID)
+		if ctx.Err() != nil {
+			return
+		}
+		queued += s.enqueueGroup(groupID)
+	}
+	if queued > 0 {
+		s.notify()
+	}
+
+	if _, err := s.db.PruneSummaryJobs(s.now().Add(-jobRetention).UnixMilli()); err != nil {
+		slog.Error("Error pruning summary jobs", "error", err)
 	}
 }
 
-func (s *Scheduler) summarizeGroup(ctx context.Context, groupID int64) {
+// enqueueGroup queues the windows of a group that ended since the last one
+// and returns how many were queued.
+func (s *Scheduler) enqueueGroup(groupID int64) int {
+	now := s.now()
+
+	group, err := s.db.GetGroupSchedule(groupID)
+	if err != nil {
+		slog.Error("Error getting group schedule", "group_id", groupID, "error", err)
+		return 0
+	}
+	sched, err := s.schedule.Override(group.Config()).Parse()
+	if err != nil {
+		slog.Error("Invalid group schedule", "group_id", groupID, "schedule", group.Schedule, "error", err)
+		return 0
+	}
+
 	// Use millisecond timestamps to match message storage format
-	endMs := time.Now().UnixMilli()
-	startMs := time.Now().Add(-s.interval).UnixMilli()
+	until := max(group.SummarizedUntil, group.QueuedUntil)
+	start := time.UnixMilli(until)
+	if until == 0 {
+		// New groups start with the last window that ended
+		end := schedule.Prev(sched, now)
+		if start = schedule.Prev(sched, end.Add(-time.Millisecond)); start.IsZero() {
+			return 0
+		}
+	}
 
-	slog.Debug("Summarizing group", "group_id", groupID, "start_ms", startMs, "end_ms", endMs)
+	queued := 0
+	for end := sched.Next(start); !end.IsZero() && !end.After(now); start, end = end, sched.Next(end) {
+		// Only the latest window is posted, not every window caught up on
+		next := sched.Next(end)
+		latest := next.IsZero() || next.After(now)
+		created, err := s.db.EnqueueSummaryJob(groupID, start.UnixMilli(), end.UnixMilli(), latest)
+		if err != nil {
+			slog.Error("Error queueing summary window", "group_id", groupID, "start", start, "end", end, "error", err)
+			break
+		}
+		if created {
+			queued++
+		}
+	}
+	return queued
+}
 
-	messages, err := s.db.GetMessagesForSummarization(groupID, startMs, endMs)
+// EnqueueSummary queues a summary requested outside the schedule, such as
+// one of a chosen time range or the regeneration of a summary, and returns
+// the job ID. Requested summaries run before scheduled windows.
+func (s *Scheduler) EnqueueSummary(req database.SummaryRequest) (int64, error) {
+	if err := s.aiClient.ValidateProvider(req.Provider); err != nil {
+		return 0, err
+	}
+	if err := s.aiClient.CheckBudget(req.Provider); err != nil {
+		return 0, err
+	}
+	jobID, err := s.db.EnqueueSummaryRequest(req)
 	if err != nil {
-		slog.Error("Error getting messages for summarization", "group_id", groupID, "error", err)
+		return 0, err
+	}
+	s.notify()
+	return jobID, nil
+}
+
+// notify wakes an idle worker.
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// work runs queued jobs until ctx is done.
+func (s *Scheduler) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := s.db.ClaimSummaryJob(s.now().UnixMilli())
+		if err != nil {
+			slog.Error("Error claiming summary job", "error", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-s.wake:
+			case <-time.After(jobPollInterval):
+			}
+			continue
+		}
+		// Another job may be due for another worker
+		s.notify()
+		s.runJob(ctx, job)
+	}
+}
+
+// runJob summarizes the window of a job and records the outcome.
+func (s *Scheduler) runJob(ctx context.Context, job *database.SummaryJob) {
+	err := s.summarizeWindow(ctx, job)
+	if err == nil {
+		return
+	}
+	if ctx.Err() != nil {
+		// The job is queued again on the next start
 		return
 	}
 
-	if len(messages) == 0 {
-		slog.Debug("No messages found for summarization", "group_id", groupID)
+	// Summaries wait for the budget of the next month
+	if errors.Is(err, ErrBudgetExceeded) {
+		next := BudgetPeriodStart(s.now()).AddDate(0, 1, 0)
+		slog.Warn("Pausing summary until the monthly budget resets", "group_id", job.GroupID, "job_id", job.ID, "until", next, "error", err)
+		if err := s.db.DeferSummaryJob(job.ID, next.UnixMilli()); err != nil {
+			slog.Error("Error deferring summary job", "job_id", job.ID, "error", err)
+		}
 		return
 	}
 
-	slog.Info("Generating summary", "group_id", groupID, "message_count", len(messages))
+	// Retrying does not help when there is nothing to summarize or the
+	// requested provider is not configured
+	if job.Attempts >= s.maxAttempts || errors.Is(err, errNoMessages) || errors.Is(err, ErrProviderUnavailable) {
+		slog.Error("Giving up on summary window", "group_id", job.GroupID, "job_id", job.ID,
+			"start_ms", job.Start, "end_ms", job.End, "attempts", job.Attempts, "error", err)
+		if err := s.db.FailSummaryJob(job.ID, err.Error()); err != nil {
+			slog.Error("Error recording failed summary job", "job_id", job.ID, "error", err)
+		}
+		return
+	}
+
+	delay := s.backoff(job.Attempts)
+	slog.Warn("Summary window failed, retrying", "group_id", job.GroupID, "job_id", job.ID,
+		"attempt", job.Attempts, "retry_in", delay, "error", err)
+	if err := s.db.RetrySummaryJob(job.ID, err.Error(), s.now().Add(delay).UnixMilli()); err != nil {
+		slog.Error("Error rescheduling summary job", "job_id", job.ID, "error", err)
+	}
+}
+
+// backoff returns the delay after the given number of failed attempts.
+func (s *Scheduler) backoff(attempts int) time.Duration {
+	delay := s.retryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// deferQuietHours queues a job again at the end of the quiet hours it is in.
+func (s *Scheduler) deferQuietHours(job *database.SummaryJob, config schedule.Config) (bool, error) {
+	quiet, err := config.Quiet()
+	if err != nil || quiet == nil {
+		return false, err
+	}
+	until := quiet.Until(s.now())
+	if until.IsZero() {
+		return false, nil
+	}
+	slog.Debug("Deferring summary to the end of quiet hours", "group_id", job.GroupID, "job_id", job.ID, "until", until)
+	return true, s.db.DeferSummaryJob(job.ID, until.UnixMilli())
+}
+
+// belowMinimums describes which of the configured minimums the messages of
+// a window fall short of, or returns "" if none. Reactions, group events
+// and earlier messages do not count.
+func belowMinimums(messages []database.MessageForSummary, config schedule.Config) string {
+	minMessages, minParticipants, minChars := config.Minimums()
+	count, chars := 0, 0
+	participants := make(map[int64]struct{})
+	for _, msg := range messages {
+		switch msg.MessageType {
+		case database.MessageTypeEarlierMessage, database.MessageTypeGroupEvent, "reaction":
+			continue
+		}
+		count++
+		chars += utf8.RuneCountInString(strings.TrimSpace(msg.Text))
+		if msg.UserID > 0 {
+			participants[msg.UserID] = struct{}{}
+		}
+	}
+
+	var short []string
+	if count < minMessages {
+		short = append(short, "messages")
+	}
+	if len(participants) < minParticipants {
+		short = append(short, "participants")
+	}
+	if chars < minChars {
+		short = append(short, "characters")
+	}
+	if len(short) == 0 {
+		return ""
+	}
+	return "too few " + strings.Join(short, ", ")
+}
+
+// errNoMessages fails requested summaries of time ranges without messages.
+var errNoMessages = errors.New("no messages to summarize")
+
+func (s *Scheduler) summarizeWindow(ctx context.Context, job *database.SummaryJob) error {
+	slog.Debug("Summarizing group", "group_id", job.GroupID, "kind", job.Kind, "start_ms", job.Start, "end_ms", job.End)
 
-	summary, err := s.aiClient.Summarize(ctx, messages)
+	// Requested summaries ignore quiet hours and minimums
+	scheduled := job.Kind == "" || job.Kind == database.JobScheduled
+	start := job.Start
+	var config schedule.Config
+	if scheduled {
+		group, err := s.db.GetGroupSchedule(job.GroupID)
+		if err != nil {
+			return err
+		}
+		config = s.schedule.Override(group.Config())
+		if deferred, err := s.deferQuietHours(job, config); deferred || err != nil {
+			return err
+		}
+		if group.CarryFrom > 0 {
+			start = min(start, group.CarryFrom)
+		}
+	}
+
+	// Windows are half-open; the message query includes both bounds
+	messages, err := s.db.GetMessagesForSummarization(job.GroupID, start, job.End-1)
 	if err != nil {
-		slog.Error("Error summarizing messages", "group_id", groupID, "error", err)
-		return
+		return err
 	}
 
-	if err := s.db.SaveSummary(groupID, summary, startMs, endMs); err != nil {
-		slog.Error("Error saving summary", "group_id", groupID, "error", err)
-		return
+	if len(messages) == 0 {
+		if !scheduled {
+			return errNoMessages
+		}
+		slog.Debug("No messages found for summarization", "group_id", job.GroupID)
+		_, err := s.db.CompleteSummaryJob(job.ID, database.SummaryResult{})
+		return err
 	}
 
-	slog.Info("Saved summary", "group_id", groupID, "summary_length", len(summary))
+	if scheduled {
+		if reason := belowMinimums(messages, config); reason != "" {
+			if time.Duration(job.End-start)*time.Millisecond < s.maxCarry {
+				slog.Info("Rolling window into the next one", "group_id", job.GroupID, "start_ms", start, "end_ms", job.End, "reason", reason)
+				return s.db.RollSummaryJob(job.ID)
+			}
+			slog.Info("Summarizing rolled windows despite minimums", "group_id", job.GroupID, "start_ms", start, "end_ms", job.End, "reason", reason)
+		}
+	}
+
+	slog.Info("Generating summary", "group_id", job.GroupID, "kind", job.Kind, "message_count", len(messages), "attempt", job.Attempts)
+
+	result, err := s.aiClient.SummarizeWithResult(ctx, messages, SummarizeOptions{
+		Provider: job.Provider,
+		Prompt:   job.Prompt,
+		GroupID:  job.GroupID,
+		JobID:    job.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	summary := result.Text
+	summaryID, err := s.db.CompleteSummaryJob(job.ID, database.SummaryResult{
+		Text:             summary,
+		PromptTokens:     result.PromptTokens,
+		CompletionTokens: result.CompletionTokens,
+		Provider:         result.Provider,
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Saved summary", "group_id", job.GroupID, "summary_length", len(summary), "provider", result.Provider,
+		"prompt_tokens", result.PromptTokens, "completion_tokens", result.CompletionTokens)
+
+	if s.delivery != nil && job.Deliver {
+		if err := s.delivery.DeliverSummary(ctx, summaryID, job.GroupID, summary); err != nil {
+			slog.Error("Error delivering summary", "group_id", job.GroupID, "summary_id", summaryID, "error", err)
+		}
+	}
+	return nil
 }
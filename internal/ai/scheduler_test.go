@@ -0,0 +1,561 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"summarizarr/internal/config"
+	"summarizarr/internal/database"
+	"summarizarr/internal/schedule"
+)
+
+// windowDB is an in-memory summary job queue that records the windows the
+// scheduler processes
+type windowDB struct {
+	MockDB
+	mu       sync.Mutex
+	groups   []int64
+	until    map[int64]int64
+	carry    map[int64]int64
+	schedule database.GroupSchedule
+	messages []int64
+	jobs     []*database.SummaryJob
+	windows  [][2]int64
+	saved    []string
+	results  []database.SummaryResult
+	counts   []int
+}
+
+func newWindowDB(until int64, messages ...int64) *windowDB {
+	return &windowDB{groups: []int64{1}, until: map[int64]int64{1: until}, carry: map[int64]int64{}, messages: messages}
+}
+
+func (d *windowDB) GetGroups() ([]int64, error) { return d.groups, nil }
+
+func (d *windowDB) GetMessagesForSummarization(groupID int64, start, end int64) ([]database.MessageForSummary, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var messages []database.MessageForSummary
+	for _, ts := range d.messages {
+		if ts >= start && ts <= end {
+			messages = append(messages, database.MessageForSummary{Timestamp: ts, UserID: 1, Text: "hi"})
+		}
+	}
+	d.counts = append(d.counts, len(messages))
+	return messages, nil
+}
+
+func (d *windowDB) GetGroupSchedule(groupID int64) (database.GroupSchedule, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	group := d.schedule
+	group.GroupID, group.SummarizedUntil, group.CarryFrom = groupID, d.until[groupID], d.carry[groupID]
+	for _, job := range d.jobs {
+		if job.GroupID == groupID && job.Kind == database.JobScheduled {
+			group.QueuedUntil = max(group.QueuedUntil, job.End)
+		}
+	}
+	return group, nil
+}
+
+func (d *windowDB) EnqueueSummaryJob(groupID, start, end int64, deliver bool) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, job := range d.jobs {
+		if job.GroupID == groupID && job.Start == start && job.End == end {
+			return false, nil
+		}
+	}
+	d.jobs = append(d.jobs, &database.SummaryJob{ID: int64(len(d.jobs) + 1), Kind: database.JobScheduled, GroupID: groupID, Start: start, End: end, Deliver: deliver, State: database.JobPending})
+	return true, nil
+}
+
+func (d *windowDB) EnqueueSummaryRequest(req database.SummaryRequest) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	job := &database.SummaryJob{ID: int64(len(d.jobs) + 1), Kind: database.JobManual, GroupID: req.GroupID, Start: req.Start, End: req.End,
+		Provider: req.Provider, Prompt: req.Prompt, State: database.JobPending}
+	d.jobs = append(d.jobs, job)
+	return job.ID, nil
+}
+
+func (d *windowDB) ClaimSummaryJob(now int64) (*database.SummaryJob, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Jobs are queued in window order, and a group's first unfinished job blocks the rest
+	blocked := map[int64]bool{}
+	for _, job := range d.jobs {
+		if job.State != database.JobPending && job.State != database.JobRunning {
+			continue
+		}
+		if job.Kind == database.JobScheduled {
+			if blocked[job.GroupID] {
+				continue
+			}
+			blocked[job.GroupID] = true
+		}
+		if job.State == database.JobPending && job.RunAfter <= now {
+			job.State = database.JobRunning
+			job.Attempts++
+			claimed := *job
+			return &claimed, nil
+		}
+	}
+	return nil, nil
+}
+
+func (d *windowDB) job(jobID int64) *database.SummaryJob {
+	return d.jobs[jobID-1]
+}
+
+func (d *windowDB) CompleteSummaryJob(jobID int64, result database.SummaryResult) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	summaryText := result.Text
+	job := d.job(jobID)
+	job.State = database.JobDone
+	start := job.Start
+	if job.Kind == database.JobScheduled {
+		d.until[job.GroupID] = job.End
+		if carry, ok := d.carry[job.GroupID]; ok && summaryText != "" {
+			start = carry
+			delete(d.carry, job.GroupID)
+		}
+	}
+	d.windows = append(d.windows, [2]int64{start, job.End})
+	d.saved = append(d.saved, summaryText)
+	d.results = append(d.results, result)
+	return int64(len(d.windows)), nil
+}
+
+func (d *windowDB) RollSummaryJob(jobID int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	job := d.job(jobID)
+	job.State = database.JobRolled
+	d.until[job.GroupID] = job.End
+	if _, ok := d.carry[job.GroupID]; !ok {
+		d.carry[job.GroupID] = job.Start
+	}
+	return nil
+}
+
+func (d *windowDB) DeferSummaryJob(jobID int64, runAfter int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	job := d.job(jobID)
+	job.State, job.RunAfter = database.JobPending, runAfter
+	job.Attempts--
+	return nil
+}
+
+func (d *windowDB) RetrySummaryJob(jobID int64, lastError string, runAfter int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	job := d.job(jobID)
+	job.State, job.LastError, job.RunAfter = database.JobPending, lastError, runAfter
+	return nil
+}
+
+func (d *windowDB) FailSummaryJob(jobID int64, lastError string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	job := d.job(jobID)
+	job.State, job.LastError = database.JobFailed, lastError
+	return nil
+}
+
+// drain runs the jobs that are due, as a single worker would
+func drain(s *Scheduler, db *windowDB) {
+	for {
+		job, _ := db.ClaimSummaryJob(s.now().UnixMilli())
+		if job == nil {
+			return
+		}
+		s.runJob(context.Background(), job)
+	}
+}
+
+type countingDeliverer struct{ summaryIDs []int64 }
+
+func (c *countingDeliverer) DeliverSummary(ctx context.Context, summaryID, groupID int64, summary string) error {
+	c.summaryIDs = append(c.summaryIDs, summaryID)
+	return nil
+}
+
+func TestScheduler_CatchesUpOnMissedWindows(t *testing.T) {
+	hour := time.Hour.Milliseconds()
+	db := newWindowDB(10*hour, 10*hour, 11*hour, 12*hour+5)
+	deliverer := &countingDeliverer{}
+	s := NewScheduler(db, &Client{backend: &MockAIClient{response: "summary"}, db: db}, time.Hour, WithDelivery(deliverer))
+	s.now = func() time.Time { return time.UnixMilli(13*hour + 30) }
+
+	if queued := s.enqueueGroup(1); queued != 3 {
+		t.Fatalf("Expected 3 queued windows, got %d", queued)
+	}
+	drain(s, db)
+
+	expected := [][2]int64{{10 * hour, 11 * hour}, {11 * hour, 12 * hour}, {12 * hour, 13 * hour}}
+	if len(db.windows) != len(expected) {
+		t.Fatalf("Expected %d windows, got %v", len(expected), db.windows)
+	}
+	for i, w := range expected {
+		if db.windows[i] != w {
+			t.Errorf("Window %d: expected %v, got %v", i, w, db.windows[i])
+		}
+	}
+	// The message on the boundary belongs to the second window only
+	for i, count := range db.counts {
+		if count != 1 {
+			t.Errorf("Expected window %d to have one message, got %d", i, count)
+		}
+	}
+	if len(deliverer.summaryIDs) != 1 || deliverer.summaryIDs[0] != 3 {
+		t.Errorf("Expected only the latest summary to be delivered, got %v", deliverer.summaryIDs)
+	}
+
+	// Nothing is due until the next window ends
+	if queued := s.enqueueGroup(1); queued != 0 {
+		t.Errorf("Expected no new window, got %d", queued)
+	}
+}
+
+func TestScheduler_RetriesWithBackoff(t *testing.T) {
+	hour := time.Hour.Milliseconds()
+	db := newWindowDB(10*hour, 11*hour, 12*hour)
+	backend := &MockAIClient{shouldError: true, errorMsg: "provider down"}
+	now := time.UnixMilli(13 * hour)
+	s := NewScheduler(db, &Client{backend: backend, db: db}, time.Hour, WithRetry(3, time.Minute))
+	s.now = func() time.Time { return now }
+
+	s.enqueueGroup(1)
+	drain(s, db)
+	// The empty first window is recorded, the failing second one waits for a retry
+	if len(db.windows) != 1 || db.saved[0] != "" || db.until[1] != 11*hour {
+		t.Fatalf("Expected only the empty window to be recorded, got %v", db.windows)
+	}
+	failed := db.job(2)
+	if failed.State != database.JobPending || failed.RunAfter != now.Add(time.Minute).UnixMilli() || failed.LastError == "" {
+		t.Fatalf("Expected a retry in one minute, got %+v", failed)
+	}
+
+	// The delay doubles with every attempt, until the job is given up on
+	now = now.Add(time.Minute)
+	drain(s, db)
+	if failed.Attempts != 2 || failed.RunAfter != now.Add(2*time.Minute).UnixMilli() {
+		t.Fatalf("Expected a retry in two minutes, got %+v", failed)
+	}
+	now = now.Add(2 * time.Minute)
+	drain(s, db)
+	if failed.State != database.JobFailed || failed.Attempts != 3 {
+		t.Fatalf("Expected the job to fail after 3 attempts, got %+v", failed)
+	}
+
+	// Later windows continue without the failed one, after their own first failure
+	if next := db.job(3); next.Attempts != 1 {
+		t.Fatalf("Expected the next window to be attempted, got %+v", next)
+	}
+	backend.shouldError, backend.response = false, "summary"
+	now = now.Add(time.Minute)
+	drain(s, db)
+	if len(db.windows) != 2 || db.windows[1] != [2]int64{12 * hour, 13 * hour} {
+		t.Errorf("Expected the next window to be summarized, got %v", db.windows)
+	}
+}
+
+func TestScheduler_Backoff(t *testing.T) {
+	s := NewScheduler(newWindowDB(0), nil, time.Hour, WithRetry(10, 10*time.Minute))
+	for attempts, expected := range map[int]time.Duration{1: 10 * time.Minute, 2: 20 * time.Minute, 3: 40 * time.Minute, 4: time.Hour, 30: time.Hour} {
+		if delay := s.backoff(attempts); delay != expected {
+			t.Errorf("Attempt %d: expected %s, got %s", attempts, expected, delay)
+		}
+	}
+}
+
+func TestScheduler_NewGroupStartsWithLastWindow(t *testing.T) {
+	db := newWindowDB(0)
+	s := NewScheduler(db, &Client{backend: &MockAIClient{response: "summary"}, db: db}, time.Hour)
+	now := time.UnixMilli(100*time.Hour.Milliseconds() + 90_000)
+	s.now = func() time.Time { return now }
+
+	s.enqueueGroup(1)
+	drain(s, db)
+	hour := now.Truncate(time.Hour)
+	if len(db.windows) != 1 || db.windows[0] != [2]int64{hour.Add(-time.Hour).UnixMilli(), hour.UnixMilli()} {
+		t.Errorf("Expected the last full hour, got %v", db.windows)
+	}
+}
+
+func TestScheduler_GroupSchedules(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	db := newWindowDB(start.UnixMilli())
+	db.schedule.Schedule = "0 8 * * *"
+	s := NewScheduler(db, &Client{backend: &MockAIClient{response: "summary"}, db: db}, time.Hour,
+		WithSchedule(schedule.Config{Spec: "30m", TimeZone: "UTC"}))
+	s.now = func() time.Time { return start.Add(2*day + time.Hour) }
+
+	s.enqueueGroup(1)
+	drain(s, db)
+	// The group's daily schedule replaces the default of 30 minutes
+	expected := [][2]int64{
+		{start.UnixMilli(), start.Add(day).UnixMilli()},
+		{start.Add(day).UnixMilli(), start.Add(2 * day).UnixMilli()},
+	}
+	if len(db.windows) != len(expected) || db.windows[0] != expected[0] || db.windows[1] != expected[1] {
+		t.Errorf("Expected two daily windows, got %v", db.windows)
+	}
+
+	db.schedule.Schedule = "not a schedule"
+	s.now = func() time.Time { return start.Add(4 * day) }
+	if queued := s.enqueueGroup(1); queued != 0 {
+		t.Errorf("Expected an invalid schedule to be skipped, got %d windows", queued)
+	}
+}
+
+func TestScheduler_RollsQuietWindows(t *testing.T) {
+	hour := time.Hour.Milliseconds()
+	db := newWindowDB(10*hour, 10*hour+1, 11*hour+1, 11*hour+2, 12*hour+1)
+	two := 2
+	deliverer := &countingDeliverer{}
+	s := NewScheduler(db, &Client{backend: &MockAIClient{response: "summary"}, db: db}, time.Hour,
+		WithDelivery(deliverer), WithSchedule(schedule.Config{Spec: "1h", MinMessages: &two}))
+	s.now = func() time.Time { return time.UnixMilli(13 * hour) }
+
+	s.enqueueGroup(1)
+	drain(s, db)
+	// The first window has one message and is summarized with the second,
+	// the third is still below the minimum
+	if len(db.windows) != 1 || db.windows[0] != [2]int64{10 * hour, 12 * hour} {
+		t.Fatalf("Expected one summary of the first two windows, got %v", db.windows)
+	}
+	if db.job(1).State != database.JobRolled || db.job(3).State != database.JobRolled || db.carry[1] != 12*hour {
+		t.Errorf("Expected the first and last windows to be rolled, got %+v %+v", db.job(1), db.job(3))
+	}
+	if len(deliverer.summaryIDs) != 0 {
+		t.Errorf("Expected the rolled latest window not to be delivered, got %v", deliverer.summaryIDs)
+	}
+
+	// Groups can lower the global minimum
+	zero := 0
+	db.schedule.MinMessages = &zero
+	s.now = func() time.Time { return time.UnixMilli(14 * hour) }
+	s.enqueueGroup(1)
+	drain(s, db)
+	if len(db.windows) != 2 || db.windows[1] != [2]int64{12 * hour, 14 * hour} {
+		t.Errorf("Expected the rolled window to be summarized with the next one, got %v", db.windows)
+	}
+}
+
+func TestScheduler_CapsRolledWindows(t *testing.T) {
+	hour := time.Hour.Milliseconds()
+	db := newWindowDB(10*hour, 10*hour+1, 11*hour+1, 12*hour+1, 13*hour+1)
+	five := 5
+	s := NewScheduler(db, &Client{backend: &MockAIClient{response: "summary"}, db: db}, time.Hour,
+		WithSchedule(schedule.Config{Spec: "1h", MinMessages: &five}))
+	s.maxCarry = 3 * time.Hour
+	s.now = func() time.Time { return time.UnixMilli(14 * hour) }
+
+	s.enqueueGroup(1)
+	drain(s, db)
+	// The third window would hold the first back for three hours
+	if len(db.windows) != 1 || db.windows[0] != [2]int64{10 * hour, 13 * hour} {
+		t.Fatalf("Expected the rolled windows to be summarized at the cap, got %v", db.windows)
+	}
+	if db.job(4).State != database.JobRolled || db.carry[1] != 13*hour {
+		t.Errorf("Expected the window after the cap to roll again, got %+v", db.job(4))
+	}
+}
+
+func TestScheduler_DefersDuringQuietHours(t *testing.T) {
+	start := time.Date(2024, 3, 1, 22, 0, 0, 0, time.UTC)
+	db := newWindowDB(start.UnixMilli(), start.UnixMilli()+1)
+	db.schedule.QuietHours = "22:30-07:00"
+	s := NewScheduler(db, &Client{backend: &MockAIClient{response: "summary"}, db: db}, time.Hour)
+	now := start.Add(time.Hour)
+	s.now = func() time.Time { return now }
+
+	s.enqueueGroup(1)
+	drain(s, db)
+	job := db.job(1)
+	if len(db.windows) != 0 || job.State != database.JobPending || job.Attempts != 0 {
+		t.Fatalf("Expected the window to wait, got %v %+v", db.windows, job)
+	}
+	if end := time.Date(2024, 3, 2, 7, 0, 0, 0, time.UTC); job.RunAfter != end.UnixMilli() {
+		t.Errorf("Expected the window to wait until 07:00, got %s", time.UnixMilli(job.RunAfter).UTC())
+	}
+
+	// Requested summaries are not held back
+	jobID, _ := s.EnqueueSummary(database.SummaryRequest{GroupID: 1, Start: start.UnixMilli(), End: now.UnixMilli()})
+	drain(s, db)
+	if db.job(jobID).State != database.JobDone {
+		t.Errorf("Expected the requested summary to run, got %+v", db.job(jobID))
+	}
+
+	now = time.Date(2024, 3, 2, 7, 0, 0, 0, time.UTC)
+	drain(s, db)
+	if job.State != database.JobDone || job.Attempts != 1 {
+		t.Errorf("Expected the window to be summarized after quiet hours, got %+v", job)
+	}
+}
+
+func TestScheduler_PausesOverBudget(t *testing.T) {
+	start := time.Date(2024, 3, 14, 10, 0, 0, 0, time.UTC)
+	db := newWindowDB(start.UnixMilli(), start.UnixMilli()+1)
+	client := &Client{
+		backend: &MockAIClient{response: "summary"},
+		db:      &costDB{spent: 25},
+		cfg:     &config.Config{AIProvider: "openai"},
+		budget:  20,
+	}
+	s := NewScheduler(db, client, time.Hour)
+	s.now = func() time.Time { return start.Add(time.Hour) }
+
+	s.enqueueGroup(1)
+	drain(s, db)
+	job := db.job(1)
+	if len(db.windows) != 0 || job.State != database.JobPending || job.Attempts != 0 {
+		t.Fatalf("Expected the window to wait, got %v %+v", db.windows, job)
+	}
+	if next := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC); job.RunAfter != next.UnixMilli() {
+		t.Errorf("Expected the window to wait for the next month, got %s", time.UnixMilli(job.RunAfter).UTC())
+	}
+
+	// Requested summaries are refused right away
+	if _, err := s.EnqueueSummary(database.SummaryRequest{GroupID: 1, Start: start.UnixMilli(), End: start.Add(time.Hour).UnixMilli()}); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded, got %v", err)
+	}
+}
+
+func TestBelowMinimums(t *testing.T) {
+	messages := []database.MessageForSummary{
+		{UserID: 1, Text: "ok 👍"},
+		{UserID: 2, MessageType: "reaction", ReactionEmoji: "👍"},
+		{UserID: 3, MessageType: database.MessageTypeGroupEvent, EventType: database.GroupEventMemberJoined},
+	}
+	one, two, five := 1, 2, 5
+	if reason := belowMinimums(messages, schedule.Config{MinMessages: &one, MinChars: &two}); reason != "" {
+		t.Errorf("Expected the minimums to be met, got %q", reason)
+	}
+	if reason := belowMinimums(messages, schedule.Config{MinMessages: &two, MinParticipants: &two, MinChars: &five}); reason != "too few messages, participants, characters" {
+		t.Errorf("Expected reactions and events not to count, got %q", reason)
+	}
+}
+
+// promptBackend records the prompts it is sent
+type promptBackend struct{ prompts []string }
+
+func (b *promptBackend) Summarize(ctx context.Context, prompt string) (string, error) {
+	b.prompts = append(b.prompts, prompt)
+	return "summary", nil
+}
+
+func TestScheduler_EnqueueSummary(t *testing.T) {
+	hour := time.Hour.Milliseconds()
+	db := newWindowDB(10*hour, 10*hour+1)
+	backend := &promptBackend{}
+	deliverer := &countingDeliverer{}
+	s := NewScheduler(db, &Client{backend: backend, db: db}, time.Hour, WithDelivery(deliverer))
+	s.now = func() time.Time { return time.UnixMilli(20 * hour) }
+
+	if _, err := s.EnqueueSummary(database.SummaryRequest{GroupID: 1, End: hour, Provider: "openai"}); !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("Expected ErrProviderUnavailable, got %v", err)
+	}
+
+	jobID, err := s.EnqueueSummary(database.SummaryRequest{GroupID: 1, Start: 10 * hour, End: 11 * hour, Prompt: "List the jokes."})
+	if err != nil {
+		t.Fatalf("EnqueueSummary failed: %v", err)
+	}
+	drain(s, db)
+	if job := db.job(jobID); job.State != database.JobDone {
+		t.Fatalf("Expected the job to be done, got %+v", job)
+	}
+	if len(backend.prompts) != 1 || !strings.HasPrefix(backend.prompts[0], "List the jokes.\n\nConversation:\nuser_1: hi") {
+		t.Errorf("Expected the custom prompt followed by the conversation, got %q", backend.prompts)
+	}
+	if result := db.results[len(db.results)-1]; result.PromptTokens != EstimateTokens(backend.prompts[0]) || result.CompletionTokens == 0 {
+		t.Errorf("Expected the tokens of the summary to be recorded, got %+v", result)
+	}
+	// Requested summaries are neither posted nor move the schedule
+	if len(deliverer.summaryIDs) != 0 || db.until[1] != 10*hour {
+		t.Errorf("Expected no delivery or progress, got %v %d", deliverer.summaryIDs, db.until[1])
+	}
+
+	// Time ranges without messages fail without retries
+	jobID, _ = s.EnqueueSummary(database.SummaryRequest{GroupID: 1, Start: 12 * hour, End: 13 * hour})
+	drain(s, db)
+	if job := db.job(jobID); job.State != database.JobFailed || job.Attempts != 1 {
+		t.Errorf("Expected the empty range to fail at once, got %+v", job)
+	}
+}
+
+// slowBackend records how many summaries are generated at the same time
+type slowBackend struct {
+	mu           sync.Mutex
+	active, peak int
+	calls        int
+	delay        time.Duration
+}
+
+func (b *slowBackend) Summarize(ctx context.Context, prompt string) (string, error) {
+	b.mu.Lock()
+	b.active++
+	b.calls++
+	b.peak = max(b.peak, b.active)
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.active--
+		b.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(b.delay):
+		return "summary", nil
+	case <-ctx.Done():
+		return "", errors.New("canceled")
+	}
+}
+
+func TestScheduler_WorkersBoundConcurrency(t *testing.T) {
+	hour := time.Hour.Milliseconds()
+	db := newWindowDB(10*hour, 10*hour+1)
+	db.groups = []int64{1, 2, 3, 4, 5}
+	for _, groupID := range db.groups {
+		db.until[groupID] = 10 * hour
+	}
+	backend := &slowBackend{delay: 20 * time.Millisecond}
+	s := NewScheduler(db, &Client{backend: backend, db: db}, time.Hour, WithWorkers(2))
+	s.now = func() time.Time { return time.UnixMilli(11 * hour) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Start(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		db.mu.Lock()
+		finished := len(db.windows)
+		db.mu.Unlock()
+		if finished == len(db.groups) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected every group to be summarized, got %d", finished)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if backend.peak > 2 || backend.calls != len(db.groups) {
+		t.Errorf("Expected at most 2 of %d summaries at once, got a peak of %d in %d calls", len(db.groups), backend.peak, backend.calls)
+	}
+}
@@ -0,0 +1,192 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"summarizarr/internal/config"
+	"summarizarr/internal/database"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// defaultContextTokens applies to models without a known context size
+	defaultContextTokens = 8192
+	// localContextTokens is the context Ollama gives a model unless num_ctx
+	// is set
+	localContextTokens = 4096
+	// responseTokens is kept free in the context for the summary
+	responseTokens = 1024
+)
+
+// providerContextTokens is the context size of models of a provider that
+// are not in modelContextTokens.
+var providerContextTokens = map[string]int{
+	"local":  localContextTokens,
+	"openai": 128_000,
+	"groq":   8192,
+	"gemini": 1_048_576,
+	"claude": 200_000,
+}
+
+// modelContextTokens is the context size of models by name prefix. More
+// specific prefixes come first.
+var modelContextTokens = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-4.1", 1_047_576},
+	{"gpt-4o", 128_000},
+	{"gpt-4-turbo", 128_000},
+	{"gpt-4", 8192},
+	{"gpt-3.5-turbo", 16_385},
+	{"gpt-5", 400_000},
+	{"o1", 200_000},
+	{"o3", 200_000},
+	{"o4", 200_000},
+	{"llama-3.1-", 131_072},
+	{"llama-3.3-", 131_072},
+	{"llama3-", 8192},
+	{"gemma2-", 8192},
+	{"mixtral-8x7b", 32_768},
+	{"gemini-1.5-pro", 2_097_152},
+	{"gemini-", 1_048_576},
+	{"claude-", 200_000},
+}
+
+// EstimateTokens approximates the number of tokens of s, at about four
+// characters per token.
+func EstimateTokens(s string) int {
+	return (utf8.RuneCountInString(s) + 3) / 4
+}
+
+// ContextTokens returns the context size of a model of a provider. Ollama
+// models use the context they are given, see LOCAL_CONTEXT_TOKENS.
+func ContextTokens(provider, model string) int {
+	if provider != "local" {
+		model = strings.ToLower(model)
+		// Models may be named like "models/gemini-2.5-flash"
+		if i := strings.LastIndex(model, "/"); i >= 0 {
+			model = model[i+1:]
+		}
+		for _, m := range modelContextTokens {
+			if strings.HasPrefix(model, m.prefix) {
+				return m.tokens
+			}
+		}
+	}
+	if n, ok := providerContextTokens[provider]; ok {
+		return n
+	}
+	return defaultContextTokens
+}
+
+// providerModel returns the configured model of a provider.
+func providerModel(cfg *config.Config, provider string) string {
+	switch provider {
+	case "local":
+		return cfg.LocalModel
+	case "openai":
+		return cfg.OpenAIModel
+	case "groq":
+		return cfg.GroqModel
+	case "gemini":
+		return cfg.GeminiModel
+	case "claude":
+		return cfg.ClaudeModel
+	}
+	return ""
+}
+
+// contextTokens returns the context size of the model of a provider, the
+// configured one if empty.
+func (c *Client) contextTokens(provider string) int {
+	if c.cfg == nil {
+		return ContextTokens(provider, "")
+	}
+	if provider == "" {
+		provider = c.cfg.AIProvider
+	}
+	// Both validated in validateConfig
+	if n, err := strconv.Atoi(c.cfg.AIContextTokens); err == nil && n > 0 && provider == c.cfg.AIProvider {
+		return n
+	}
+	if n, err := strconv.Atoi(c.cfg.LocalContextTokens); err == nil && n > 0 && provider == "local" {
+		return n
+	}
+	return ContextTokens(provider, providerModel(c.cfg, provider))
+}
+
+// Usage is the number of tokens of the prompts and completions of a summary.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+func (u *Usage) add(o Usage) {
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+}
+
+// UsageClient is an AIClient that reports the tokens each call used.
+type UsageClient interface {
+	AIClient
+	SummarizeWithUsage(ctx context.Context, prompt string) (text string, promptTokens, completionTokens int, err error)
+}
+
+// complete sends one prompt to a backend and records the call. Counts a
+// backend does not report are estimated.
+func (c *Client) complete(ctx context.Context, backend AIClient, opts SummarizeOptions, prompt string) (string, Usage, error) {
+	started := time.Now()
+	var text string
+	var usage Usage
+	var err error
+	if uc, ok := backend.(UsageClient); ok {
+		text, usage.PromptTokens, usage.CompletionTokens, err = uc.SummarizeWithUsage(ctx, prompt)
+	} else {
+		text, err = backend.Summarize(ctx, prompt)
+	}
+	if err == nil {
+		if usage.PromptTokens == 0 {
+			usage.PromptTokens = EstimateTokens(prompt)
+		}
+		if usage.CompletionTokens == 0 {
+			usage.CompletionTokens = EstimateTokens(text)
+		}
+	}
+	c.recordCall(opts, usage, time.Since(started), err)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	return text, usage, nil
+}
+
+// recordCall saves a call to a provider with its cost. Calls cancelled by
+// shutdown are not recorded.
+func (c *Client) recordCall(opts SummarizeOptions, usage Usage, latency time.Duration, callErr error) {
+	if c.db == nil || errors.Is(callErr, context.Canceled) {
+		return
+	}
+	call := database.LLMCall{
+		GroupID:          opts.GroupID,
+		JobID:            opts.JobID,
+		Provider:         c.providerName(opts.Provider),
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		LatencyMs:        latency.Milliseconds(),
+		CreatedAt:        time.Now().UnixMilli(),
+	}
+	if c.cfg != nil {
+		call.Model = providerModel(c.cfg, call.Provider)
+	}
+	call.Cost = c.prices.Cost(call.Model, usage.PromptTokens, usage.CompletionTokens)
+	if callErr != nil {
+		call.Error = callErr.Error()
+	}
+	if err := c.db.RecordLLMCall(call); err != nil {
+		slog.Error("Failed to record AI provider call", "provider", call.Provider, "error", err)
+	}
+}
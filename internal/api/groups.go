@@ -0,0 +1,238 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"summarizarr/internal/database"
+)
+
+// handleGroupRoutes dispatches /api/groups/{id}/{resource} requests.
+func (s *Server) handleGroupRoutes(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/groups/")
+	idStr, resource, _ := strings.Cut(rest, "/")
+	groupID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || groupID <= 0 {
+		http.Error(w, "invalid group id", http.StatusBadRequest)
+		return
+	}
+
+	switch resource {
+	case "ephemeral-policy":
+		s.handleGroupEphemeralPolicy(w, r, groupID)
+	case "name-history":
+		s.handleGroupNameHistory(w, r, groupID)
+	case "delivery":
+		s.handleGroupDelivery(w, r, groupID)
+	case "settings":
+		s.handleGroupSettings(w, r, groupID)
+	case "schedule":
+		s.handleGroupSchedule(w, r, groupID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleGroupEphemeralPolicy handles GET/PUT /api/groups/{id}/ephemeral-policy
+func (s *Server) handleGroupEphemeralPolicy(w http.ResponseWriter, r *http.Request, groupID int64) {
+	type policyResponse struct {
+		Policy    string `json:"policy"`
+		Inherited bool   `json:"inherited"`
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			// Empty restores the server-wide default
+			Policy string `json:"policy"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Policy = strings.ToLower(strings.TrimSpace(req.Policy))
+		if req.Policy != "" && !database.ValidEphemeralPolicy(req.Policy) {
+			http.Error(w, "policy must be one of respect, skip, keep", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.SetGroupEphemeralPolicy(groupID, req.Policy); err != nil {
+			if errors.Is(err, database.ErrGroupNotFound) {
+				http.Error(w, "group not found", http.StatusNotFound)
+				return
+			}
+			slog.ErrorContext(r.Context(), "Failed to set ephemeral policy", "error", err, "group_id", groupID)
+			http.Error(w, "failed to set ephemeral policy", http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	policy, inherited, err := s.db.GroupEphemeralPolicy(groupID)
+	if err != nil {
+		if errors.Is(err, database.ErrGroupNotFound) {
+			http.Error(w, "group not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to get ephemeral policy", "error", err, "group_id", groupID)
+		http.Error(w, "failed to get ephemeral policy", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(policyResponse{Policy: policy, Inherited: inherited}); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write ephemeral policy response", "error", err)
+	}
+}
+
+// handleGroupNameHistory handles GET /api/groups/{id}/name-history
+func (s *Server) handleGroupNameHistory(w http.ResponseWriter, r *http.Request, groupID int64) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	history, err := s.db.GetGroupNameHistory(groupID)
+	if err != nil {
+		if errors.Is(err, database.ErrGroupNotFound) {
+			http.Error(w, "group not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to get group name history", "error", err, "group_id", groupID)
+		http.Error(w, "failed to get name history", http.StatusInternalServerError)
+		return
+	}
+
+	responseData, err := json.Marshal(history)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode name history", "error", err)
+		http.Error(w, "failed to encode name history", http.StatusInternalServerError)
+		return
+	}
+	if served := setAPIResponseHeaders(w, r, responseData, 60); served {
+		return
+	}
+	if _, err := w.Write(responseData); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write name history response", "error", err)
+	}
+}
+
+// handleGroupDelivery handles GET/PUT /api/groups/{id}/delivery, where
+// summaries of the group are posted in Signal
+func (s *Server) handleGroupDelivery(w http.ResponseWriter, r *http.Request, groupID int64) {
+	type deliveryResponse struct {
+		// Empty when summaries are not posted
+		Target string `json:"target"`
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req deliveryResponse
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Target = strings.ToLower(strings.TrimSpace(req.Target))
+		if !database.ValidSummaryDelivery(req.Target) {
+			http.Error(w, "target must be one of group, self, digest or empty", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.SetGroupSummaryDelivery(groupID, req.Target); err != nil {
+			if errors.Is(err, database.ErrGroupNotFound) {
+				http.Error(w, "group not found", http.StatusNotFound)
+				return
+			}
+			slog.ErrorContext(r.Context(), "Failed to set summary delivery", "error", err, "group_id", groupID)
+			http.Error(w, "failed to set summary delivery", http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	target, err := s.db.GetDeliveryTarget(groupID)
+	if err != nil {
+		if errors.Is(err, database.ErrGroupNotFound) {
+			http.Error(w, "group not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to get summary delivery", "error", err, "group_id", groupID)
+		http.Error(w, "failed to get summary delivery", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(deliveryResponse{Target: target.Mode}); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write summary delivery response", "error", err)
+	}
+}
+
+// handleGroupSettings handles GET/PUT /api/groups/{id}/settings. PUT only
+// changes the fields present in the body.
+func (s *Server) handleGroupSettings(w http.ResponseWriter, r *http.Request, groupID int64) {
+	settings, err := s.db.GetGroupSettings(groupID)
+	if err != nil {
+		if errors.Is(err, database.ErrGroupNotFound) {
+			http.Error(w, "group not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to get group settings", "error", err, "group_id", groupID)
+		http.Error(w, "failed to get group settings", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			Ingest          *bool     `json:"ingest"`
+			Summarize       *bool     `json:"summarize"`
+			ExcludedSenders *[]string `json:"excludedSenders"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Ingest != nil {
+			settings.Ingest = *req.Ingest
+		}
+		if req.Summarize != nil {
+			settings.Summarize = *req.Summarize
+		}
+		if req.ExcludedSenders != nil {
+			settings.ExcludedSenders = *req.ExcludedSenders
+		}
+		if err := s.db.SetGroupSettings(groupID, settings); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to set group settings", "error", err, "group_id", groupID)
+			http.Error(w, "failed to set group settings", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Updated group settings", "group_id", groupID,
+			"ingest", settings.Ingest, "summarize", settings.Summarize, "excluded_senders", len(settings.ExcludedSenders))
+		if settings, err = s.db.GetGroupSettings(groupID); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to get group settings", "error", err, "group_id", groupID)
+			http.Error(w, "failed to get group settings", http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(settings); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write group settings response", "error", err)
+	}
+}
@@ -0,0 +1,354 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newGroupRoutesTestServer(t *testing.T) *Server {
+	t.Helper()
+	testDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	testDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = testDB.Close() })
+
+	schema := `
+	CREATE TABLE groups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		group_id TEXT UNIQUE,
+		name TEXT,
+		type TEXT DEFAULT 'group',
+		ephemeral_policy TEXT,
+		account TEXT,
+		summary_delivery TEXT,
+		summary_schedule TEXT,
+		summary_timezone TEXT,
+		summary_quiet_hours TEXT,
+		summary_min_messages INTEGER,
+		summary_min_participants INTEGER,
+		summary_min_chars INTEGER,
+		summary_carry_from INTEGER,
+		summarized_until INTEGER
+	);
+	CREATE TABLE summaries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		group_id INTEGER NOT NULL,
+		end_timestamp INTEGER NOT NULL
+	);
+	CREATE TABLE summary_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL DEFAULT 'scheduled',
+		group_id INTEGER NOT NULL,
+		end_timestamp INTEGER NOT NULL
+	);
+	CREATE TABLE group_members (
+		group_id INTEGER NOT NULL,
+		member TEXT NOT NULL,
+		user_id INTEGER,
+		is_admin BOOLEAN DEFAULT FALSE,
+		PRIMARY KEY (group_id, member)
+	);
+	INSERT INTO group_members (group_id, member) VALUES (1, '+15550000001'), (1, '+15550000002');
+	CREATE TABLE group_settings (
+		group_id INTEGER PRIMARY KEY,
+		ingest BOOLEAN NOT NULL DEFAULT TRUE,
+		summarize BOOLEAN NOT NULL DEFAULT TRUE
+	);
+	CREATE TABLE group_excluded_senders (
+		group_id INTEGER NOT NULL,
+		sender TEXT NOT NULL,
+		PRIMARY KEY (group_id, sender)
+	);
+	CREATE TABLE name_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		entity_type TEXT NOT NULL,
+		entity_id INTEGER NOT NULL,
+		old_name TEXT,
+		new_name TEXT,
+		changed_at INTEGER NOT NULL
+	);
+	INSERT INTO groups (id, group_id, name) VALUES (1, 'test-group-1', 'Weekend Plans');
+	INSERT INTO groups (id, group_id, name, type) VALUES (2, 'direct:uuid-1', 'Alice', 'direct');
+	INSERT INTO name_history (entity_type, entity_id, old_name, new_name, changed_at) VALUES
+		('group', 1, 'Plans', 'Weekend Plans', 2000),
+		('user', 1, 'Al', 'Alice', 3000);
+	`
+	if _, err := testDB.Exec(schema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	return NewServer(":8080", testDB, nil)
+}
+
+func TestGroupEphemeralPolicyEndpoint(t *testing.T) {
+	server := newGroupRoutesTestServer(t)
+
+	w := httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodGet, "/api/groups/1/ephemeral-policy", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"policy":"respect","inherited":true`) {
+		t.Errorf("Expected inherited default policy, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodPut, "/api/groups/1/ephemeral-policy", strings.NewReader(`{"policy":"skip"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"policy":"skip","inherited":false`) {
+		t.Errorf("Expected group override, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodPut, "/api/groups/1/ephemeral-policy", strings.NewReader(`{"policy":"shred"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid policy, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodPut, "/api/groups/42/ephemeral-policy", strings.NewReader(`{"policy":"keep"}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown group, got %d", w.Code)
+	}
+}
+
+func TestGroupNameHistoryEndpoint(t *testing.T) {
+	server := newGroupRoutesTestServer(t)
+
+	w := httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodGet, "/api/groups/1/name-history", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	var history []struct {
+		OldName   string `json:"oldName"`
+		NewName   string `json:"newName"`
+		ChangedAt int64  `json:"changedAt"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&history); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(history) != 1 || history[0].OldName != "Plans" || history[0].NewName != "Weekend Plans" {
+		t.Errorf("Unexpected history: %+v", history)
+	}
+
+	for path, expected := range map[string]int{
+		"/api/groups/abc/name-history": http.StatusBadRequest,
+		"/api/groups/42/name-history":  http.StatusNotFound,
+		"/api/groups/1/unknown":        http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		server.handleGroupRoutes(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != expected {
+			t.Errorf("%s: expected status %d, got %d", path, expected, w.Code)
+		}
+	}
+}
+
+func TestGetGroupsIncludesType(t *testing.T) {
+	server := newGroupRoutesTestServer(t)
+
+	type group struct {
+		ID          int64  `json:"id"`
+		Name        string `json:"name"`
+		Type        string `json:"type"`
+		MemberCount int    `json:"memberCount"`
+	}
+
+	w := httptest.NewRecorder()
+	server.handleGetGroups(w, httptest.NewRequest(http.MethodGet, "/api/groups", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var groups []group
+	if err := json.NewDecoder(w.Body).Decode(&groups); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(groups) != 2 || groups[0].Type != "direct" || groups[1].Type != "group" || groups[1].MemberCount != 2 {
+		t.Errorf("Unexpected groups: %+v", groups)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleGetGroups(w, httptest.NewRequest(http.MethodGet, "/api/groups?type=direct", nil))
+	groups = nil
+	if err := json.NewDecoder(w.Body).Decode(&groups); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Name != "Alice" {
+		t.Errorf("Expected only the direct conversation, got %+v", groups)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleGetGroups(w, httptest.NewRequest(http.MethodGet, "/api/groups?type=channel", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown type, got %d", w.Code)
+	}
+}
+
+func TestGroupDeliveryEndpoint(t *testing.T) {
+	server := newGroupRoutesTestServer(t)
+
+	w := httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodGet, "/api/groups/1/delivery", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"target":""`) {
+		t.Fatalf("Expected delivery to be off by default, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodPut, "/api/groups/1/delivery", strings.NewReader(`{"target":"digest"}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"target":"digest"`) {
+		t.Errorf("Expected digest target, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodPut, "/api/groups/1/delivery", strings.NewReader(`{"target":"email"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown target, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodPut, "/api/groups/42/delivery", strings.NewReader(`{"target":"group"}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown group, got %d", w.Code)
+	}
+}
+
+func TestGroupSettingsEndpoint(t *testing.T) {
+	server := newGroupRoutesTestServer(t)
+
+	type settings struct {
+		Ingest          bool     `json:"ingest"`
+		Summarize       bool     `json:"summarize"`
+		ExcludedSenders []string `json:"excludedSenders"`
+	}
+	decode := func(w *httptest.ResponseRecorder) settings {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		var s settings
+		if err := json.NewDecoder(w.Body).Decode(&s); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return s
+	}
+
+	w := httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodGet, "/api/groups/1/settings", nil))
+	if s := decode(w); !s.Ingest || !s.Summarize || len(s.ExcludedSenders) != 0 {
+		t.Errorf("Expected defaults, got %+v", s)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodPut, "/api/groups/1/settings",
+		strings.NewReader(`{"summarize":false,"excludedSenders":["+15550000002"," "]}`)))
+	if s := decode(w); !s.Ingest || s.Summarize || len(s.ExcludedSenders) != 1 || s.ExcludedSenders[0] != "+15550000002" {
+		t.Errorf("Unexpected settings after update: %+v", s)
+	}
+
+	// Fields missing from the body keep their value
+	w = httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodPut, "/api/groups/1/settings", strings.NewReader(`{"ingest":false}`)))
+	if s := decode(w); s.Ingest || s.Summarize || len(s.ExcludedSenders) != 1 {
+		t.Errorf("Unexpected settings after partial update: %+v", s)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodPut, "/api/groups/42/settings", strings.NewReader(`{}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown group, got %d", w.Code)
+	}
+}
+
+func TestGroupScheduleEndpoint(t *testing.T) {
+	server := newGroupRoutesTestServer(t)
+
+	type scheduleResponse struct {
+		Schedule  string `json:"schedule"`
+		TimeZone  string `json:"timezone"`
+		Inherited bool   `json:"inherited"`
+		Effective struct {
+			Schedule    string `json:"schedule"`
+			TimeZone    string `json:"timezone"`
+			QuietHours  string `json:"quietHours"`
+			MinMessages *int   `json:"minMessages"`
+		} `json:"effective"`
+		NextRun *time.Time `json:"nextRun"`
+	}
+	decode := func(w *httptest.ResponseRecorder) scheduleResponse {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		var s scheduleResponse
+		if err := json.NewDecoder(w.Body).Decode(&s); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return s
+	}
+
+	w := httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodGet, "/api/groups/1/schedule", nil))
+	if s := decode(w); !s.Inherited || s.Effective.Schedule != "12h" || s.NextRun == nil {
+		t.Errorf("Expected the default schedule, got %+v", s)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodPut, "/api/groups/1/schedule",
+		strings.NewReader(`{"schedule":"0 8 * * *","timezone":"UTC"}`)))
+	if s := decode(w); s.Inherited || s.Schedule != "0 8 * * *" || s.Effective.Schedule != "0 8 * * *" {
+		t.Errorf("Unexpected schedule after update: %+v", s)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodPut, "/api/groups/1/schedule",
+		strings.NewReader(`{"schedule":"0 8 * * *","quietHours":"22:00-07:00","minMessages":5}`)))
+	if s := decode(w); s.Effective.QuietHours != "22:00-07:00" || s.Effective.MinMessages == nil || *s.Effective.MinMessages != 5 {
+		t.Errorf("Expected quiet hours and a minimum, got %+v", s)
+	}
+
+	for _, body := range []string{`{"schedule":"every day"}`, `{"timezone":"Nowhere/City"}`, `{"schedule":"10s"}`,
+		`{"quietHours":"late"}`, `{"minChars":-1}`} {
+		w = httptest.NewRecorder()
+		server.handleGroupRoutes(w, httptest.NewRequest(http.MethodPut, "/api/groups/1/schedule", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, w.Code)
+		}
+	}
+
+	// Groups that are behind, or never summarized, run at the next check
+	if _, err := server.db.Exec("UPDATE groups SET summarized_until = ? WHERE id = 1", time.Now().Add(-72*time.Hour).UnixMilli()); err != nil {
+		t.Fatalf("Failed to update progress: %v", err)
+	}
+	w = httptest.NewRecorder()
+	server.handleGetSchedule(w, httptest.NewRequest(http.MethodGet, "/api/schedule", nil))
+	var list struct {
+		Groups []scheduleResponse `json:"groups"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil || len(list.Groups) != 2 {
+		t.Fatalf("Expected both groups, got %v %v", list.Groups, err)
+	}
+	for _, s := range list.Groups {
+		if s.NextRun == nil || time.Until(*s.NextRun) > time.Minute {
+			t.Errorf("Expected the group to run now, got %+v", s)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	server.handleGroupRoutes(w, httptest.NewRequest(http.MethodPut, "/api/groups/42/schedule", strings.NewReader(`{}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown group, got %d", w.Code)
+	}
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"summarizarr/internal/importer"
+)
+
+// maxImportSize bounds an uploaded export.
+const maxImportSize = 64 << 20
+
+// handleImport handles POST /api/import. The export is the request body, or
+// the "file" field of a multipart form. Query parameters mirror the flags of
+// "summarizarr import": format, account, groupId, groupName, tz, dryRun and
+// backfill. Backfilled summaries are queued as summary jobs.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.importer == nil {
+		http.Error(w, "import is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := importer.ParseOptions{
+		Format:    query.Get("format"),
+		Account:   query.Get("account"),
+		GroupID:   query.Get("groupId"),
+		GroupName: query.Get("groupName"),
+	}
+	if !importer.ValidFormat(opts.Format) {
+		http.Error(w, "unknown format, use auto, signal-cli, desktop or text", http.StatusBadRequest)
+		return
+	}
+	if tz := query.Get("tz"); tz != "" {
+		location, err := time.LoadLocation(tz)
+		if err != nil {
+			http.Error(w, "invalid time zone", http.StatusBadRequest)
+			return
+		}
+		opts.Location = location
+	}
+	dryRun, _ := strconv.ParseBool(query.Get("dryRun"))
+	backfill, _ := strconv.ParseBool(query.Get("backfill"))
+	if dryRun && backfill {
+		http.Error(w, "backfill cannot be combined with dryRun", http.StatusBadRequest)
+		return
+	}
+
+	data, err := readImportUpload(w, r)
+	if err != nil {
+		http.Error(w, "failed to read upload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	envelopes, err := importer.Parse(data, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := s.importer.Import(r.Context(), envelopes, dryRun)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to import messages", "error", err)
+		http.Error(w, "failed to import messages", http.StatusInternalServerError)
+		return
+	}
+
+	if backfill && report.Imported > 0 {
+		if err := s.importer.Backfill(report); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to backfill summaries", "error", err, "jobs", len(report.BackfillJobs))
+			http.Error(w, "failed to backfill summaries", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write import response", "error", err)
+	}
+}
+
+func readImportUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return io.ReadAll(r.Body)
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			slog.Error("Failed to close uploaded file", "error", err)
+		}
+	}()
+	return io.ReadAll(file)
+}
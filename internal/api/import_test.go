@@ -0,0 +1,106 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"summarizarr/internal/database"
+	"summarizarr/internal/importer"
+	"summarizarr/internal/schedule"
+	"summarizarr/internal/signal"
+)
+
+// importDB stores nothing and knows no messages
+type importDB struct{ imported int }
+
+func (d *importDB) LookupMessage(msg *signal.Envelope) (database.MessageLookup, bool, error) {
+	group := msg.Group()
+	if group == nil {
+		return database.MessageLookup{}, false, nil
+	}
+	return database.MessageLookup{GroupID: group.GroupID, GroupName: group.GroupName, Timestamp: msg.Timestamp}, true, nil
+}
+
+func (d *importDB) ImportMessage(msg *signal.Envelope) error {
+	d.imported++
+	return nil
+}
+
+func (d *importDB) FindGroupID(signalGroupID string) (int64, error) {
+	return 0, database.ErrGroupNotFound
+}
+
+func (d *importDB) GetGroupSchedule(groupID int64) (database.GroupSchedule, error) {
+	return database.GroupSchedule{}, nil
+}
+
+func (d *importDB) GetMessagesForSummarization(groupID int64, start, end int64) ([]database.MessageForSummary, error) {
+	return nil, nil
+}
+
+func (d *importDB) HasSummaryOverlapping(groupID int64, start, end int64) (bool, error) {
+	return false, nil
+}
+
+func (d *importDB) EnqueueSummaryRequest(req database.SummaryRequest) (int64, error) {
+	return 0, nil
+}
+
+func TestHandleImport(t *testing.T) {
+	testDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer func() { _ = testDB.Close() }()
+
+	db := &importDB{}
+	server := NewServerWithOptions(":8080", testDB, nil, WithSignalValidation(false),
+		WithImporter(importer.New(db, schedule.Config{Spec: "1h"})))
+	transcript := "[2024-03-01 14:05] Alice: hi\n[2024-03-01 14:06] Bob: hello\n"
+
+	w := httptest.NewRecorder()
+	server.handleImport(w, httptest.NewRequest(http.MethodPost, "/api/import?format=text&groupId=g1&dryRun=true", strings.NewReader(transcript)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var report importer.Report
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !report.DryRun || report.Imported != 2 || db.imported != 0 {
+		t.Errorf("Expected a dry run of 2 messages, got %+v and %d stored", report, db.imported)
+	}
+
+	// Browsers upload files as multipart forms
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "chat.txt")
+	_, _ = part.Write([]byte(transcript))
+	_ = form.Close()
+	r := httptest.NewRequest(http.MethodPost, "/api/import?groupId=g1", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	w = httptest.NewRecorder()
+	server.handleImport(w, r)
+	if w.Code != http.StatusOK || db.imported != 2 {
+		t.Errorf("Expected the upload to be imported, got %d and %d stored. Body: %s", w.Code, db.imported, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	server.handleImport(w, httptest.NewRequest(http.MethodPost, "/api/import?format=whatsapp", strings.NewReader(transcript)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown format, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	NewServerWithOptions(":8080", testDB, nil, WithSignalValidation(false)).handleImport(w,
+		httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(transcript)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without an importer, got %d", w.Code)
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"summarizarr/internal/database"
+	"summarizarr/internal/schedule"
+)
+
+// groupScheduleResponse describes the schedule of a group and its next run.
+type groupScheduleResponse struct {
+	GroupID int64  `json:"groupId"`
+	Name    string `json:"name"`
+	// The group's own settings, empty if inherited
+	schedule.Config
+	Inherited bool            `json:"inherited"`
+	Effective schedule.Config `json:"effective"`
+	// SummarizedUntil is the end of the last summarized window
+	SummarizedUntil *time.Time `json:"summarizedUntil"`
+	// NextRun is when the group is summarized next, null if never
+	NextRun *time.Time `json:"nextRun"`
+	Error   string     `json:"error,omitempty"`
+}
+
+func (s *Server) describeSchedule(group database.GroupSchedule, now time.Time) groupScheduleResponse {
+	own := group.Config()
+	resp := groupScheduleResponse{
+		GroupID:   group.GroupID,
+		Name:      group.Name,
+		Config:    own,
+		Inherited: own == schedule.Config{},
+		Effective: s.schedule.Override(own),
+	}
+	var until time.Time
+	if group.SummarizedUntil > 0 {
+		until = time.UnixMilli(group.SummarizedUntil)
+		resp.SummarizedUntil = &until
+	}
+
+	sched, err := resp.Effective.Parse()
+	if err != nil {
+		// Stored schedules are validated, but the global one may have changed
+		resp.Error = err.Error()
+		return resp
+	}
+	if next := schedule.NextRun(sched, until, now); !next.IsZero() {
+		resp.NextRun = &next
+	}
+	return resp
+}
+
+// handleGetSchedule handles GET /api/schedule, the next run of every
+// summarized group.
+func (s *Server) handleGetSchedule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	groups, err := s.db.ListGroupSchedules()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list group schedules", "error", err)
+		http.Error(w, "failed to list schedules", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	resp := struct {
+		Default schedule.Config         `json:"default"`
+		Groups  []groupScheduleResponse `json:"groups"`
+	}{Default: s.schedule, Groups: make([]groupScheduleResponse, 0, len(groups))}
+	for _, group := range groups {
+		resp.Groups = append(resp.Groups, s.describeSchedule(group, now))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write schedule response", "error", err)
+	}
+}
+
+// handleGroupSchedule handles GET/PUT /api/groups/{id}/schedule
+func (s *Server) handleGroupSchedule(w http.ResponseWriter, r *http.Request, groupID int64) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req schedule.Config
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		// Empty values and null minimums restore the server-wide settings
+		req.Spec, req.TimeZone, req.QuietHours = strings.TrimSpace(req.Spec), strings.TrimSpace(req.TimeZone), strings.TrimSpace(req.QuietHours)
+		if _, err := s.schedule.Override(req).Parse(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.db.SetGroupSchedule(groupID, req); err != nil {
+			if errors.Is(err, database.ErrGroupNotFound) {
+				http.Error(w, "group not found", http.StatusNotFound)
+				return
+			}
+			slog.ErrorContext(r.Context(), "Failed to set group schedule", "error", err, "group_id", groupID)
+			http.Error(w, "failed to set schedule", http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	group, err := s.db.GetGroupSchedule(groupID)
+	if err != nil {
+		if errors.Is(err, database.ErrGroupNotFound) {
+			http.Error(w, "group not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to get group schedule", "error", err, "group_id", groupID)
+		http.Error(w, "failed to get schedule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.describeSchedule(group, time.Now())); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write schedule response", "error", err)
+	}
+}
@@ -18,9 +18,13 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"summarizarr/internal/ai"
 	"summarizarr/internal/auth"
+	"summarizarr/internal/config"
 	"summarizarr/internal/database"
-
+	"summarizarr/internal/importer"
+	"summarizarr/internal/schedule"
+	"summarizarr/internal/signal"
 	"summarizarr/internal/version"
 	"time"
 )
@@ -51,12 +55,34 @@ type Server struct {
 	server         *http.Server
 	sessionManager *auth.SessionManager
 	authHandlers   *AuthHandlers
+	signalStatus   []SignalStatusProvider
+	importer       *importer.Importer
+	schedule       schedule.Config
+	summaryQueue   SummaryQueue
+	monthlyBudget  float64
+	providerHealth ProviderHealthReporter
+}
+
+// SignalStatusProvider reports the live state of the Signal listener.
+type SignalStatusProvider interface {
+	Status() signal.Status
+}
+
+// ProviderHealthReporter reports the circuit state of the AI providers.
+type ProviderHealthReporter interface {
+	ProviderHealth() []ai.ProviderHealth
 }
 
 // ServerOptions holds configuration options for the server
 type ServerOptions struct {
 	SignalURL      string
 	ValidateSignal bool
+	SignalStatus   []SignalStatusProvider
+	Importer       *importer.Importer
+	Schedule       schedule.Config
+	SummaryQueue   SummaryQueue
+	MonthlyBudget  float64
+	ProviderHealth ProviderHealthReporter
 }
 
 // ServerOption is a functional option for configuring the server
@@ -69,6 +95,53 @@ func WithSignalURL(url string) ServerOption {
 	}
 }
 
+// WithSignalStatus exposes the state of the Signal listeners, one per account,
+// on /health and /api/signal/status, and their accounts and errors on
+// /api/signal/accounts
+func WithSignalStatus(providers ...SignalStatusProvider) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.SignalStatus = providers
+	}
+}
+
+// WithImporter enables uploading chat history on /api/import
+func WithImporter(imp *importer.Importer) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.Importer = imp
+	}
+}
+
+// WithSchedule sets the schedule of groups without their own, shown on
+// /api/schedule
+func WithSchedule(config schedule.Config) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.Schedule = config
+	}
+}
+
+// WithSummaryQueue enables requesting and regenerating summaries on
+// /api/summaries
+func WithSummaryQueue(queue SummaryQueue) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.SummaryQueue = queue
+	}
+}
+
+// WithMonthlyBudget reports the monthly budget in USD on /api/usage
+func WithMonthlyBudget(usd float64) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.MonthlyBudget = usd
+	}
+}
+
+// WithProviderHealth exposes the circuit states of the AI provider fallback
+// chain on /health, and their errors on /api/ai/providers
+func WithProviderHealth(reporter ProviderHealthReporter) ServerOption {
+	return func(opts *ServerOptions) {
+		opts.ProviderHealth = reporter
+	}
+}
+
 // WithSignalValidation enables or disables Signal CLI validation on startup
 func WithSignalValidation(validate bool) ServerOption {
 	return func(opts *ServerOptions) {
@@ -92,6 +165,7 @@ func NewServerWithOptions(addr string, db *sql.DB, frontendFS fs.FS, options ...
 	opts := &ServerOptions{
 		SignalURL:      getSignalURL(),
 		ValidateSignal: true,
+		Schedule:       schedule.Config{Spec: "12h"}, // default SUMMARIZATION_INTERVAL
 	}
 
 	// Apply provided options
@@ -125,6 +199,12 @@ func NewServerWithOptions(addr string, db *sql.DB, frontendFS fs.FS, options ...
 		},
 		sessionManager: sessionManager,
 		authHandlers:   authHandlers,
+		signalStatus:   opts.SignalStatus,
+		importer:       opts.Importer,
+		schedule:       opts.Schedule,
+		summaryQueue:   opts.SummaryQueue,
+		monthlyBudget:  opts.MonthlyBudget,
+		providerHealth: opts.ProviderHealth,
 	}
 
 	// Apply session middleware to all routes
@@ -144,10 +224,17 @@ func NewServerWithOptions(addr string, db *sql.DB, frontendFS fs.FS, options ...
 	mux.Handle("/api/auth/register", sessionMiddleware(authRateLimiter.Middleware(csrfProtection.Middleware(http.HandlerFunc(s.authHandlers.Register)))))
 
 	// Protected API routes (with session middleware and auth requirement)
-	mux.Handle("/api/summaries", sessionMiddleware(sessionManager.RequireAuth(http.HandlerFunc(s.handleGetSummaries))))
-	mux.Handle("/api/summaries/", sessionMiddleware(sessionManager.RequireAuth(csrfProtection.Middleware(http.HandlerFunc(s.handleDeleteSummary))))) // DELETE /api/summaries/{id}
+	mux.Handle("/api/summaries", sessionMiddleware(sessionManager.RequireAuth(csrfProtection.Middleware(http.HandlerFunc(s.handleSummaries)))))
+	mux.Handle("/api/summaries/", sessionMiddleware(sessionManager.RequireAuth(csrfProtection.Middleware(http.HandlerFunc(s.handleSummaryRoutes))))) // /api/summaries/{id}/...
+	mux.Handle("/api/jobs/", sessionMiddleware(sessionManager.RequireAuth(http.HandlerFunc(s.handleGetJob))))
 	mux.Handle("/api/groups", sessionMiddleware(sessionManager.RequireAuth(http.HandlerFunc(s.handleGetGroups))))
+	mux.Handle("/api/groups/", sessionMiddleware(sessionManager.RequireAuth(csrfProtection.Middleware(http.HandlerFunc(s.handleGroupRoutes))))) // /api/groups/{id}/...
 	mux.Handle("/api/export", sessionMiddleware(sessionManager.RequireAuth(http.HandlerFunc(s.handleExport))))
+	mux.Handle("/api/import", sessionMiddleware(sessionManager.RequireAuth(csrfProtection.Middleware(http.HandlerFunc(s.handleImport)))))
+	mux.Handle("/api/schedule", sessionMiddleware(sessionManager.RequireAuth(http.HandlerFunc(s.handleGetSchedule))))
+	mux.Handle("/api/usage", sessionMiddleware(sessionManager.RequireAuth(http.HandlerFunc(s.handleGetUsage))))
+	mux.Handle("/api/signal/accounts", sessionMiddleware(sessionManager.RequireAuth(http.HandlerFunc(s.handleSignalAccounts))))
+	mux.Handle("/api/ai/providers", sessionMiddleware(sessionManager.RequireAuth(http.HandlerFunc(s.handleAIProviders))))
 	// Encryption key rotation removed
 
 	// Public routes (no auth required)
@@ -173,6 +260,7 @@ func NewServerWithAppDB(addr string, appDB *database.DB, frontendFS fs.FS, optio
 	opts := &ServerOptions{
 		SignalURL:      getSignalURL(),
 		ValidateSignal: true,
+		Schedule:       schedule.Config{Spec: "12h"}, // default SUMMARIZATION_INTERVAL
 	}
 
 	// Apply provided options
@@ -206,6 +294,12 @@ func NewServerWithAppDB(addr string, appDB *database.DB, frontendFS fs.FS, optio
 		},
 		sessionManager: sessionManager,
 		authHandlers:   authHandlers,
+		signalStatus:   opts.SignalStatus,
+		importer:       opts.Importer,
+		schedule:       opts.Schedule,
+		summaryQueue:   opts.SummaryQueue,
+		monthlyBudget:  opts.MonthlyBudget,
+		providerHealth: opts.ProviderHealth,
 	}
 
 	// Apply session middleware to all routes
@@ -225,10 +319,17 @@ func NewServerWithAppDB(addr string, appDB *database.DB, frontendFS fs.FS, optio
 	mux.Handle("/api/auth/register", sessionMiddleware(authRateLimiter.Middleware(csrfProtection.Middleware(http.HandlerFunc(s.authHandlers.Register)))))
 
 	// Protected API routes (with session middleware and auth requirement)
-	mux.Handle("/api/summaries", sessionMiddleware(sessionManager.RequireAuth(http.HandlerFunc(s.handleGetSummaries))))
-	mux.Handle("/api/summaries/", sessionMiddleware(sessionManager.RequireAuth(csrfProtection.Middleware(http.HandlerFunc(s.handleDeleteSummary))))) // DELETE /api/summaries/{id}
+	mux.Handle("/api/summaries", sessionMiddleware(sessionManager.RequireAuth(csrfProtection.Middleware(http.HandlerFunc(s.handleSummaries)))))
+	mux.Handle("/api/summaries/", sessionMiddleware(sessionManager.RequireAuth(csrfProtection.Middleware(http.HandlerFunc(s.handleSummaryRoutes))))) // /api/summaries/{id}/...
+	mux.Handle("/api/jobs/", sessionMiddleware(sessionManager.RequireAuth(http.HandlerFunc(s.handleGetJob))))
 	mux.Handle("/api/groups", sessionMiddleware(sessionManager.RequireAuth(http.HandlerFunc(s.handleGetGroups))))
+	mux.Handle("/api/groups/", sessionMiddleware(sessionManager.RequireAuth(csrfProtection.Middleware(http.HandlerFunc(s.handleGroupRoutes))))) // /api/groups/{id}/...
 	mux.Handle("/api/export", sessionMiddleware(sessionManager.RequireAuth(http.HandlerFunc(s.handleExport))))
+	mux.Handle("/api/import", sessionMiddleware(sessionManager.RequireAuth(csrfProtection.Middleware(http.HandlerFunc(s.handleImport)))))
+	mux.Handle("/api/schedule", sessionMiddleware(sessionManager.RequireAuth(http.HandlerFunc(s.handleGetSchedule))))
+	mux.Handle("/api/usage", sessionMiddleware(sessionManager.RequireAuth(http.HandlerFunc(s.handleGetUsage))))
+	mux.Handle("/api/signal/accounts", sessionMiddleware(sessionManager.RequireAuth(http.HandlerFunc(s.handleSignalAccounts))))
+	mux.Handle("/api/ai/providers", sessionMiddleware(sessionManager.RequireAuth(http.HandlerFunc(s.handleAIProviders))))
 	// Encryption key rotation removed
 
 	// Public routes (no auth required)
@@ -541,10 +642,29 @@ func (s *Server) handleGetGroups(w http.ResponseWriter, r *http.Request) {
 	type groupResponse struct {
 		ID   int64  `json:"id"`
 		Name string `json:"name"`
+		Type string `json:"type"` // "group" or "direct"
+		// Current members; 0 until the membership has been fetched
+		MemberCount int `json:"memberCount"`
+	}
+
+	// Optional ?type=group|direct filter
+	query := `SELECT id, COALESCE(name, ''), COALESCE(type, 'group'),
+		(SELECT COUNT(*) FROM group_members gm WHERE gm.group_id = groups.id)
+		FROM groups`
+	var args []interface{}
+	switch t := r.URL.Query().Get("type"); t {
+	case "":
+	case database.ConversationGroup, database.ConversationDirect:
+		query += " WHERE COALESCE(type, 'group') = ?"
+		args = append(args, t)
+	default:
+		http.Error(w, "type must be group or direct", http.StatusBadRequest)
+		return
 	}
+	query += " ORDER BY name"
 
 	// Query groups from database
-	rows, err := s.db.Query("SELECT id, name FROM groups ORDER BY name")
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		slog.ErrorContext(r.Context(), "Failed to query groups", "error", err)
 		http.Error(w, fmt.Sprintf("failed to get groups: %v", err), http.StatusInternalServerError)
@@ -559,7 +679,7 @@ func (s *Server) handleGetGroups(w http.ResponseWriter, r *http.Request) {
 	groups := []groupResponse{}
 	for rows.Next() {
 		var group groupResponse
-		if err := rows.Scan(&group.ID, &group.Name); err != nil {
+		if err := rows.Scan(&group.ID, &group.Name, &group.Type, &group.MemberCount); err != nil {
 			slog.ErrorContext(r.Context(), "Failed to scan group row", "error", err)
 			continue
 		}
@@ -799,7 +919,72 @@ func (s *Server) handleSignalRegister(w http.ResponseWriter, r *http.Request) {
 	slog.InfoContext(r.Context(), "Generated QR code for Signal registration", "phoneNumber", req.PhoneNumber)
 }
 
-// handleSignalStatus checks Signal registration status
+// signalAccountStatus is the registration and listener state of an account.
+type signalAccountStatus struct {
+	IsRegistered bool           `json:"isRegistered"`
+	PhoneNumber  string         `json:"phoneNumber"`
+	Message      string         `json:"message"`
+	Listener     *signal.Status `json:"listener,omitempty"`
+}
+
+// listenerState is the state of a Signal listener as shown on public routes,
+// without the account number and connection error.
+type listenerState struct {
+	Receiver       string    `json:"receiver"`
+	Connected      bool      `json:"connected"`
+	Reconnecting   bool      `json:"reconnecting"`
+	ConnectedSince time.Time `json:"connectedSince,omitzero"`
+	LastMessageAt  time.Time `json:"lastMessageAt,omitzero"`
+	ReconnectCount int64     `json:"reconnectCount"`
+}
+
+func publicListener(status signal.Status) *listenerState {
+	return &listenerState{
+		Receiver:       status.Receiver,
+		Connected:      status.Connected,
+		Reconnecting:   status.Reconnecting,
+		ConnectedSince: status.ConnectedSince,
+		LastMessageAt:  status.LastMessageAt,
+		ReconnectCount: status.ReconnectCount,
+	}
+}
+
+// signalAccounts checks the registration of every configured account. There
+// is always at least one entry, for a missing number too.
+func (s *Server) signalAccounts() []signalAccountStatus {
+	listeners := make(map[string]signal.Status, len(s.signalStatus))
+	for _, provider := range s.signalStatus {
+		status := provider.Status()
+		listeners[status.Account] = status
+	}
+
+	phoneNumbers := config.ParseList(os.Getenv("SIGNAL_PHONE_NUMBER"))
+	if len(phoneNumbers) == 0 {
+		phoneNumbers = []string{""}
+	}
+
+	accounts := make([]signalAccountStatus, 0, len(phoneNumbers))
+	for _, phoneNumber := range phoneNumbers {
+		account := signalAccountStatus{PhoneNumber: phoneNumber, Message: "Phone number not configured"}
+		if phoneNumber != "" {
+			account.IsRegistered = s.checkSignalRegistration(phoneNumber)
+			if account.IsRegistered {
+				account.Message = "Phone number is registered and ready"
+			} else {
+				account.Message = "Phone number not registered with Signal CLI"
+			}
+		}
+		if listener, ok := listeners[phoneNumber]; ok {
+			account.Listener = &listener
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+// handleSignalStatus checks Signal registration status. The route is public
+// for the setup dialog, so it only describes the first account, and its
+// listener without the connection error.
 func (s *Server) handleSignalStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.NotFound(w, r)
@@ -808,39 +993,59 @@ func (s *Server) handleSignalStatus(w http.ResponseWriter, r *http.Request) {
 
 	slog.InfoContext(r.Context(), "Handling GET /signal/status request")
 
-	type statusResponse struct {
-		IsRegistered bool   `json:"isRegistered"`
-		PhoneNumber  string `json:"phoneNumber"`
-		Message      string `json:"message"`
+	first := s.signalAccounts()[0]
+	response := struct {
+		IsRegistered bool           `json:"isRegistered"`
+		PhoneNumber  string         `json:"phoneNumber"`
+		Message      string         `json:"message"`
+		Listener     *listenerState `json:"listener,omitempty"`
+	}{IsRegistered: first.IsRegistered, PhoneNumber: first.PhoneNumber, Message: first.Message}
+	if first.Listener != nil {
+		response.Listener = publicListener(*first.Listener)
 	}
 
-	phoneNumber := os.Getenv("SIGNAL_PHONE_NUMBER")
-	isRegistered := false
-	message := "Phone number not configured"
-
-	if phoneNumber != "" {
-		isRegistered = s.checkSignalRegistration(phoneNumber)
-		if isRegistered {
-			message = "Phone number is registered and ready"
-		} else {
-			message = "Phone number not registered with Signal CLI"
-		}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode status response", "error", err)
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
 	}
 
-	response := statusResponse{
-		IsRegistered: isRegistered,
-		PhoneNumber:  phoneNumber,
-		Message:      message,
+	slog.InfoContext(r.Context(), "Successfully returned Signal status", "isRegistered", response.IsRegistered)
+}
+
+// handleSignalAccounts handles GET /api/signal/accounts, the registration
+// and listener state of every account including connection errors.
+func (s *Server) handleSignalAccounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		slog.ErrorContext(r.Context(), "Failed to encode status response", "error", err)
-		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"accounts": s.signalAccounts()}); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode accounts response", "error", err)
+	}
+}
+
+// handleAIProviders handles GET /api/ai/providers, the circuit state of every
+// AI provider of the fallback chain including its last error.
+func (s *Server) handleAIProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	slog.InfoContext(r.Context(), "Successfully returned Signal status", "isRegistered", isRegistered)
+	providers := []ai.ProviderHealth{}
+	if s.providerHealth != nil {
+		providers = s.providerHealth.ProviderHealth()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"providers": providers}); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode providers response", "error", err)
+	}
 }
 
 // handleSignalQrCode proxies QR code requests to Signal CLI with security enhancements
@@ -1002,6 +1207,35 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		"service":   "summarizarr",
 	}
 
+	// A disconnected listener degrades the service but the process stays up and
+	// keeps reconnecting, so the endpoint still answers 200 for container checks.
+	// The route is public: accounts and errors are on /api/signal/accounts.
+	if len(s.signalStatus) > 0 {
+		listeners := make([]*listenerState, 0, len(s.signalStatus))
+		for _, provider := range s.signalStatus {
+			listener := provider.Status()
+			if !listener.Connected {
+				response["status"] = "degraded"
+			}
+			listeners = append(listeners, publicListener(listener))
+		}
+		response["signal"] = listeners[0]
+		response["signalAccounts"] = listeners
+	}
+
+	// Summaries fall back to the next provider while one is skipped. Models
+	// and errors are on /api/ai/providers.
+	if s.providerHealth != nil {
+		var providers []map[string]string
+		for _, provider := range s.providerHealth.ProviderHealth() {
+			if provider.State != ai.CircuitClosed {
+				response["status"] = "degraded"
+			}
+			providers = append(providers, map[string]string{"provider": provider.Provider, "state": provider.State})
+		}
+		response["aiProviders"] = providers
+	}
+
 	// Encode response to JSON first
 	responseData, err := json.Marshal(response)
 	if err != nil {
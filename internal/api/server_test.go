@@ -11,6 +11,9 @@ import (
 	"testing"
 	"time"
 
+	"summarizarr/internal/ai"
+	"summarizarr/internal/signal"
+
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -74,6 +77,11 @@ func TestGetSummariesEndpoint(t *testing.T) {
 		start_timestamp INTEGER,
 		end_timestamp INTEGER,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		delivery_status TEXT,
+		delivery_error TEXT,
+		prompt_tokens INTEGER,
+		completion_tokens INTEGER,
+		provider TEXT,
 		FOREIGN KEY (group_id) REFERENCES groups (id)
 	);
 	`
@@ -239,6 +247,11 @@ func TestGetSummariesEmpty(t *testing.T) {
 		start_timestamp INTEGER,
 		end_timestamp INTEGER,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		delivery_status TEXT,
+		delivery_error TEXT,
+		prompt_tokens INTEGER,
+		completion_tokens INTEGER,
+		provider TEXT,
 		FOREIGN KEY (group_id) REFERENCES groups (id)
 	);
 	`
@@ -821,3 +834,134 @@ func TestMain(m *testing.M) {
 	code := m.Run()
 	os.Exit(code)
 }
+
+// fixedStatus is a SignalStatusProvider with a constant state
+type fixedStatus signal.Status
+
+func (f fixedStatus) Status() signal.Status { return signal.Status(f) }
+
+func TestHandleSignalAccounts_PerAccount(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/accounts" {
+			_, _ = w.Write([]byte(`["+15550000001"]`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+	t.Setenv("SIGNAL_URL", mockServer.URL[7:])
+	t.Setenv("SIGNAL_PHONE_NUMBER", "+15550000001, +15550000002")
+
+	testDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	defer func() { _ = testDB.Close() }()
+
+	server := NewServerWithOptions(":8080", testDB, nil, WithSignalStatus(
+		fixedStatus{Account: "+15550000001", Connected: true, LastMessageAt: time.Unix(1700000000, 0)},
+		fixedStatus{Account: "+15550000002", Connected: false, Reconnecting: true, LastError: "dial tcp: connection refused"},
+	))
+
+	// The public status only describes the first account
+	w := httptest.NewRecorder()
+	server.handleSignalStatus(w, httptest.NewRequest(http.MethodGet, "/api/signal/status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var public map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&public); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if public["isRegistered"] != true || public["phoneNumber"] != "+15550000001" || public["accounts"] != nil {
+		t.Errorf("Expected only the first account, got %v", public)
+	}
+	listener, _ := public["listener"].(map[string]interface{})
+	if listener == nil || listener["connected"] != true || listener["reconnectCount"] == nil || listener["account"] != nil || listener["lastError"] != nil {
+		t.Errorf("Expected the listener state without account details, got %v", public["listener"])
+	}
+
+	w = httptest.NewRecorder()
+	server.handleSignalAccounts(w, httptest.NewRequest(http.MethodGet, "/api/signal/accounts", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Accounts []struct {
+			IsRegistered bool           `json:"isRegistered"`
+			PhoneNumber  string         `json:"phoneNumber"`
+			Listener     *signal.Status `json:"listener"`
+		} `json:"accounts"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Accounts) != 2 {
+		t.Fatalf("Expected 2 accounts, got %d", len(response.Accounts))
+	}
+	second := response.Accounts[1]
+	if second.IsRegistered || second.Listener == nil || second.Listener.Connected || !second.Listener.Reconnecting || second.Listener.LastError == "" {
+		t.Errorf("Unexpected status for second account: %+v", second)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleHealth(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var health struct {
+		Status         string                   `json:"status"`
+		Signal         map[string]interface{}   `json:"signal"`
+		SignalAccounts []map[string]interface{} `json:"signalAccounts"`
+	}
+	body := w.Body.String()
+	if err := json.Unmarshal([]byte(body), &health); err != nil {
+		t.Fatalf("Failed to decode health: %v", err)
+	}
+	if health.Status != "degraded" || health.Signal["connected"] != true || health.Signal["lastMessageAt"] == nil ||
+		len(health.SignalAccounts) != 2 || health.SignalAccounts[1]["reconnecting"] != true || health.SignalAccounts[1]["reconnectCount"] == nil {
+		t.Errorf("Expected degraded health with the listener states, got %s", body)
+	}
+	if strings.Contains(body, "+1555") || strings.Contains(body, "refused") || strings.Contains(body, `"account"`) || strings.Contains(body, "lastError") {
+		t.Errorf("Expected no account details on health, got %s", body)
+	}
+}
+
+type fixedProviderHealth []ai.ProviderHealth
+
+func (f fixedProviderHealth) ProviderHealth() []ai.ProviderHealth { return f }
+
+func TestHealth_ReportsProviderCircuits(t *testing.T) {
+	server := &Server{providerHealth: fixedProviderHealth{
+		{Provider: "openai", State: ai.CircuitClosed},
+		{Provider: "local", State: ai.CircuitClosed},
+	}}
+	w := httptest.NewRecorder()
+	server.handleHealth(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var response struct {
+		Status      string              `json:"status"`
+		AIProviders []ai.ProviderHealth `json:"aiProviders"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Status != "healthy" || len(response.AIProviders) != 2 || response.AIProviders[1].Provider != "local" {
+		t.Errorf("Unexpected health: %+v", response)
+	}
+
+	// A provider that is skipped degrades the service, summaries still fall back
+	server.providerHealth = fixedProviderHealth{
+		{Provider: "openai", State: ai.CircuitOpen, ConsecutiveFailures: 3, LastError: "503 Service Unavailable"},
+		{Provider: "local", State: ai.CircuitClosed},
+	}
+	w = httptest.NewRecorder()
+	server.handleHealth(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, `"status":"degraded"`) ||
+		!strings.Contains(body, `{"provider":"openai","state":"open"}`) || strings.Contains(body, "503") {
+		t.Errorf("Expected degraded health with the open circuit and no error, got %d %s", w.Code, body)
+	}
+
+	// Errors are only on the authenticated route
+	w = httptest.NewRecorder()
+	server.handleAIProviders(w, httptest.NewRequest(http.MethodGet, "/api/ai/providers", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"lastError":"503 Service Unavailable"`) {
+		t.Errorf("Expected the provider details, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"summarizarr/internal/ai"
+	"summarizarr/internal/database"
+)
+
+const (
+	// maxPromptLength bounds a custom prompt
+	maxPromptLength = 4000
+	// maxJobWait bounds how long GET /api/jobs/{id}?wait= holds a request
+	maxJobWait = 60 * time.Second
+	// jobWaitInterval is how often a waiting request checks the job
+	jobWaitInterval = 500 * time.Millisecond
+)
+
+// SummaryQueue queues summaries requested outside the schedule.
+type SummaryQueue interface {
+	EnqueueSummary(req database.SummaryRequest) (int64, error)
+}
+
+// handleSummaries handles GET and POST /api/summaries.
+func (s *Server) handleSummaries(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.handleGetSummaries(w, r)
+	case http.MethodPost:
+		s.handleCreateSummary(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSummaryRoutes dispatches /api/summaries/{id}[/{resource}] requests.
+func (s *Server) handleSummaryRoutes(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/summaries/")
+	idStr, resource, _ := strings.Cut(rest, "/")
+	summaryID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || summaryID <= 0 {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	switch resource {
+	case "":
+		s.handleDeleteSummary(w, r)
+	case "regenerate":
+		s.handleRegenerateSummary(w, r, summaryID)
+	case "history":
+		s.handleSummaryHistory(w, r, summaryID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// summaryOverrides is the provider and prompt a summary may be requested
+// with.
+type summaryOverrides struct {
+	Provider string `json:"provider"`
+	Prompt   string `json:"prompt"`
+}
+
+func (o *summaryOverrides) validate() error {
+	o.Provider = strings.ToLower(strings.TrimSpace(o.Provider))
+	o.Prompt = strings.TrimSpace(o.Prompt)
+	if len(o.Prompt) > maxPromptLength {
+		return fmt.Errorf("prompt must be at most %d characters", maxPromptLength)
+	}
+	return nil
+}
+
+// handleCreateSummary handles POST /api/summaries, which summarizes a group
+// over a time range. The summary is generated in the background, the
+// response holds the job to follow on /api/jobs/{id}.
+func (s *Server) handleCreateSummary(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		GroupID int64     `json:"groupId"`
+		Start   time.Time `json:"start"`
+		End     time.Time `json:"end"`
+		summaryOverrides
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.GroupID <= 0 {
+		http.Error(w, "groupId is required", http.StatusBadRequest)
+		return
+	}
+	if req.End.IsZero() || req.End.After(time.Now()) {
+		req.End = time.Now()
+	}
+	if req.Start.IsZero() || !req.Start.Before(req.End) {
+		http.Error(w, "start must be before end", http.StatusBadRequest)
+		return
+	}
+	if err := req.summaryOverrides.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.enqueueSummary(w, r, database.SummaryRequest{
+		GroupID:  req.GroupID,
+		Start:    req.Start.UnixMilli(),
+		End:      req.End.UnixMilli(),
+		Provider: req.Provider,
+		Prompt:   req.Prompt,
+	})
+}
+
+// handleRegenerateSummary handles POST /api/summaries/{id}/regenerate. The
+// new text replaces the summary once generated, the previous one is kept in
+// its history.
+func (s *Server) handleRegenerateSummary(w http.ResponseWriter, r *http.Request, summaryID int64) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req summaryOverrides
+	// The body is optional
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.enqueueSummary(w, r, database.SummaryRequest{SummaryID: summaryID, Provider: req.Provider, Prompt: req.Prompt})
+}
+
+func (s *Server) enqueueSummary(w http.ResponseWriter, r *http.Request, req database.SummaryRequest) {
+	if s.summaryQueue == nil {
+		http.Error(w, "summarization is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	jobID, err := s.summaryQueue.EnqueueSummary(req)
+	switch {
+	case errors.Is(err, database.ErrGroupNotFound):
+		http.Error(w, "group not found", http.StatusNotFound)
+		return
+	case errors.Is(err, database.ErrSummaryNotFound):
+		http.Error(w, "summary not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ai.ErrProviderUnavailable):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, ai.ErrBudgetExceeded):
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "Failed to queue summary", "error", err, "group_id", req.GroupID, "summary_id", req.SummaryID)
+		http.Error(w, "failed to queue summary", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Queued summary", "job_id", jobID, "group_id", req.GroupID, "summary_id", req.SummaryID)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/api/jobs/%d", jobID))
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(map[string]int64{"jobId": jobID}); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write summary job response", "error", err)
+	}
+}
+
+// handleSummaryHistory handles GET /api/summaries/{id}/history, the earlier
+// versions of a regenerated summary.
+func (s *Server) handleSummaryHistory(w http.ResponseWriter, r *http.Request, summaryID int64) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	versions, err := s.db.GetSummaryHistory(summaryID)
+	if err != nil {
+		if errors.Is(err, database.ErrSummaryNotFound) {
+			http.Error(w, "summary not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to get summary history", "error", err, "summary_id", summaryID)
+		http.Error(w, "failed to get summary history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(versions); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write summary history response", "error", err)
+	}
+}
+
+// handleGetJob handles GET /api/jobs/{id}. With ?wait= set to a duration
+// such as "30s", the response is held until the job is done or failed, or
+// the duration has passed.
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	jobID, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), 10, 64)
+	if err != nil || jobID <= 0 {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+	var wait time.Duration
+	if waitStr := r.URL.Query().Get("wait"); waitStr != "" {
+		if wait, err = time.ParseDuration(waitStr); err != nil || wait < 0 {
+			http.Error(w, "invalid wait duration", http.StatusBadRequest)
+			return
+		}
+		wait = min(wait, maxJobWait)
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		job, err := s.db.GetSummaryJob(jobID)
+		if err != nil {
+			if errors.Is(err, database.ErrJobNotFound) {
+				http.Error(w, "job not found", http.StatusNotFound)
+				return
+			}
+			slog.ErrorContext(r.Context(), "Failed to get summary job", "error", err, "job_id", jobID)
+			http.Error(w, "failed to get job", http.StatusInternalServerError)
+			return
+		}
+
+		finished := job.State == database.JobDone || job.State == database.JobFailed
+		if finished || !time.Now().Before(deadline) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			if err := json.NewEncoder(w).Encode(job); err != nil {
+				slog.ErrorContext(r.Context(), "Failed to write job response", "error", err)
+			}
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(min(jobWaitInterval, time.Until(deadline))):
+		}
+	}
+}
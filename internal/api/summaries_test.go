@@ -0,0 +1,218 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"summarizarr/internal/database"
+)
+
+// queueDB queues requested summaries in the database without running them
+type queueDB struct {
+	db       *database.DB
+	requests []database.SummaryRequest
+}
+
+func (q *queueDB) EnqueueSummary(req database.SummaryRequest) (int64, error) {
+	q.requests = append(q.requests, req)
+	return q.db.EnqueueSummaryRequest(req)
+}
+
+func newSummaryRoutesTestServer(t *testing.T) (*Server, *queueDB) {
+	t.Helper()
+	testDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	testDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = testDB.Close() })
+
+	schema := `
+	CREATE TABLE groups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		group_id TEXT UNIQUE,
+		name TEXT,
+		summarized_until INTEGER
+	);
+	CREATE TABLE summaries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		group_id INTEGER NOT NULL,
+		summary_text TEXT,
+		start_timestamp INTEGER,
+		end_timestamp INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		prompt_tokens INTEGER,
+		completion_tokens INTEGER,
+		provider TEXT
+	);
+	CREATE TABLE summary_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		summary_id INTEGER NOT NULL,
+		summary_text TEXT,
+		created_at DATETIME,
+		replaced_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE summary_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL DEFAULT 'scheduled',
+		group_id INTEGER NOT NULL,
+		start_timestamp INTEGER NOT NULL,
+		end_timestamp INTEGER NOT NULL,
+		deliver BOOLEAN NOT NULL DEFAULT FALSE,
+		provider TEXT,
+		prompt TEXT,
+		state TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		run_after INTEGER NOT NULL DEFAULT 0,
+		summary_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE llm_calls (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		group_id INTEGER,
+		job_id INTEGER,
+		summary_id INTEGER,
+		provider TEXT NOT NULL,
+		model TEXT,
+		prompt_tokens INTEGER NOT NULL DEFAULT 0,
+		completion_tokens INTEGER NOT NULL DEFAULT 0,
+		cost REAL NOT NULL DEFAULT 0,
+		latency_ms INTEGER NOT NULL DEFAULT 0,
+		error TEXT,
+		created_at INTEGER NOT NULL
+	);
+	INSERT INTO groups (id, group_id, name) VALUES (1, 'test-group-1', 'Weekend Plans');
+	INSERT INTO summaries (id, group_id, summary_text, start_timestamp, end_timestamp) VALUES (7, 1, 'current', 1000, 2000);
+	INSERT INTO summary_history (summary_id, summary_text, created_at) VALUES (7, 'first', '2024-03-01 10:00:00');
+	`
+	if _, err := testDB.Exec(schema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	queue := &queueDB{db: &database.DB{DB: testDB}}
+	return NewServerWithOptions(":8080", testDB, nil, WithSignalValidation(false), WithSummaryQueue(queue)), queue
+}
+
+func TestCreateSummaryEndpoint(t *testing.T) {
+	server, queue := newSummaryRoutesTestServer(t)
+
+	body := `{"groupId":1,"start":"2024-03-01T00:00:00Z","end":"2024-03-02T00:00:00Z","provider":" OpenAI ","prompt":"List the jokes."}`
+	w := httptest.NewRecorder()
+	server.handleSummaries(w, httptest.NewRequest(http.MethodPost, "/api/summaries", strings.NewReader(body)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		JobID int64 `json:"jobId"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.JobID == 0 {
+		t.Fatalf("Expected a job id, got %+v %v", resp, err)
+	}
+	if location := w.Header().Get("Location"); location != "/api/jobs/1" {
+		t.Errorf("Expected the job location, got %q", location)
+	}
+	expected := database.SummaryRequest{GroupID: 1, Start: 1709251200000, End: 1709337600000, Provider: "openai", Prompt: "List the jokes."}
+	if len(queue.requests) != 1 || queue.requests[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, queue.requests)
+	}
+
+	for _, tt := range []struct {
+		body   string
+		status int
+	}{
+		{`{"groupId":1,"start":"2024-03-02T00:00:00Z","end":"2024-03-01T00:00:00Z"}`, http.StatusBadRequest},
+		{`{"groupId":1}`, http.StatusBadRequest},
+		{`{"groupId":1,"start":"2024-03-01T00:00:00Z","prompt":"` + strings.Repeat("x", maxPromptLength+1) + `"}`, http.StatusBadRequest},
+		{`{"groupId":42,"start":"2024-03-01T00:00:00Z"}`, http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		server.handleSummaries(w, httptest.NewRequest(http.MethodPost, "/api/summaries", strings.NewReader(tt.body)))
+		if w.Code != tt.status {
+			t.Errorf("%.60s: expected status %d, got %d", tt.body, tt.status, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	server.summaryQueue = nil
+	server.handleSummaries(w, httptest.NewRequest(http.MethodPost, "/api/summaries", strings.NewReader(body)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 without a queue, got %d", w.Code)
+	}
+}
+
+func TestRegenerateSummaryEndpoint(t *testing.T) {
+	server, queue := newSummaryRoutesTestServer(t)
+
+	w := httptest.NewRecorder()
+	server.handleSummaryRoutes(w, httptest.NewRequest(http.MethodPost, "/api/summaries/7/regenerate", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if len(queue.requests) != 1 || queue.requests[0].SummaryID != 7 {
+		t.Errorf("Expected summary 7 to be regenerated, got %+v", queue.requests)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleSummaryRoutes(w, httptest.NewRequest(http.MethodPost, "/api/summaries/8/regenerate", strings.NewReader(`{"prompt":"Shorter"}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown summary, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleSummaryRoutes(w, httptest.NewRequest(http.MethodGet, "/api/summaries/7/history", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var versions []database.SummaryVersion
+	if err := json.NewDecoder(w.Body).Decode(&versions); err != nil || len(versions) != 1 || versions[0].Text != "first" {
+		t.Errorf("Expected the earlier version, got %+v %v", versions, err)
+	}
+}
+
+func TestGetJobEndpoint(t *testing.T) {
+	server, _ := newSummaryRoutesTestServer(t)
+	jobID, err := server.db.EnqueueSummaryRequest(database.SummaryRequest{GroupID: 1, Start: 1000, End: 2000})
+	if err != nil {
+		t.Fatalf("EnqueueSummaryRequest failed: %v", err)
+	}
+
+	// A pending job is returned once the wait is over
+	started := time.Now()
+	w := httptest.NewRecorder()
+	server.handleGetJob(w, httptest.NewRequest(http.MethodGet, "/api/jobs/1?wait=50ms", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var job database.SummaryJob
+	if err := json.NewDecoder(w.Body).Decode(&job); err != nil || job.ID != jobID || job.State != database.JobPending || job.Kind != database.JobManual {
+		t.Errorf("Expected the pending job, got %+v %v", job, err)
+	}
+	if elapsed := time.Since(started); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the request to wait, returned after %s", elapsed)
+	}
+
+	if _, err := server.db.ClaimSummaryJob(0); err != nil {
+		t.Fatalf("ClaimSummaryJob failed: %v", err)
+	}
+	if _, err := server.db.CompleteSummaryJob(jobID, database.SummaryResult{Text: "summary"}); err != nil {
+		t.Fatalf("CompleteSummaryJob failed: %v", err)
+	}
+	w = httptest.NewRecorder()
+	server.handleGetJob(w, httptest.NewRequest(http.MethodGet, "/api/jobs/1?wait=10s", nil))
+	if err := json.NewDecoder(w.Body).Decode(&job); err != nil || job.State != database.JobDone || job.SummaryID == 0 {
+		t.Errorf("Expected the finished job, got %+v %v", job, err)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleGetJob(w, httptest.NewRequest(http.MethodGet, "/api/jobs/42", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown job, got %d", w.Code)
+	}
+}
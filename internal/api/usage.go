@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"summarizarr/internal/ai"
+	"summarizarr/internal/database"
+)
+
+// usageResponse is the usage of AI providers over a range of UTC days.
+type usageResponse struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	database.LLMUsage
+	// Budget is null without MONTHLY_BUDGET_USD
+	Budget *budgetResponse `json:"budget"`
+}
+
+// budgetResponse is the spend of the current month against the budget.
+type budgetResponse struct {
+	Monthly float64   `json:"monthly"`
+	Spent   float64   `json:"spent"`
+	Resets  time.Time `json:"resets"`
+	// Paused is true while cloud providers are not called
+	Paused bool `json:"paused"`
+}
+
+// handleGetUsage handles GET /api/usage, the tokens and cost of calls to AI
+// providers per group and per day. ?start= and ?end= are inclusive UTC days
+// like 2024-03-01 and default to the current month.
+func (s *Server) handleGetUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now().UTC()
+	monthStart := ai.BudgetPeriodStart(now)
+	start := monthStart
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	var err error
+	if v := r.URL.Query().Get("start"); v != "" {
+		if start, err = time.Parse(time.DateOnly, v); err != nil {
+			http.Error(w, "invalid start date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("end"); v != "" {
+		if end, err = time.Parse(time.DateOnly, v); err != nil {
+			http.Error(w, "invalid end date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		end = end.AddDate(0, 0, 1)
+	}
+	if !start.Before(end) {
+		http.Error(w, "start must not be after end", http.StatusBadRequest)
+		return
+	}
+
+	usage, err := s.db.GetLLMUsage(start.UnixMilli(), end.UnixMilli())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to get usage", "error", err)
+		http.Error(w, "failed to get usage", http.StatusInternalServerError)
+		return
+	}
+	resp := usageResponse{Start: start, End: end, LLMUsage: usage}
+
+	if s.monthlyBudget > 0 {
+		spent, err := s.db.LLMCostSince(monthStart.UnixMilli())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to get monthly spend", "error", err)
+			http.Error(w, "failed to get usage", http.StatusInternalServerError)
+			return
+		}
+		resp.Budget = &budgetResponse{
+			Monthly: s.monthlyBudget,
+			Spent:   spent,
+			Resets:  monthStart.AddDate(0, 1, 0),
+			Paused:  spent >= s.monthlyBudget,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to write usage response", "error", err)
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"summarizarr/internal/database"
+)
+
+func TestGetUsageEndpoint(t *testing.T) {
+	server, _ := newSummaryRoutesTestServer(t)
+	now := time.Now().UnixMilli()
+	march := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC).UnixMilli()
+	for _, call := range []database.LLMCall{
+		{GroupID: 1, Provider: "openai", Model: "gpt-4o-mini", PromptTokens: 1000, CompletionTokens: 100, Cost: 1.5, CreatedAt: march},
+		{GroupID: 1, Provider: "openai", Model: "gpt-4o-mini", PromptTokens: 500, CompletionTokens: 50, Cost: 12, CreatedAt: now},
+	} {
+		if err := server.db.RecordLLMCall(call); err != nil {
+			t.Fatalf("RecordLLMCall failed: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	server.handleGetUsage(w, httptest.NewRequest(http.MethodGet, "/api/usage?start=2024-03-01&end=2024-03-31", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var resp usageResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Total.Calls != 1 || resp.Total.Cost != 1.5 || len(resp.Groups) != 1 || resp.Groups[0].GroupName != "Weekend Plans" ||
+		len(resp.Days) != 1 || resp.Days[0].Day != "2024-03-01" || resp.Budget != nil {
+		t.Errorf("Unexpected usage: %+v", resp)
+	}
+
+	// Without a range the current month is reported with the budget
+	server.monthlyBudget = 10
+	w = httptest.NewRecorder()
+	server.handleGetUsage(w, httptest.NewRequest(http.MethodGet, "/api/usage", nil))
+	resp = usageResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Total.Calls != 1 || resp.Total.Cost != 12 {
+		t.Errorf("Expected the calls of this month, got %+v", resp.Total)
+	}
+	if resp.Budget == nil || resp.Budget.Spent != 12 || !resp.Budget.Paused || resp.Budget.Resets.Day() != 1 {
+		t.Errorf("Expected the budget to be used up, got %+v", resp.Budget)
+	}
+
+	for _, query := range []string{"start=yesterday", "start=2024-03-02&end=2024-03-01"} {
+		w := httptest.NewRecorder()
+		server.handleGetUsage(w, httptest.NewRequest(http.MethodGet, "/api/usage?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package bot implements the in-chat commands that summarize a group on
+// demand.
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"summarizarr/internal/database"
+	"summarizarr/internal/signal"
+)
+
+const (
+	// defaultWindow is summarized when a command names no time range
+	defaultWindow = 24 * time.Hour
+	// maxWindow bounds the conversation sent to the LLM by a single command
+	maxWindow = 7 * 24 * time.Hour
+
+	actionItemsHeader = "## Action items or next steps"
+)
+
+var windowPattern = regexp.MustCompile(`^(\d+)([mhdw])$`)
+
+// DB is the interface for the database.
+type DB interface {
+	FindGroupID(signalGroupID string) (int64, error)
+	GetMessagesForSummarization(groupID int64, start, end int64) ([]database.MessageForSummary, error)
+}
+
+// Summarizer turns messages into a markdown summary.
+type Summarizer interface {
+	Summarize(ctx context.Context, messages []database.MessageForSummary) (string, error)
+}
+
+// Commands answers !summary and !actions.
+type Commands struct {
+	db         DB
+	summarizer Summarizer
+	prefix     string
+	now        func() time.Time
+}
+
+// New creates the command handlers. prefix is only used in usage hints.
+func New(db DB, summarizer Summarizer, prefix string) *Commands {
+	return &Commands{db: db, summarizer: summarizer, prefix: prefix, now: time.Now}
+}
+
+// Register adds the commands to a router.
+func (c *Commands) Register(router *signal.CommandRouter) {
+	router.Handle("summary", c.Summary)
+	router.Handle("actions", c.Actions)
+}
+
+// Summary summarizes the group over the requested window, e.g. "6h" or
+// "since yesterday".
+func (c *Commands) Summary(ctx context.Context, cmd signal.Command) (string, error) {
+	summary, label, err := c.summarize(ctx, cmd)
+	if err != nil || summary == "" {
+		return label, err
+	}
+	return "**Summary of " + label + "**\n\n" + summary, nil
+}
+
+// Actions replies with only the action items of the summary.
+func (c *Commands) Actions(ctx context.Context, cmd signal.Command) (string, error) {
+	summary, label, err := c.summarize(ctx, cmd)
+	if err != nil || summary == "" {
+		return label, err
+	}
+	items := actionItems(summary)
+	if items == "" {
+		return "No action items in " + label + ".", nil
+	}
+	return "**Action items from " + label + "**\n\n" + items, nil
+}
+
+// summarize returns the summary and a label of the window. When there is
+// nothing to summarize, the summary is empty and the label is the reply.
+func (c *Commands) summarize(ctx context.Context, cmd signal.Command) (string, string, error) {
+	now := c.now()
+	start, label, err := parseWindow(cmd.Args, now)
+	if err != nil {
+		return "", fmt.Sprintf("%s. Try %s%s 6h, %s%s 2d or %s%s since yesterday.",
+			err, c.prefix, cmd.Name, c.prefix, cmd.Name, c.prefix, cmd.Name), nil
+	}
+
+	groupID, err := c.db.FindGroupID(cmd.GroupID)
+	if errors.Is(err, database.ErrGroupNotFound) {
+		return "", "No messages to summarize yet.", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	messages, err := c.db.GetMessagesForSummarization(groupID, start.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return "", "", err
+	}
+	if len(messages) == 0 {
+		return "", "No messages in " + label + ".", nil
+	}
+
+	summary, err := c.summarizer.Summarize(ctx, messages)
+	if err != nil {
+		return "", "", err
+	}
+	return summary, label, nil
+}
+
+// parseWindow turns command arguments into the start of the summarized
+// window: a duration such as 30m, 6h, 2d or 1w, or "since yesterday",
+// "since today" or "since 14:00".
+func parseWindow(args []string, now time.Time) (time.Time, string, error) {
+	if len(args) == 0 {
+		return now.Add(-defaultWindow), "the last 24h", nil
+	}
+
+	arg := strings.ToLower(strings.Join(args, " "))
+	since := strings.TrimPrefix(arg, "since ")
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	switch since {
+	case "today":
+		return midnight, "today", nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), "yesterday and today", nil
+	}
+	if t, err := time.ParseInLocation("15:04", since, now.Location()); err == nil {
+		start := midnight.Add(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute)
+		if start.After(now) {
+			start = start.AddDate(0, 0, -1)
+		}
+		return start, "the messages since " + since, nil
+	}
+
+	m := windowPattern.FindStringSubmatch(arg)
+	if m == nil {
+		return time.Time{}, "", fmt.Errorf("I don't understand %q", arg)
+	}
+	n, _ := strconv.Atoi(m[1])
+	unit := map[string]time.Duration{"m": time.Minute, "h": time.Hour, "d": 24 * time.Hour, "w": 7 * 24 * time.Hour}[m[2]]
+	window := time.Duration(n) * unit
+	if window <= 0 {
+		return time.Time{}, "", fmt.Errorf("%q is not a time range", arg)
+	}
+	if window > maxWindow {
+		return time.Time{}, "", errors.New("I can summarize at most one week")
+	}
+	return now.Add(-window), "the last " + arg, nil
+}
+
+// actionItems extracts the bullet points of the action items section.
+func actionItems(summary string) string {
+	_, section, found := strings.Cut(summary, actionItemsHeader)
+	if !found {
+		return ""
+	}
+	if end := strings.Index(section, "\n## "); end >= 0 {
+		section = section[:end]
+	}
+
+	var items []string
+	for _, line := range strings.Split(section, "\n") {
+		line = strings.TrimSpace(line)
+		item := strings.TrimSpace(strings.TrimLeft(line, "-*•"))
+		// Models fill empty sections with placeholders
+		if item == "" || strings.EqualFold(strings.Trim(item, "."), "none") {
+			continue
+		}
+		items = append(items, "- "+item)
+	}
+	return strings.Join(items, "\n")
+}
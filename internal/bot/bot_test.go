@@ -0,0 +1,95 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"summarizarr/internal/database"
+	"summarizarr/internal/signal"
+)
+
+func TestParseWindow(t *testing.T) {
+	now := time.Date(2025, 3, 10, 15, 30, 0, 0, time.UTC)
+	tests := []struct {
+		args     string
+		expected time.Time
+	}{
+		{"", now.Add(-24 * time.Hour)},
+		{"6h", now.Add(-6 * time.Hour)},
+		{"2d", now.Add(-48 * time.Hour)},
+		{"since yesterday", time.Date(2025, 3, 9, 0, 0, 0, 0, time.UTC)},
+		{"today", time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)},
+		{"since 09:00", time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)},
+		{"since 18:00", time.Date(2025, 3, 9, 18, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		start, _, err := parseWindow(strings.Fields(tt.args), now)
+		if err != nil {
+			t.Errorf("parseWindow(%q) failed: %v", tt.args, err)
+			continue
+		}
+		if !start.Equal(tt.expected) {
+			t.Errorf("parseWindow(%q) = %s, expected %s", tt.args, start, tt.expected)
+		}
+	}
+
+	for _, args := range []string{"forever", "2w", "0h"} {
+		if _, _, err := parseWindow(strings.Fields(args), now); err == nil {
+			t.Errorf("parseWindow(%q) should fail", args)
+		}
+	}
+}
+
+type fakeDB struct {
+	messages []database.MessageForSummary
+	start    int64
+}
+
+func (f *fakeDB) FindGroupID(signalGroupID string) (int64, error) {
+	if signalGroupID != "group-1" {
+		return 0, database.ErrGroupNotFound
+	}
+	return 1, nil
+}
+
+func (f *fakeDB) GetMessagesForSummarization(groupID int64, start, end int64) ([]database.MessageForSummary, error) {
+	f.start = start
+	return f.messages, nil
+}
+
+type fakeSummarizer struct{}
+
+func (fakeSummarizer) Summarize(ctx context.Context, messages []database.MessageForSummary) (string, error) {
+	return "## Key topics discussed\n- Trip\n\n## Action items or next steps\n- Alice books the hotel\n- None\n\n## Notable reactions or responses\n- 👍", nil
+}
+
+func TestCommands(t *testing.T) {
+	db := &fakeDB{messages: []database.MessageForSummary{{Text: "hi"}}}
+	commands := New(db, fakeSummarizer{}, "!")
+
+	reply, err := commands.Actions(context.Background(), signal.Command{Name: "actions", GroupID: "group-1", Args: []string{"6h"}})
+	if err != nil {
+		t.Fatalf("Actions failed: %v", err)
+	}
+	if reply != "**Action items from the last 6h**\n\n- Alice books the hotel" {
+		t.Errorf("Unexpected reply: %q", reply)
+	}
+
+	reply, _ = commands.Summary(context.Background(), signal.Command{Name: "summary", GroupID: "group-1", Args: []string{"soon"}})
+	if !strings.Contains(reply, "!summary 6h") {
+		t.Errorf("Expected usage hint, got %q", reply)
+	}
+
+	reply, _ = commands.Summary(context.Background(), signal.Command{Name: "summary", GroupID: "unknown"})
+	if reply != "No messages to summarize yet." {
+		t.Errorf("Unexpected reply for unknown group: %q", reply)
+	}
+
+	db.messages = nil
+	reply, _ = commands.Summary(context.Background(), signal.Command{Name: "summary", GroupID: "group-1"})
+	if reply != "No messages in the last 24h." {
+		t.Errorf("Unexpected reply without messages: %q", reply)
+	}
+}
@@ -11,6 +11,7 @@ type Config struct {
 	LogLevel              slog.Level
 	ListenAddr            string
 	PhoneNumber           string
+	PhoneNumbers          []string // all Signal accounts, PhoneNumber is the first
 	SignalURL             string
 	DatabasePath          string
 	LocalModel            string
@@ -18,8 +19,56 @@ type Config struct {
 	OllamaHost            string
 	SummarizationInterval string
 
+	// Cron expression or interval for summaries, SummarizationInterval if empty
+	SummarizationSchedule string
+	// Time zone of schedules, e.g. Europe/Berlin
+	SummarizationTimeZone string
+
+	// Summaries generated at the same time, and retries of failed windows
+	SummaryWorkers      string
+	SummaryMaxAttempts  string
+	SummaryRetryBackoff string // delay before the first retry, doubled per attempt
+
+	// Windows with less activity are rolled into the next window, empty
+	// means no minimum
+	SummaryMinMessages     string
+	SummaryMinParticipants string
+	SummaryMinChars        string
+	// Daily period without summaries, e.g. 22:00-07:00
+	SummaryQuietHours string
+
+	// How messages are received from signal-cli: websocket, poll or jsonrpc
+	SignalReceiveMode  string
+	SignalPollInterval string
+	// signal-cli daemon address for jsonrpc mode: host:port or unix:/path
+	SignalJSONRPCAddr string
+
+	// Signal group ID that receives summaries of groups using the digest target
+	SummaryDigestGroup string
+
+	// In-chat commands such as !summary 6h (opt-in)
+	BotCommands         bool
+	BotCommandPrefix    string
+	BotCommandAllowlist []string // numbers or UUIDs, empty denies every command
+	BotCommandRateLimit string   // minimum time between commands per group
+
+	// Store and summarize 1:1 chats with the Signal number (opt-in)
+	DirectMessages bool
+
+	// Default handling of disappearing and view-once messages: respect, skip or keep
+	EphemeralPolicy string
+
 	// Generic provider configuration
-	AIProvider string
+	AIProvider  string
+	AIProviders []string // fallback order of providers, AIProvider is the first
+	// Context size of the model of AIProvider in tokens, the model default if empty
+	AIContextTokens string
+	// Context size local Ollama models are loaded with, the Ollama default if empty
+	LocalContextTokens string
+	// Prices of models in USD per million tokens, e.g. "gpt-4o-mini=0.15/0.60"
+	LLMPrices string
+	// Monthly spend on cloud providers in USD after which they are paused
+	MonthlyBudgetUSD string
 
 	// OpenAI configuration
 	OpenAIAPIKey  string
@@ -69,6 +118,31 @@ func New() *Config {
 		summarizationInterval = "12h" // default
 	}
 
+	summarizationTimeZone := os.Getenv("SUMMARIZATION_TIMEZONE")
+	if summarizationTimeZone == "" {
+		summarizationTimeZone = "Local" // default: the TZ of the container
+	}
+
+	summaryWorkers := os.Getenv("SUMMARY_WORKERS")
+	if summaryWorkers == "" {
+		summaryWorkers = "1" // default: one request at a time, which suits a local model
+	}
+
+	summaryMaxAttempts := os.Getenv("SUMMARY_MAX_ATTEMPTS")
+	if summaryMaxAttempts == "" {
+		summaryMaxAttempts = "5" // default
+	}
+
+	summaryRetryBackoff := os.Getenv("SUMMARY_RETRY_BACKOFF")
+	if summaryRetryBackoff == "" {
+		summaryRetryBackoff = "1m" // default
+	}
+
+	ephemeralPolicy := strings.ToLower(os.Getenv("EPHEMERAL_POLICY"))
+	if ephemeralPolicy == "" {
+		ephemeralPolicy = "respect" // default: purge disappearing messages when they expire
+	}
+
 	// rotation feature removed
 
 	signalURL := os.Getenv("SIGNAL_URL")
@@ -76,10 +150,31 @@ func New() *Config {
 		signalURL = "signal-cli-rest-api:8080" // default for Docker
 	}
 
+	signalReceiveMode := strings.ToLower(os.Getenv("SIGNAL_RECEIVE_MODE"))
+	if signalReceiveMode == "" {
+		signalReceiveMode = "websocket" // default: signal-cli-rest-api in json-rpc mode
+	}
+
+	signalPollInterval := os.Getenv("SIGNAL_POLL_INTERVAL")
+	if signalPollInterval == "" {
+		signalPollInterval = "5s" // default
+	}
+
+	botCommandPrefix := os.Getenv("BOT_COMMAND_PREFIX")
+	if botCommandPrefix == "" {
+		botCommandPrefix = "!" // default
+	}
+
+	botCommandRateLimit := os.Getenv("BOT_COMMAND_RATE_LIMIT")
+	if botCommandRateLimit == "" {
+		botCommandRateLimit = "5m" // default
+	}
+
 	// Provider configuration
-	aiProvider := os.Getenv("AI_PROVIDER")
-	if aiProvider == "" {
-		aiProvider = "local" // default to local Ollama
+	// AI_PROVIDER accepts a comma-separated list of providers tried in order
+	aiProviders := ParseList(strings.ToLower(os.Getenv("AI_PROVIDER")))
+	if len(aiProviders) == 0 {
+		aiProviders = []string{"local"} // default to local Ollama
 	}
 
 	// OpenAI configuration
@@ -131,18 +226,53 @@ func New() *Config {
 		listenAddr = ":8080" // default listen address (container healthcheck expects 8080)
 	}
 
+	// SIGNAL_PHONE_NUMBER accepts a comma-separated list of accounts
+	phoneNumbers := ParseList(os.Getenv("SIGNAL_PHONE_NUMBER"))
+	var phoneNumber string
+	if len(phoneNumbers) > 0 {
+		phoneNumber = phoneNumbers[0]
+	}
+
 	return &Config{
 		LogLevel:              parseLogLevel(os.Getenv("LOG_LEVEL")),
 		ListenAddr:            listenAddr,
-		PhoneNumber:           os.Getenv("SIGNAL_PHONE_NUMBER"),
+		PhoneNumber:           phoneNumber,
+		PhoneNumbers:          phoneNumbers,
 		SignalURL:             signalURL,
 		DatabasePath:          databasePath,
 		LocalModel:            localModel,
 		OllamaKeepAlive:       ollamaKeepAlive,
 		OllamaHost:            ollamaHost,
 		SummarizationInterval: summarizationInterval,
+		SummarizationSchedule: os.Getenv("SUMMARIZATION_SCHEDULE"),
+		SummarizationTimeZone: summarizationTimeZone,
+		SummaryWorkers:        summaryWorkers,
+		SummaryMaxAttempts:    summaryMaxAttempts,
+		SummaryRetryBackoff:   summaryRetryBackoff,
+		SignalReceiveMode:     signalReceiveMode,
+		SignalPollInterval:    signalPollInterval,
+		SignalJSONRPCAddr:     os.Getenv("SIGNAL_JSONRPC_ADDR"),
+		SummaryDigestGroup:    os.Getenv("SUMMARY_DIGEST_GROUP"),
+		BotCommands:           os.Getenv("BOT_COMMANDS") == "true",
+		BotCommandPrefix:      botCommandPrefix,
+		BotCommandAllowlist:   ParseList(os.Getenv("BOT_COMMAND_ALLOWLIST")),
+		BotCommandRateLimit:   botCommandRateLimit,
+		DirectMessages:        os.Getenv("DIRECT_MESSAGES") == "true",
+		EphemeralPolicy:       ephemeralPolicy,
 
-		AIProvider: aiProvider,
+		// Validated in validateConfig
+		SummaryMinMessages:     os.Getenv("SUMMARY_MIN_MESSAGES"),
+		SummaryMinParticipants: os.Getenv("SUMMARY_MIN_PARTICIPANTS"),
+		SummaryMinChars:        os.Getenv("SUMMARY_MIN_CHARS"),
+		SummaryQuietHours:      os.Getenv("SUMMARY_QUIET_HOURS"),
+
+		AIProvider:  aiProviders[0],
+		AIProviders: aiProviders,
+		// Validated in validateConfig
+		AIContextTokens:    os.Getenv("AI_CONTEXT_TOKENS"),
+		LocalContextTokens: os.Getenv("LOCAL_CONTEXT_TOKENS"),
+		LLMPrices:          os.Getenv("LLM_PRICES"),
+		MonthlyBudgetUSD:   os.Getenv("MONTHLY_BUDGET_USD"),
 
 		OpenAIAPIKey:  openaiAPIKey,
 		OpenAIModel:   openaiModel,
@@ -162,6 +292,22 @@ func New() *Config {
 	}
 }
 
+// ParseList splits a comma-separated list such as Signal accounts, dropping
+// blanks and duplicates.
+func ParseList(value string) []string {
+	var numbers []string
+	seen := make(map[string]bool)
+	for _, n := range strings.Split(value, ",") {
+		n = strings.TrimSpace(n)
+		if n == "" || seen[n] {
+			continue
+		}
+		seen[n] = true
+		numbers = append(numbers, n)
+	}
+	return numbers
+}
+
 func parseLogLevel(levelStr string) slog.Level {
 	switch strings.ToUpper(levelStr) {
 	case "DEBUG":
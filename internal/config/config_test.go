@@ -0,0 +1,20 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseList(t *testing.T) {
+	tests := map[string][]string{
+		"":                          nil,
+		"+15550000001":              {"+15550000001"},
+		" +15550000001 , +15550002": {"+15550000001", "+15550002"},
+		"+1,,+2,+1":                 {"+1", "+2"},
+	}
+	for input, expected := range tests {
+		if got := ParseList(input); !reflect.DeepEqual(got, expected) {
+			t.Errorf("ParseList(%q) = %v, expected %v", input, got, expected)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"summarizarr/internal/signal"
+)
+
+// Conversation types stored in groups.type.
+const (
+	ConversationGroup  = "group"
+	ConversationDirect = "direct"
+)
+
+// DirectConversationPrefix namespaces synthetic group IDs of 1:1 chats so they
+// never collide with real Signal group IDs.
+const DirectConversationPrefix = "direct:"
+
+// DirectConversationID returns the synthetic group ID of the 1:1 chat between
+// an account and a contact. Each account has its own chat with a contact.
+func DirectConversationID(account, contact string) string {
+	if account == "" {
+		return DirectConversationPrefix + contact
+	}
+	return DirectConversationPrefix + account + ":" + contact
+}
+
+// DirectConversationContact returns the contact of a direct conversation ID.
+func DirectConversationContact(groupID string) string {
+	id := strings.TrimPrefix(groupID, DirectConversationPrefix)
+	return id[strings.LastIndex(id, ":")+1:]
+}
+
+// directConversation maps a 1:1 message to its synthetic per-contact
+// conversation. It returns nil when direct messages are disabled or the
+// envelope is not a direct message with content. The returned name is only
+// used when the conversation is first created: messages we sent do not carry
+// the contact's profile name, so it must not trigger a rename.
+func (db *DB) directConversation(msg *signal.Envelope) (*signal.GroupInfo, string, error) {
+	if !db.StoreDirectMessages {
+		return nil, "", nil
+	}
+
+	if d := msg.DataMessage; d != nil && d.GroupInfo == nil {
+		if msg.SourceUUID == "" || !hasContent(d.Message, d.Attachments, d.Reaction) {
+			return nil, "", nil
+		}
+		return &signal.GroupInfo{
+			GroupID:   DirectConversationID(msg.Account, msg.SourceUUID),
+			GroupName: msg.SourceName,
+		}, msg.DisplayName(), nil
+	}
+
+	if msg.SyncMessage != nil && msg.SyncMessage.SentMessage != nil {
+		sent := msg.SyncMessage.SentMessage
+		if sent.GroupInfo != nil || !hasContent(sent.Message, sent.Attachments, sent.Reaction) {
+			return nil, "", nil
+		}
+		number := sent.DestinationNumber
+		if number == "" {
+			number = sent.Destination
+		}
+		contact := sent.DestinationUUID
+		if contact == "" {
+			// Older signal-cli versions only report the destination number.
+			// Conversations are keyed by UUID, so it has to be known already.
+			uuid, err := db.contactUUID(number)
+			if err != nil {
+				return nil, "", err
+			}
+			if uuid == "" {
+				slog.Debug("Skipping sent direct message to a contact without a known UUID", "timestamp", msg.Timestamp)
+				return nil, "", nil
+			}
+			contact = uuid
+		}
+		return &signal.GroupInfo{GroupID: DirectConversationID(msg.Account, contact)}, number, nil
+	}
+
+	return nil, "", nil
+}
+
+// contactUUID returns the UUID of the user with a phone number, or "" if no
+// user with that number and a UUID was seen yet.
+func (db *DB) contactUUID(number string) (string, error) {
+	if number == "" {
+		return "", nil
+	}
+	var uuid string
+	err := db.QueryRow("SELECT uuid FROM users WHERE number = ? AND uuid IS NOT NULL AND uuid != '' ORDER BY id LIMIT 1", number).Scan(&uuid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up contact: %w", err)
+	}
+	return uuid, nil
+}
+
+// hasContent reports whether a message is worth storing. 1:1 envelopes
+// without text, media or a reaction are profile key updates and the like.
+func hasContent(text string, attachments []signal.Attachment, reaction *signal.Reaction) bool {
+	return text != "" || len(attachments) > 0 || reaction != nil
+}
+
+// rekeyDirectConversations moves direct conversations stored before they were
+// keyed by account to the key of the account that received them.
+func (db *DB) rekeyDirectConversations() error {
+	res, err := db.Exec(`
+		UPDATE groups SET group_id = 'direct:' || account || ':' || substr(group_id, 8)
+		WHERE type = 'direct' AND COALESCE(account, '') != ''
+			AND group_id LIKE 'direct:%' AND instr(substr(group_id, 8), ':') = 0
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to rekey direct conversations: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		slog.Info("Keyed direct conversations by account", "count", n)
+	}
+	return nil
+}
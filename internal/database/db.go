@@ -11,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 	"summarizarr/internal/signal"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -19,6 +20,13 @@ import (
 type DB struct {
 	*sql.DB
 	DataSourceName string
+
+	// StoreDirectMessages enables storing 1:1 chats as direct conversations.
+	StoreDirectMessages bool
+
+	// DefaultEphemeralPolicy applies to groups without their own policy.
+	// Empty means EphemeralPolicyRespect.
+	DefaultEphemeralPolicy string
 }
 
 // NewDB creates a new database connection with SQLCipher enforced.
@@ -327,6 +335,11 @@ func (db *DB) migrateSchema() error {
 		return fmt.Errorf("failed to migrate messages table: %w", err)
 	}
 
+	// Collapse redelivered messages and enforce uniqueness from now on
+	if err := db.migrateMessageIdentity(); err != nil {
+		return fmt.Errorf("failed to deduplicate messages: %w", err)
+	}
+
 	// Migrate summaries table for auth integration
 	if err := db.migrateAuthTables(); err != nil {
 		return fmt.Errorf("failed to migrate auth tables: %w", err)
@@ -372,6 +385,11 @@ func (db *DB) migrateMessagesTable() error {
 		"quote_author_uuid":  "TEXT",
 		"quote_text":         "TEXT",
 		"reaction_is_remove": "BOOLEAN DEFAULT FALSE",
+		"edited_at":          "INTEGER",
+		"is_deleted":         "BOOLEAN DEFAULT FALSE",
+		"deleted_at":         "INTEGER",
+		"expires_at":         "INTEGER",
+		"account":            "TEXT",
 	}
 
 	// Add missing columns
@@ -388,17 +406,114 @@ func (db *DB) migrateMessagesTable() error {
 	return nil
 }
 
+// messageIdentityIndex makes (sender, group, sent timestamp), the identity
+// Signal uses to address a message, unique.
+const messageIdentityIndex = "idx_messages_signal_identity"
+
+// migrateMessageIdentity removes duplicate messages stored before the unique
+// index existed, keeping the first copy, and then creates the index. It only
+// does work once: afterwards the index already exists.
+func (db *DB) migrateMessageIdentity() error {
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?", messageIdentityIndex).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check for index: %w", err)
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("Failed to rollback transaction", "error", err)
+		}
+	}()
+
+	const duplicates = `
+		SELECT id FROM messages
+		WHERE id NOT IN (SELECT MIN(id) FROM messages GROUP BY user_id, group_id, timestamp)`
+	for _, table := range []string{"attachments", "message_edits", "message_mentions"} {
+		if _, err := tx.Exec("DELETE FROM " + table + " WHERE message_id IN (" + duplicates + ")"); err != nil {
+			return fmt.Errorf("failed to remove %s of duplicate messages: %w", table, err)
+		}
+	}
+	res, err := tx.Exec("DELETE FROM messages WHERE id IN (" + duplicates + ")")
+	if err != nil {
+		return fmt.Errorf("failed to remove duplicate messages: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		slog.Info("Removed duplicate messages", "count", n)
+	}
+
+	if _, err := tx.Exec("CREATE UNIQUE INDEX " + messageIdentityIndex + " ON messages(user_id, group_id, timestamp)"); err != nil {
+		return fmt.Errorf("failed to create unique index: %w", err)
+	}
+
+	return tx.Commit()
+}
+
 // migrateAuthTables adds user_id columns for authentication integration
 func (db *DB) migrateAuthTables() error {
 	// Check summaries table
 	if err := db.addColumnIfNotExists("summaries", "user_id", "TEXT"); err != nil {
 		return fmt.Errorf("failed to add user_id to summaries: %w", err)
 	}
+	for column, definition := range map[string]string{
+		"delivery_status": "TEXT",
+		"delivery_error":  "TEXT",
+		"delivered_at":    "INTEGER",
+		// Tokens of the prompts and completions that generated the summary
+		"prompt_tokens":     "INTEGER",
+		"completion_tokens": "INTEGER",
+		"provider":          "TEXT",
+	} {
+		if err := db.addColumnIfNotExists("summaries", column, definition); err != nil {
+			return fmt.Errorf("failed to add %s to summaries: %w", column, err)
+		}
+	}
 
 	// Check groups table
 	if err := db.addColumnIfNotExists("groups", "created_by", "TEXT"); err != nil {
 		return fmt.Errorf("failed to add created_by to groups: %w", err)
 	}
+	if err := db.addColumnIfNotExists("groups", "type", "TEXT DEFAULT 'group'"); err != nil {
+		return fmt.Errorf("failed to add type to groups: %w", err)
+	}
+	if err := db.addColumnIfNotExists("groups", "description", "TEXT"); err != nil {
+		return fmt.Errorf("failed to add description to groups: %w", err)
+	}
+	if err := db.addColumnIfNotExists("groups", "account", "TEXT"); err != nil {
+		return fmt.Errorf("failed to add account to groups: %w", err)
+	}
+	if err := db.rekeyDirectConversations(); err != nil {
+		return err
+	}
+	if err := db.addColumnIfNotExists("groups", "ephemeral_policy", "TEXT"); err != nil {
+		return fmt.Errorf("failed to add ephemeral_policy to groups: %w", err)
+	}
+	if err := db.addColumnIfNotExists("groups", "summary_delivery", "TEXT"); err != nil {
+		return fmt.Errorf("failed to add summary_delivery to groups: %w", err)
+	}
+	if err := db.addColumnIfNotExists("groups", "summarized_until", "INTEGER"); err != nil {
+		return fmt.Errorf("failed to add summarized_until to groups: %w", err)
+	}
+	if err := db.addColumnIfNotExists("groups", "summary_schedule", "TEXT"); err != nil {
+		return fmt.Errorf("failed to add summary_schedule to groups: %w", err)
+	}
+	if err := db.addColumnIfNotExists("groups", "summary_timezone", "TEXT"); err != nil {
+		return fmt.Errorf("failed to add summary_timezone to groups: %w", err)
+	}
+	for _, column := range []string{"summary_min_messages", "summary_min_participants", "summary_min_chars", "summary_carry_from"} {
+		if err := db.addColumnIfNotExists("groups", column, "INTEGER"); err != nil {
+			return fmt.Errorf("failed to add %s to groups: %w", column, err)
+		}
+	}
+	if err := db.addColumnIfNotExists("groups", "summary_quiet_hours", "TEXT"); err != nil {
+		return fmt.Errorf("failed to add summary_quiet_hours to groups: %w", err)
+	}
 
 	// Create indexes for performance if they don't exist
 	indexes := []string{
@@ -499,11 +614,32 @@ func (db *DB) addColumnIfNotExists(tableName, columnName, columnDef string) erro
 
 // SaveMessage saves a message to the database.
 func (db *DB) SaveMessage(msg *signal.Envelope) error {
+	return db.saveMessage(msg, false)
+}
+
+// saveMessage stores an envelope. Historical envelopes come from exports:
+// their names may be long outdated, so they never rename users or groups.
+func (db *DB) saveMessage(msg *signal.Envelope, historical bool) error {
+	// Every live envelope carries the sender's current profile name
+	if !historical {
+		if err := db.syncUserName(msg); err != nil {
+			slog.Warn("Failed to update user name", "error", err)
+		}
+	}
+
 	// Skip receipt messages - we're not interested in delivery/read receipts
 	if msg.ReceiptMessage != nil {
 		return nil
 	}
 
+	// Edits and deletions modify an existing row instead of adding a new one
+	if edit := msg.Edit(); edit != nil {
+		return db.applyEdit(msg, edit)
+	}
+	if del, groupInfo := msg.Deletion(); del != nil {
+		return db.applyRemoteDelete(msg, del, groupInfo)
+	}
+
 	// Extract message content and group info from either DataMessage or SyncMessage
 	var messageText string
 	var groupInfo *signal.GroupInfo
@@ -511,13 +647,28 @@ func (db *DB) SaveMessage(msg *signal.Envelope) error {
 	messageType := "message"
 	var quote *signal.Quote
 	var reaction *signal.Reaction
+	var attachments []signal.Attachment
+	var mentions []signal.Mention
+	var expiresInSeconds int
+	var viewOnce bool
+	conversationType := ConversationGroup
+
+	// Direct messages are stored under a synthetic per-contact conversation
+	directInfo, directName, err := db.directConversation(msg)
+	if err != nil {
+		return err
+	}
 
 	// Check DataMessage first
-	if msg.DataMessage != nil && msg.DataMessage.GroupInfo != nil {
+	if msg.DataMessage != nil && (msg.DataMessage.GroupInfo != nil || directInfo != nil) {
 		messageText = msg.DataMessage.Message
 		groupInfo = msg.DataMessage.GroupInfo
 		quote = msg.DataMessage.Quote
 		reaction = msg.DataMessage.Reaction
+		attachments = msg.DataMessage.Attachments
+		mentions = msg.DataMessage.Mentions
+		expiresInSeconds = msg.DataMessage.ExpiresInSeconds
+		viewOnce = msg.DataMessage.ViewOnce
 
 		// Determine message type
 		if reaction != nil {
@@ -525,11 +676,16 @@ func (db *DB) SaveMessage(msg *signal.Envelope) error {
 		} else if quote != nil {
 			messageType = "quote"
 		}
-	} else if msg.SyncMessage != nil && msg.SyncMessage.SentMessage != nil && msg.SyncMessage.SentMessage.GroupInfo != nil {
+	} else if msg.SyncMessage != nil && msg.SyncMessage.SentMessage != nil && (msg.SyncMessage.SentMessage.GroupInfo != nil || directInfo != nil) {
 		// Check SyncMessage for sent messages
 		messageText = msg.SyncMessage.SentMessage.Message
 		groupInfo = msg.SyncMessage.SentMessage.GroupInfo
+		quote = msg.SyncMessage.SentMessage.Quote
 		reaction = msg.SyncMessage.SentMessage.Reaction
+		attachments = msg.SyncMessage.SentMessage.Attachments
+		mentions = msg.SyncMessage.SentMessage.Mentions
+		expiresInSeconds = msg.SyncMessage.SentMessage.ExpiresInSeconds
+		viewOnce = msg.SyncMessage.SentMessage.ViewOnce
 		if msg.SyncMessage.SentMessage.Timestamp > 0 {
 			timestamp = msg.SyncMessage.SentMessage.Timestamp
 		}
@@ -537,11 +693,21 @@ func (db *DB) SaveMessage(msg *signal.Envelope) error {
 		// Determine message type for sync messages
 		if reaction != nil {
 			messageType = "reaction"
+		} else if quote != nil {
+			messageType = "quote"
 		}
 	} else {
 		// Not a group message or no recognizable content, ignore
 		return nil
 	}
+	if groupInfo == nil {
+		groupInfo = directInfo
+		conversationType = ConversationDirect
+	}
+	groupName := groupInfo.GroupName
+	if groupName == "" {
+		groupName = directName
+	}
 
 	tx, err := db.Begin()
 	if err != nil {
@@ -558,10 +724,48 @@ func (db *DB) SaveMessage(msg *signal.Envelope) error {
 		return fmt.Errorf("failed to find or create user: %w", err)
 	}
 
-	groupID, err := db.findOrCreateGroup(tx, groupInfo.GroupID, groupInfo.GroupName)
+	groupID, err := db.findOrCreateGroup(tx, groupInfo.GroupID, groupName, conversationType, msg.Account)
 	if err != nil {
 		return fmt.Errorf("failed to find or create group: %w", err)
 	}
+	renamed := false
+	if !historical {
+		if renamed, err = renameIfChanged(tx, nameEntityGroup, groupID, groupInfo.GroupName, timestamp); err != nil {
+			return err
+		}
+	}
+	if renamed {
+		if err := saveGroupEvent(tx, groupID, GroupEventRenamed, userID, groupInfo.GroupName, timestamp); err != nil {
+			return err
+		}
+	}
+
+	ingest, err := shouldIngest(tx, groupID, msg.SourceUUID, msg.SourceNumber)
+	if err != nil {
+		return err
+	}
+	if !ingest {
+		// Commit so the group still shows up and can be managed
+		slog.Debug("Skipping message excluded by group settings", "group_id", groupID)
+		return tx.Commit()
+	}
+
+	policy, err := db.groupEphemeralPolicy(tx, groupID)
+	if err != nil {
+		return err
+	}
+	store, expiresAt := applyEphemeralPolicy(policy, timestamp, expiresInSeconds, viewOnce)
+	if !store {
+		// Commit so the sender and group are still known
+		slog.Debug("Skipping ephemeral message", "policy", policy, "view_once", viewOnce, "expires_in", expiresInSeconds)
+		return tx.Commit()
+	}
+
+	// Group updates carry no message of their own; membership changes are
+	// recorded by SaveGroupUpdate
+	if groupInfo.Type == signal.GroupUpdateTypeUpdate && !hasContent(messageText, attachments, reaction) {
+		return tx.Commit()
+	}
 
 	// Prepare values for insertion
 	var quoteID, quoteAuthorUUID, quoteText interface{}
@@ -586,29 +790,249 @@ func (db *DB) SaveMessage(msg *signal.Envelope) error {
 		reactionIsRemove = reaction.IsRemove
 	}
 
-	_, err = tx.Exec(`
+	res, err := tx.Exec(`
 		INSERT INTO messages (
 			timestamp, server_received_timestamp, server_delivered_timestamp, 
 			message_text, message_type,
 			quote_id, quote_author_uuid, quote_text,
 			is_reaction, reaction_emoji, reaction_target_author_uuid, 
 			reaction_target_timestamp, reaction_is_remove,
-			user_id, group_id
+			expires_at, account, user_id, group_id
 		)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
 	`, timestamp, msg.ServerReceivedTimestamp, msg.ServerDeliveredTimestamp,
 		messageText, messageType,
 		quoteID, quoteAuthorUUID, quoteText,
 		isReaction, reactionEmoji, reactionTargetAuthorUUID,
 		reactionTargetTimestamp, reactionIsRemove,
-		userID, groupID)
+		expiresAt, nullIfEmpty(msg.Account), userID, groupID)
 	if err != nil {
 		return fmt.Errorf("failed to insert message: %w", err)
 	}
 
+	// Redelivered after a reconnect: the message is already stored
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		slog.Debug("Skipping duplicate message", "timestamp", timestamp)
+		return tx.Commit()
+	}
+
+	messageID, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get message id: %w", err)
+	}
+
+	if err := saveAttachments(tx, messageID, attachments, false); err != nil {
+		return err
+	}
+	if quote != nil {
+		if err := saveAttachments(tx, messageID, quote.Attachments, true); err != nil {
+			return err
+		}
+	}
+	if err := db.saveMentions(tx, messageID, mentions); err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
+// findMessageBySender locates a stored message by its author and original
+// sent timestamp, which is how Signal addresses edit and delete targets.
+func findMessageBySender(tx *sql.Tx, senderUUID string, groupID string, sentTimestamp int64) (int64, error) {
+	query := `
+		SELECT m.id FROM messages m
+		JOIN users u ON m.user_id = u.id
+		LEFT JOIN groups g ON m.group_id = g.id
+		WHERE u.uuid = ? AND m.timestamp = ?`
+	args := []interface{}{senderUUID, sentTimestamp}
+	if groupID != "" {
+		query += " AND g.group_id = ?"
+		args = append(args, groupID)
+	}
+	query += " ORDER BY m.id LIMIT 1"
+
+	var id int64
+	if err := tx.QueryRow(query, args...).Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// applyEdit replaces the text of the original message and records the
+// previous version in message_edits. Edits for messages we never stored are
+// saved as new messages at the original timestamp so the content is not lost.
+func (db *DB) applyEdit(msg *signal.Envelope, edit *signal.EditMessage) error {
+	data := edit.DataMessage
+	groupKey := ""
+	if data.GroupInfo != nil {
+		groupKey = data.GroupInfo.GroupID
+	} else if !db.StoreDirectMessages {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("Failed to rollback transaction", "error", err)
+		}
+	}()
+
+	messageID, err := findMessageBySender(tx, msg.SourceUUID, groupKey, edit.TargetSentTimestamp)
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = tx.Rollback()
+		slog.Debug("Edit target not found, storing as new message", "target_timestamp", edit.TargetSentTimestamp)
+		original := *msg
+		original.EditMessage = nil
+		original.SyncMessage = nil
+		original.Timestamp = edit.TargetSentTimestamp
+		original.DataMessage = data
+		return db.SaveMessage(&original)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find edited message: %w", err)
+	}
+
+	var groupID int64
+	var previousText sql.NullString
+	var isDeleted bool
+	var lastEditedAt sql.NullInt64
+	if err := tx.QueryRow("SELECT group_id, message_text, COALESCE(is_deleted, FALSE), edited_at FROM messages WHERE id = ?", messageID).Scan(&groupID, &previousText, &isDeleted, &lastEditedAt); err != nil {
+		return fmt.Errorf("failed to load edited message: %w", err)
+	}
+	if isDeleted {
+		// A delete wins over any late edit
+		return nil
+	}
+	ingest, err := shouldIngest(tx, groupID, msg.SourceUUID, msg.SourceNumber)
+	if err != nil {
+		return err
+	}
+	if !ingest {
+		slog.Debug("Skipping edit excluded by group settings", "group_id", groupID)
+		return nil
+	}
+
+	editedAt := data.Timestamp
+	if editedAt == 0 {
+		editedAt = msg.Timestamp
+	}
+	if lastEditedAt.Valid && lastEditedAt.Int64 == editedAt {
+		// Same edit redelivered
+		return nil
+	}
+
+	if _, err := tx.Exec("INSERT INTO message_edits (message_id, previous_text, edited_at) VALUES (?, ?, ?)",
+		messageID, previousText, editedAt); err != nil {
+		return fmt.Errorf("failed to record message edit: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE messages SET message_text = ?, edited_at = ? WHERE id = ?",
+		data.Message, editedAt, messageID); err != nil {
+		return fmt.Errorf("failed to update edited message: %w", err)
+	}
+
+	// Edits can add or replace attachments
+	if len(data.Attachments) > 0 {
+		if _, err := tx.Exec("DELETE FROM attachments WHERE message_id = ? AND COALESCE(is_quote, FALSE) = FALSE", messageID); err != nil {
+			return fmt.Errorf("failed to replace attachments: %w", err)
+		}
+		if err := saveAttachments(tx, messageID, data.Attachments, false); err != nil {
+			return err
+		}
+	}
+
+	// Mention offsets refer to the new text, so they are always replaced
+	if _, err := tx.Exec("DELETE FROM message_mentions WHERE message_id = ?", messageID); err != nil {
+		return fmt.Errorf("failed to replace mentions: %w", err)
+	}
+	if err := db.saveMentions(tx, messageID, data.Mentions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// applyRemoteDelete tombstones the target message: its text, edit history and
+// attachment metadata are removed and it is excluded from summarization.
+func (db *DB) applyRemoteDelete(msg *signal.Envelope, del *signal.RemoteDelete, groupInfo *signal.GroupInfo) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("Failed to rollback transaction", "error", err)
+		}
+	}()
+
+	groupID := ""
+	if groupInfo != nil {
+		groupID = groupInfo.GroupID
+	}
+
+	messageID, err := findMessageBySender(tx, msg.SourceUUID, groupID, del.Timestamp)
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.Debug("Remote delete target not found", "target_timestamp", del.Timestamp)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find deleted message: %w", err)
+	}
+
+	if _, err := tx.Exec("UPDATE messages SET message_text = NULL, is_deleted = TRUE, deleted_at = ? WHERE id = ?",
+		msg.Timestamp, messageID); err != nil {
+		return fmt.Errorf("failed to tombstone message: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM message_edits WHERE message_id = ?", messageID); err != nil {
+		return fmt.Errorf("failed to remove edit history: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM attachments WHERE message_id = ?", messageID); err != nil {
+		return fmt.Errorf("failed to remove attachments: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM message_mentions WHERE message_id = ?", messageID); err != nil {
+		return fmt.Errorf("failed to remove mentions: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// saveAttachments stores attachment metadata for a message. Quoted attachments
+// are flagged so they are not mistaken for media the sender shared themselves.
+func saveAttachments(tx *sql.Tx, messageID int64, attachments []signal.Attachment, isQuote bool) error {
+	for _, a := range attachments {
+		_, err := tx.Exec(`
+			INSERT INTO attachments (message_id, attachment_id, content_type, filename, size, caption, voice_note, is_quote)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, messageID, a.ID, a.ContentType, a.Filename, a.Size, a.Caption, a.VoiceNote, isQuote)
+		if err != nil {
+			return fmt.Errorf("failed to insert attachment: %w", err)
+		}
+	}
+	return nil
+}
+
+// saveMentions stores who was @mentioned in a message. Mentioned members are
+// created as users if they have not written anything yet.
+func (db *DB) saveMentions(tx *sql.Tx, messageID int64, mentions []signal.Mention) error {
+	for _, m := range mentions {
+		if m.UUID == "" {
+			continue
+		}
+		userID, err := db.findOrCreateUser(tx, m.UUID, m.Number, m.Name)
+		if err != nil {
+			return fmt.Errorf("failed to find or create mentioned user: %w", err)
+		}
+		if _, err := tx.Exec("INSERT INTO message_mentions (message_id, user_id, start, length) VALUES (?, ?, ?, ?)",
+			messageID, userID, m.Start, m.Length); err != nil {
+			return fmt.Errorf("failed to insert mention: %w", err)
+		}
+	}
+	return nil
+}
+
 func (db *DB) findOrCreateUser(tx *sql.Tx, uuid, number, name string) (int64, error) {
 	var id int64
 	err := tx.QueryRow("SELECT id FROM users WHERE uuid = ?", uuid).Scan(&id)
@@ -620,6 +1044,20 @@ func (db *DB) findOrCreateUser(tx *sql.Tx, uuid, number, name string) (int64, er
 		return 0, fmt.Errorf("failed to query user: %w", err)
 	}
 
+	// Group members may have been stored by number before they wrote anything
+	if number != "" {
+		err := tx.QueryRow("SELECT id FROM users WHERE number = ? AND uuid IS NULL ORDER BY id LIMIT 1", number).Scan(&id)
+		if err == nil {
+			if _, err := tx.Exec("UPDATE users SET uuid = ?, name = COALESCE(NULLIF(?, ''), name) WHERE id = ?", uuid, name, id); err != nil {
+				return 0, fmt.Errorf("failed to update user: %w", err)
+			}
+			return id, nil
+		}
+		if err != sql.ErrNoRows {
+			return 0, fmt.Errorf("failed to query user by number: %w", err)
+		}
+	}
+
 	res, err := tx.Exec("INSERT INTO users (uuid, number, name) VALUES (?, ?, ?)", uuid, number, name)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert user: %w", err)
@@ -630,6 +1068,8 @@ func (db *DB) findOrCreateUser(tx *sql.Tx, uuid, number, name string) (int64, er
 
 // MessageForSummary holds the data needed to generate a summary.
 type MessageForSummary struct {
+	ID                 int64
+	Timestamp          int64
 	UserID             int64
 	GroupID            int64
 	UserName           string
@@ -639,26 +1079,62 @@ type MessageForSummary struct {
 	QuoteText          string
 	ReactionEmoji      string
 	ReactionTargetUUID string
+	Attachments        []AttachmentForSummary
+	Mentions           []MentionForSummary
+	Reactions          []ReactionCount // current reactions from the summarized window
+	EventType          string          // set for MessageType "group_event"
+}
+
+// AttachmentForSummary describes media attached to a message.
+type AttachmentForSummary struct {
+	ContentType string
+	Filename    string
+	Size        int64
+	Caption     string
+	VoiceNote   bool
+	IsQuote     bool
+}
+
+// MentionForSummary locates an @mention within MessageForSummary.Text. Start
+// and Length are UTF-16 offsets, as sent by Signal.
+type MentionForSummary struct {
+	UserID int64
+	Start  int
+	Length int
 }
 
 // GetMessagesForSummarization retrieves messages for a given group within a time range.
 func (db *DB) GetMessagesForSummarization(groupID int64, start, end int64) ([]MessageForSummary, error) {
+	// Nothing of a group with summarization turned off may reach a provider
+	if _, summarize, err := groupFlags(db, groupID); err != nil || !summarize {
+		return nil, err
+	}
+
 	rows, err := db.Query(`
 SELECT 
+	m.id,
+	COALESCE(m.timestamp, 0),
 	m.user_id,
 	m.group_id,
-	u.name, 
+	COALESCE(u.name, ''),
+	COALESCE(u.uuid, ''),
 	COALESCE(m.message_text, '') as message_text,
 	m.message_type,
 	COALESCE(m.quote_author_uuid, '') as quote_author_uuid,
 	COALESCE(m.quote_text, '') as quote_text,
 	COALESCE(m.reaction_emoji, '') as reaction_emoji,
-	COALESCE(m.reaction_target_author_uuid, '') as reaction_target_uuid
+	COALESCE(m.reaction_target_author_uuid, '') as reaction_target_uuid,
+	COALESCE(m.reaction_target_timestamp, 0),
+	COALESCE(m.reaction_is_remove, FALSE),
+	`+excludedQuoteAuthor("m.group_id")+` as quote_excluded
 FROM messages m
 JOIN users u ON m.user_id = u.id
 WHERE m.group_id = ? AND m.timestamp BETWEEN ? AND ?
+	AND COALESCE(m.is_deleted, FALSE) = FALSE
+	AND (m.expires_at IS NULL OR m.expires_at > ?)
+	AND `+excludedSenderFilter("m.group_id")+`
 ORDER BY m.timestamp ASC
-`, groupID, start, end)
+`, groupID, start, end, time.Now().UnixMilli())
 	if err != nil {
 		return nil, fmt.Errorf("failed to query messages: %w", err)
 	}
@@ -669,21 +1145,167 @@ ORDER BY m.timestamp ASC
 	}()
 
 	var messages []MessageForSummary
+	var reactions []reactionEvent
+	// Signal addresses reaction targets by author and sent timestamp
+	byIdentity := make(map[messageIdentity]int)
+	// Replies keep their own text, but not what they quote of excluded senders
+	hiddenQuotes := make(map[int64]bool)
 	for rows.Next() {
 		var msg MessageForSummary
-		if err := rows.Scan(&msg.UserID, &msg.GroupID, &msg.UserName, &msg.Text, &msg.MessageType,
-			&msg.QuoteAuthorUUID, &msg.QuoteText, &msg.ReactionEmoji, &msg.ReactionTargetUUID); err != nil {
+		var senderUUID string
+		var targetTimestamp int64
+		var isRemove, quoteExcluded bool
+		if err := rows.Scan(&msg.ID, &msg.Timestamp, &msg.UserID, &msg.GroupID, &msg.UserName, &senderUUID, &msg.Text, &msg.MessageType,
+			&msg.QuoteAuthorUUID, &msg.QuoteText, &msg.ReactionEmoji, &msg.ReactionTargetUUID, &targetTimestamp, &isRemove, &quoteExcluded); err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
 		}
+		if quoteExcluded {
+			msg.QuoteText = ""
+			hiddenQuotes[msg.ID] = true
+		}
+		if msg.MessageType == "reaction" {
+			reactions = append(reactions, reactionEvent{
+				reactor: msg.UserID,
+				emoji:   msg.ReactionEmoji,
+				target:  messageIdentity{authorUUID: msg.ReactionTargetUUID, timestamp: targetTimestamp},
+				remove:  isRemove,
+				at:      msg.Timestamp,
+			})
+			continue
+		}
+		byIdentity[messageIdentity{authorUUID: senderUUID, timestamp: msg.Timestamp}] = len(messages)
 		messages = append(messages, msg)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate messages: %w", err)
+	}
+
+	if err := db.attachAttachments(messages, groupID, start, end); err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		if hiddenQuotes[messages[i].ID] {
+			messages[i].Attachments = withoutQuotedAttachments(messages[i].Attachments)
+		}
+	}
+	if err := db.attachMentions(messages, groupID, start, end); err != nil {
+		return nil, err
+	}
+
+	earlier, err := db.applyReactions(messages, byIdentity, reactions, groupID)
+	if err != nil {
+		return nil, err
+	}
+	messages = mergeByTimestamp(messages, earlier)
 
-	return messages, nil
+	events, err := db.getGroupEvents(groupID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return mergeByTimestamp(messages, events), nil
+}
+
+// attachAttachments loads attachment metadata for the given messages in one query.
+func (db *DB) attachAttachments(messages []MessageForSummary, groupID int64, start, end int64) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]int, len(messages))
+	for i, msg := range messages {
+		index[msg.ID] = i
+	}
+
+	rows, err := db.Query(`
+SELECT a.message_id, COALESCE(a.content_type, ''), COALESCE(a.filename, ''),
+	COALESCE(a.size, 0), COALESCE(a.caption, ''), COALESCE(a.voice_note, FALSE), COALESCE(a.is_quote, FALSE)
+FROM attachments a
+JOIN messages m ON a.message_id = m.id
+WHERE m.group_id = ? AND m.timestamp BETWEEN ? AND ?
+ORDER BY a.id ASC
+`, groupID, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to query attachments: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("Failed to close rows", "error", err, "context", "attachAttachments")
+		}
+	}()
+
+	for rows.Next() {
+		var messageID int64
+		var a AttachmentForSummary
+		if err := rows.Scan(&messageID, &a.ContentType, &a.Filename, &a.Size, &a.Caption, &a.VoiceNote, &a.IsQuote); err != nil {
+			return fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		if i, ok := index[messageID]; ok {
+			messages[i].Attachments = append(messages[i].Attachments, a)
+		}
+	}
+
+	return rows.Err()
+}
+
+// withoutQuotedAttachments drops the attachments a reply quotes.
+func withoutQuotedAttachments(attachments []AttachmentForSummary) []AttachmentForSummary {
+	var kept []AttachmentForSummary
+	for _, a := range attachments {
+		if !a.IsQuote {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// attachMentions loads the @mentions for the given messages in one query.
+func (db *DB) attachMentions(messages []MessageForSummary, groupID int64, start, end int64) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]int, len(messages))
+	for i, msg := range messages {
+		index[msg.ID] = i
+	}
+
+	rows, err := db.Query(`
+SELECT mm.message_id, mm.user_id, mm.start, mm.length
+FROM message_mentions mm
+JOIN messages m ON mm.message_id = m.id
+WHERE m.group_id = ? AND m.timestamp BETWEEN ? AND ?
+ORDER BY mm.message_id ASC, mm.start ASC
+`, groupID, start, end)
+	if err != nil {
+		return fmt.Errorf("failed to query mentions: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("Failed to close rows", "error", err, "context", "attachMentions")
+		}
+	}()
+
+	for rows.Next() {
+		var messageID int64
+		var mention MentionForSummary
+		if err := rows.Scan(&messageID, &mention.UserID, &mention.Start, &mention.Length); err != nil {
+			return fmt.Errorf("failed to scan mention: %w", err)
+		}
+		if i, ok := index[messageID]; ok {
+			messages[i].Mentions = append(messages[i].Mentions, mention)
+		}
+	}
+
+	return rows.Err()
 }
 
-// GetGroups retrieves all unique group IDs from the database.
+// GetGroups retrieves the IDs of all groups that have summarization enabled.
 func (db *DB) GetGroups() ([]int64, error) {
-	rows, err := db.Query("SELECT id FROM groups")
+	rows, err := db.Query(`
+		SELECT g.id FROM groups g
+		LEFT JOIN group_settings s ON s.group_id = g.id
+		WHERE COALESCE(s.summarize, TRUE)
+	`)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query groups: %w", err)
 	}
@@ -706,12 +1328,12 @@ func (db *DB) GetGroups() ([]int64, error) {
 }
 
 // SaveSummary saves a summary to the database.
-func (db *DB) SaveSummary(groupID int64, summaryText string, start, end int64) error {
-	_, err := db.Exec("INSERT INTO summaries (group_id, summary_text, start_timestamp, end_timestamp) VALUES (?, ?, ?, ?)", groupID, summaryText, start, end)
+func (db *DB) SaveSummary(groupID int64, summaryText string, start, end int64) (int64, error) {
+	res, err := db.Exec("INSERT INTO summaries (group_id, summary_text, start_timestamp, end_timestamp) VALUES (?, ?, ?, ?)", groupID, summaryText, start, end)
 	if err != nil {
-		return fmt.Errorf("failed to insert summary: %w", err)
+		return 0, fmt.Errorf("failed to insert summary: %w", err)
 	}
-	return nil
+	return res.LastInsertId()
 }
 
 // Summary represents a summary record from the database.
@@ -723,6 +1345,15 @@ type Summary struct {
 	Start     int64  `json:"start_timestamp"`
 	End       int64  `json:"end_timestamp"`
 	CreatedAt string `json:"created_at"`
+	// DeliveryStatus is empty unless the summary was posted to Signal
+	DeliveryStatus string `json:"delivery_status,omitempty"`
+	DeliveryError  string `json:"delivery_error,omitempty"`
+	// Tokens used to generate the summary, 0 for summaries saved before
+	// they were recorded
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	// Provider that generated the summary, empty if not recorded
+	Provider string `json:"provider,omitempty"`
 }
 
 // GetSummaries retrieves all summaries from the database ordered by creation time.
@@ -740,7 +1371,9 @@ func (db *DB) GetSummariesWithFilters(search, groups, startTimeStr, endTimeStr,
 		"sort", sort)
 
 	// Build the query with optional filters
-	query := `SELECT s.id, s.group_id, COALESCE(g.name, 'Group ' || s.group_id) as group_name, s.summary_text, s.start_timestamp, s.end_timestamp, s.created_at 
+	query := `SELECT s.id, s.group_id, COALESCE(g.name, 'Group ' || s.group_id) as group_name, s.summary_text, s.start_timestamp, s.end_timestamp, s.created_at,
+	                 COALESCE(s.delivery_status, ''), COALESCE(s.delivery_error, ''),
+	                 COALESCE(s.prompt_tokens, 0), COALESCE(s.completion_tokens, 0), COALESCE(s.provider, '')
 	          FROM summaries s 
 	          LEFT JOIN groups g ON s.group_id = g.id 
 	          WHERE 1=1`
@@ -814,7 +1447,7 @@ func (db *DB) GetSummariesWithFilters(search, groups, startTimeStr, endTimeStr,
 	for rows.Next() {
 		rowCount++
 		var s Summary
-		if err := rows.Scan(&s.ID, &s.GroupID, &s.GroupName, &s.Text, &s.Start, &s.End, &s.CreatedAt); err != nil {
+		if err := rows.Scan(&s.ID, &s.GroupID, &s.GroupName, &s.Text, &s.Start, &s.End, &s.CreatedAt, &s.DeliveryStatus, &s.DeliveryError, &s.PromptTokens, &s.CompletionTokens, &s.Provider); err != nil {
 			slog.Error("Failed to scan summary row", "error", err, "rowCount", rowCount)
 			return nil, fmt.Errorf("failed to scan summary: %w", err)
 		}
@@ -833,6 +1466,9 @@ func (db *DB) GetSummariesWithFilters(search, groups, startTimeStr, endTimeStr,
 
 // DeleteSummary removes a summary by its ID.
 func (db *DB) DeleteSummary(id int64) error {
+	if _, err := db.Exec("DELETE FROM summary_history WHERE summary_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete summary history: %w", err)
+	}
 	res, err := db.Exec("DELETE FROM summaries WHERE id = ?", id)
 	if err != nil {
 		return fmt.Errorf("failed to delete summary: %w", err)
@@ -844,10 +1480,20 @@ func (db *DB) DeleteSummary(id int64) error {
 	return nil
 }
 
-func (db *DB) findOrCreateGroup(tx *sql.Tx, groupID, name string) (int64, error) {
+// findOrCreateGroup returns the ID of a group, creating it if needed. The same
+// group seen by several accounts is stored once and keeps the account that saw
+// it first.
+func (db *DB) findOrCreateGroup(tx *sql.Tx, groupID, name, conversationType, account string) (int64, error) {
 	var id int64
-	err := tx.QueryRow("SELECT id FROM groups WHERE group_id = ?", groupID).Scan(&id)
+	var current sql.NullString
+	err := tx.QueryRow("SELECT id, account FROM groups WHERE group_id = ?", groupID).Scan(&id, &current)
 	if err == nil {
+		// Groups stored before accounts were tracked adopt the first one seen
+		if !current.Valid && account != "" {
+			if _, err := tx.Exec("UPDATE groups SET account = ? WHERE id = ?", account, id); err != nil {
+				return 0, fmt.Errorf("failed to set group account: %w", err)
+			}
+		}
 		return id, nil
 	}
 
@@ -855,7 +1501,7 @@ func (db *DB) findOrCreateGroup(tx *sql.Tx, groupID, name string) (int64, error)
 		return 0, fmt.Errorf("failed to query group: %w", err)
 	}
 
-	res, err := tx.Exec("INSERT INTO groups (group_id, name) VALUES (?, ?)", groupID, name)
+	res, err := tx.Exec("INSERT INTO groups (group_id, name, type, account) VALUES (?, ?, ?, ?)", groupID, name, conversationType, nullIfEmpty(account))
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert group: %w", err)
 	}
@@ -863,6 +1509,14 @@ func (db *DB) findOrCreateGroup(tx *sql.Tx, groupID, name string) (int64, error)
 	return res.LastInsertId()
 }
 
+// nullIfEmpty stores empty strings as NULL.
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
 // GetUserNameByID retrieves the user name by internal user ID.
 func (db *DB) GetUserNameByID(userID int64) (string, error) {
 	var name string
@@ -873,6 +1527,19 @@ func (db *DB) GetUserNameByID(userID int64) (string, error) {
 	return name, nil
 }
 
+// FindGroupID returns the internal ID of a group by its Signal group ID.
+func (db *DB) FindGroupID(signalGroupID string) (int64, error) {
+	var id int64
+	err := db.QueryRow("SELECT id FROM groups WHERE group_id = ?", signalGroupID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrGroupNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to query group: %w", err)
+	}
+	return id, nil
+}
+
 // GetGroupNameByID retrieves the group name by internal group ID.
 func (db *DB) GetGroupNameByID(groupID int64) (string, error) {
 	var name string
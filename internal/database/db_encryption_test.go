@@ -216,7 +216,7 @@ func TestEncryptedDatabasePersistence(t *testing.T) {
 		}
 
 		// Save test summary
-		if err := db.SaveSummary(1, "Test persistence summary", 1000, 2000); err != nil {
+		if _, err := db.SaveSummary(1, "Test persistence summary", 1000, 2000); err != nil {
 			t.Fatalf("Failed to save test summary: %v", err)
 		}
 
@@ -290,7 +290,7 @@ func TestEncryptedDatabaseWithWrongKey(t *testing.T) {
 		}
 
 		// Save test summary
-		if err := db.SaveSummary(1, "Test summary for wrong key test", 1000, 2000); err != nil {
+		if _, err := db.SaveSummary(1, "Test summary for wrong key test", 1000, 2000); err != nil {
 			t.Fatalf("Failed to save test summary: %v", err)
 		}
 
@@ -1,7 +1,13 @@
 package database
 
 import (
+	"database/sql"
+	"errors"
+	"os"
 	"path/filepath"
+	"strings"
+	"summarizarr/internal/schedule"
+	"summarizarr/internal/signal"
 	"testing"
 	"time"
 
@@ -124,58 +130,1387 @@ func createTestDB(t *testing.T) (*DB, error) {
 	return NewDB(dbPath, key)
 }
 
-// initTestSchema initializes the test database schema
+// initTestSchema initializes the test database schema from the canonical
+// schema.sql so helpers stay in sync with production tables.
 func (db *DB) initTestSchema() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		uuid TEXT UNIQUE,
-		number TEXT,
-		name TEXT
-	);
-
-	CREATE TABLE IF NOT EXISTS groups (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		group_id TEXT UNIQUE,
-		name TEXT
-	);
-
-	CREATE TABLE IF NOT EXISTS messages (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		timestamp INTEGER,
-		server_received_timestamp INTEGER,
-		server_delivered_timestamp INTEGER,
-		message_text TEXT,
-		message_type TEXT DEFAULT 'message',
-		
-		-- Quote fields
-		quote_id INTEGER,
-		quote_author_uuid TEXT,
-		quote_text TEXT,
-		
-		-- Reaction fields
-		is_reaction BOOLEAN DEFAULT FALSE,
-		reaction_emoji TEXT,
-		reaction_target_author_uuid TEXT,
-		reaction_target_timestamp INTEGER,
-		reaction_is_remove BOOLEAN DEFAULT FALSE,
-		
-		user_id INTEGER,
-		group_id INTEGER,
-		FOREIGN KEY (user_id) REFERENCES users (id),
-		FOREIGN KEY (group_id) REFERENCES groups (id)
-	);
-
-	CREATE TABLE IF NOT EXISTS summaries (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		group_id INTEGER,
-		summary_text TEXT,
-		start_timestamp INTEGER,
-		end_timestamp INTEGER,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (group_id) REFERENCES groups (id)
-	);
-	`
-	_, err := db.Exec(schema)
-	return err
+	schemaBytes, err := os.ReadFile(filepath.Join("..", "..", "schema.sql"))
+	if err != nil {
+		return err
+	}
+	if err := execSQLStatements(db.DB, string(schemaBytes)); err != nil {
+		return err
+	}
+	return db.migrateSchema()
+}
+
+// newPlainTestDB returns an unencrypted in-memory database with the full schema.
+// It exercises query logic in environments where SQLCipher is not installed.
+func newPlainTestDB(t *testing.T) *DB {
+	t.Helper()
+	raw, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	// Every connection to :memory: is a separate database
+	raw.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = raw.Close() })
+
+	if _, err := raw.Exec("PRAGMA foreign_keys = ON"); err != nil {
+		t.Fatalf("Failed to enable foreign keys: %v", err)
+	}
+
+	db := &DB{DB: raw}
+	if err := db.initTestSchema(); err != nil {
+		t.Fatalf("Failed to initialize schema: %v", err)
+	}
+	return db
+}
+
+func TestSaveMessage_PersistsAttachments(t *testing.T) {
+	db := newPlainTestDB(t)
+
+	env := &signal.Envelope{
+		SourceUUID: "uuid-1",
+		SourceName: "Alice",
+		Timestamp:  1000,
+		DataMessage: &signal.DataMessage{
+			Timestamp: 1000,
+			GroupInfo: &signal.GroupInfo{GroupID: "group-1", GroupName: "Group"},
+			Attachments: []signal.Attachment{
+				{ID: "att-1", ContentType: "image/jpeg", Filename: "IMG_0001.jpg", Size: 2048, Caption: "sunset"},
+			},
+			Quote: &signal.Quote{
+				ID:          900,
+				AuthorUUID:  "uuid-2",
+				Attachments: []signal.Attachment{{ContentType: "application/pdf", Filename: "plan.pdf"}},
+			},
+		},
+	}
+	if err := db.SaveMessage(env); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+
+	groups, err := db.GetGroups()
+	if err != nil || len(groups) != 1 {
+		t.Fatalf("Expected one group, got %v (err=%v)", groups, err)
+	}
+
+	messages, err := db.GetMessagesForSummarization(groups[0], 0, 2000)
+	if err != nil {
+		t.Fatalf("GetMessagesForSummarization failed: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(messages))
+	}
+
+	atts := messages[0].Attachments
+	if len(atts) != 2 {
+		t.Fatalf("Expected 2 attachments, got %d", len(atts))
+	}
+	if atts[0].ContentType != "image/jpeg" || atts[0].Caption != "sunset" || atts[0].Size != 2048 || atts[0].IsQuote {
+		t.Errorf("Unexpected sent attachment: %+v", atts[0])
+	}
+	if atts[1].ContentType != "application/pdf" || !atts[1].IsQuote {
+		t.Errorf("Unexpected quoted attachment: %+v", atts[1])
+	}
+}
+
+func groupMessage(uuid string, ts int64, text string) *signal.Envelope {
+	return &signal.Envelope{
+		SourceUUID: uuid,
+		SourceName: "Member " + uuid,
+		Timestamp:  ts,
+		DataMessage: &signal.DataMessage{
+			Timestamp: ts,
+			Message:   text,
+			GroupInfo: &signal.GroupInfo{GroupID: "group-1", GroupName: "Group"},
+		},
+	}
+}
+
+func TestSaveMessage_EditsAndRemoteDeletes(t *testing.T) {
+	db := newPlainTestDB(t)
+
+	for _, env := range []*signal.Envelope{
+		groupMessage("uuid-1", 1000, "meet at 5"),
+		groupMessage("uuid-2", 1100, "wrong chat, sorry"),
+		groupMessage("uuid-1", 1200, "bring snacks"),
+	} {
+		if err := db.SaveMessage(env); err != nil {
+			t.Fatalf("SaveMessage failed: %v", err)
+		}
+	}
+
+	edit := &signal.Envelope{
+		SourceUUID: "uuid-1",
+		Timestamp:  1500,
+		EditMessage: &signal.EditMessage{
+			TargetSentTimestamp: 1000,
+			DataMessage: &signal.DataMessage{
+				Timestamp: 1500,
+				Message:   "meet at 6",
+				GroupInfo: &signal.GroupInfo{GroupID: "group-1"},
+			},
+		},
+	}
+	if err := db.SaveMessage(edit); err != nil {
+		t.Fatalf("SaveMessage(edit) failed: %v", err)
+	}
+
+	del := &signal.Envelope{
+		SourceUUID: "uuid-2",
+		Timestamp:  1600,
+		DataMessage: &signal.DataMessage{
+			Timestamp:    1600,
+			RemoteDelete: &signal.RemoteDelete{Timestamp: 1100},
+			GroupInfo:    &signal.GroupInfo{GroupID: "group-1"},
+		},
+	}
+	if err := db.SaveMessage(del); err != nil {
+		t.Fatalf("SaveMessage(delete) failed: %v", err)
+	}
+
+	var rowCount int
+	if err := db.QueryRow("SELECT COUNT(*) FROM messages").Scan(&rowCount); err != nil {
+		t.Fatalf("Failed to count messages: %v", err)
+	}
+	if rowCount != 3 {
+		t.Errorf("Expected edits and deletes not to add rows, got %d messages", rowCount)
+	}
+
+	var previous string
+	if err := db.QueryRow("SELECT previous_text FROM message_edits").Scan(&previous); err != nil {
+		t.Fatalf("Expected an edit history row: %v", err)
+	}
+	if previous != "meet at 5" {
+		t.Errorf("Expected previous text 'meet at 5', got %q", previous)
+	}
+
+	groups, _ := db.GetGroups()
+	messages, err := db.GetMessagesForSummarization(groups[0], 0, 2000)
+	if err != nil {
+		t.Fatalf("GetMessagesForSummarization failed: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Expected deleted message to be excluded, got %d messages", len(messages))
+	}
+	if messages[0].Text != "meet at 6" {
+		t.Errorf("Expected latest text 'meet at 6', got %q", messages[0].Text)
+	}
+	if messages[1].Text != "bring snacks" {
+		t.Errorf("Expected 'bring snacks', got %q", messages[1].Text)
+	}
+}
+
+func TestSaveMessage_EphemeralPolicies(t *testing.T) {
+	now := time.Now().UnixMilli()
+
+	ephemeral := func(uuid string, ts int64, expiresIn int, viewOnce bool) *signal.Envelope {
+		env := groupMessage(uuid, ts, "psst")
+		env.DataMessage.ExpiresInSeconds = expiresIn
+		env.DataMessage.ViewOnce = viewOnce
+		return env
+	}
+
+	tests := []struct {
+		policy   string
+		expected int // stored messages out of: plain, expiring, view-once
+	}{
+		{EphemeralPolicyRespect, 2},
+		{EphemeralPolicySkip, 1},
+		{EphemeralPolicyKeep, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			db := newPlainTestDB(t)
+			db.DefaultEphemeralPolicy = tt.policy
+
+			for _, env := range []*signal.Envelope{
+				groupMessage("uuid-1", now-3000, "hello"),
+				ephemeral("uuid-2", now-2000, 3600, false),
+				ephemeral("uuid-3", now-1000, 0, true),
+			} {
+				if err := db.SaveMessage(env); err != nil {
+					t.Fatalf("SaveMessage failed: %v", err)
+				}
+			}
+
+			var count int
+			if err := db.QueryRow("SELECT COUNT(*) FROM messages").Scan(&count); err != nil {
+				t.Fatalf("Failed to count messages: %v", err)
+			}
+			if count != tt.expected {
+				t.Errorf("Expected %d stored messages, got %d", tt.expected, count)
+			}
+
+			// Senders of skipped messages are still recorded
+			var users int
+			if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&users); err != nil {
+				t.Fatalf("Failed to count users: %v", err)
+			}
+			if users != 3 {
+				t.Errorf("Expected 3 users, got %d", users)
+			}
+		})
+	}
+}
+
+func TestExpiredMessagesArePurgedAndNotSummarized(t *testing.T) {
+	db := newPlainTestDB(t)
+	now := time.Now().UnixMilli()
+
+	expired := groupMessage("uuid-1", now-120_000, "gone soon")
+	expired.DataMessage.ExpiresInSeconds = 60
+	expired.DataMessage.Attachments = []signal.Attachment{{ContentType: "image/jpeg"}}
+	live := groupMessage("uuid-2", now-30_000, "still here")
+	live.DataMessage.ExpiresInSeconds = 3600
+
+	for _, env := range []*signal.Envelope{expired, live, groupMessage("uuid-3", now-10_000, "forever")} {
+		if err := db.SaveMessage(env); err != nil {
+			t.Fatalf("SaveMessage failed: %v", err)
+		}
+	}
+
+	groups, _ := db.GetGroups()
+	messages, err := db.GetMessagesForSummarization(groups[0], 0, now)
+	if err != nil {
+		t.Fatalf("GetMessagesForSummarization failed: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Expected expired message to be excluded before purge, got %d messages", len(messages))
+	}
+
+	n, err := db.PurgeExpiredMessages(now)
+	if err != nil {
+		t.Fatalf("PurgeExpiredMessages failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 purged message, got %d", n)
+	}
+
+	var attachments int
+	if err := db.QueryRow("SELECT COUNT(*) FROM attachments").Scan(&attachments); err != nil {
+		t.Fatalf("Failed to count attachments: %v", err)
+	}
+	if attachments != 0 {
+		t.Errorf("Expected attachments of purged message to be removed, got %d", attachments)
+	}
+
+	// Once its timer runs out the remaining disappearing message goes too
+	if n, _ := db.PurgeExpiredMessages(now + 3600_000); n != 1 {
+		t.Errorf("Expected second purge to remove 1 message, got %d", n)
+	}
+}
+
+func TestGroupEphemeralPolicyOverride(t *testing.T) {
+	db := newPlainTestDB(t)
+	db.DefaultEphemeralPolicy = EphemeralPolicyKeep
+
+	if err := db.SaveMessage(groupMessage("uuid-1", 1000, "hi")); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	groups, _ := db.GetGroups()
+
+	policy, inherited, err := db.GroupEphemeralPolicy(groups[0])
+	if err != nil || policy != EphemeralPolicyKeep || !inherited {
+		t.Fatalf("Expected inherited keep policy, got %q inherited=%v err=%v", policy, inherited, err)
+	}
+
+	if err := db.SetGroupEphemeralPolicy(groups[0], EphemeralPolicySkip); err != nil {
+		t.Fatalf("SetGroupEphemeralPolicy failed: %v", err)
+	}
+	viewOnce := groupMessage("uuid-1", 2000, "secret")
+	viewOnce.DataMessage.ViewOnce = true
+	if err := db.SaveMessage(viewOnce); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM messages").Scan(&count); err != nil {
+		t.Fatalf("Failed to count messages: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected group override to skip view-once message, got %d messages", count)
+	}
+
+	if err := db.SetGroupEphemeralPolicy(groups[0], "shred"); err == nil {
+		t.Error("Expected invalid policy to be rejected")
+	}
+	if err := db.SetGroupEphemeralPolicy(9999, EphemeralPolicySkip); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("Expected ErrGroupNotFound, got %v", err)
+	}
+}
+
+func TestSaveMessage_PersistsMentions(t *testing.T) {
+	db := newPlainTestDB(t)
+
+	env := groupMessage("uuid-1", 1000, "￼ can you take this?")
+	env.DataMessage.Mentions = []signal.Mention{{UUID: "uuid-2", Number: "+15550000002", Start: 0, Length: 1}}
+	if err := db.SaveMessage(env); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+
+	groups, _ := db.GetGroups()
+	messages, err := db.GetMessagesForSummarization(groups[0], 0, 2000)
+	if err != nil {
+		t.Fatalf("GetMessagesForSummarization failed: %v", err)
+	}
+	if len(messages) != 1 || len(messages[0].Mentions) != 1 {
+		t.Fatalf("Expected one message with one mention, got %+v", messages)
+	}
+
+	// The mentioned member is known even though they have not written yet
+	var mentionedUUID string
+	if err := db.QueryRow("SELECT uuid FROM users WHERE id = ?", messages[0].Mentions[0].UserID).Scan(&mentionedUUID); err != nil {
+		t.Fatalf("Failed to load mentioned user: %v", err)
+	}
+	if mentionedUUID != "uuid-2" {
+		t.Errorf("Expected mention to resolve to uuid-2, got %q", mentionedUUID)
+	}
+
+	// An edit that drops the mention replaces it
+	edit := &signal.Envelope{
+		SourceUUID: "uuid-1",
+		Timestamp:  1500,
+		EditMessage: &signal.EditMessage{
+			TargetSentTimestamp: 1000,
+			DataMessage: &signal.DataMessage{
+				Timestamp: 1500,
+				Message:   "never mind",
+				GroupInfo: &signal.GroupInfo{GroupID: "group-1"},
+			},
+		},
+	}
+	if err := db.SaveMessage(edit); err != nil {
+		t.Fatalf("SaveMessage(edit) failed: %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM message_mentions").Scan(&count); err != nil {
+		t.Fatalf("Failed to count mentions: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected edit to clear stale mentions, got %d", count)
+	}
+}
+
+func TestSaveMessage_TracksRenames(t *testing.T) {
+	db := newPlainTestDB(t)
+
+	first := groupMessage("uuid-1", 1000, "hi")
+	first.SourceName = "Alice"
+	if err := db.SaveMessage(first); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+
+	renamed := groupMessage("uuid-1", 2000, "new profile name")
+	renamed.SourceName = "Alice B."
+	renamed.DataMessage.GroupInfo.GroupName = "Weekend Plans"
+	if err := db.SaveMessage(renamed); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+
+	// Receipts are not stored but still carry the current profile name
+	receipt := &signal.Envelope{SourceUUID: "uuid-1", SourceName: "Ali", Timestamp: 3000, ReceiptMessage: &signal.ReceiptMessage{}}
+	if err := db.SaveMessage(receipt); err != nil {
+		t.Fatalf("SaveMessage(receipt) failed: %v", err)
+	}
+
+	// Envelopes without a group name must not clear it
+	unnamed := groupMessage("uuid-1", 4000, "still here")
+	unnamed.SourceName = "Ali"
+	unnamed.DataMessage.GroupInfo.GroupName = ""
+	if err := db.SaveMessage(unnamed); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+
+	groups, _ := db.GetGroups()
+	groupName, err := db.GetGroupNameByID(groups[0])
+	if err != nil || groupName != "Weekend Plans" {
+		t.Errorf("Expected group name 'Weekend Plans', got %q (err=%v)", groupName, err)
+	}
+
+	var userID int64
+	if err := db.QueryRow("SELECT id FROM users WHERE uuid = 'uuid-1'").Scan(&userID); err != nil {
+		t.Fatalf("Failed to load user: %v", err)
+	}
+	userName, _ := db.GetUserNameByID(userID)
+	if userName != "Ali" {
+		t.Errorf("Expected user name 'Ali', got %q", userName)
+	}
+
+	var userRenames int
+	if err := db.QueryRow("SELECT COUNT(*) FROM name_history WHERE entity_type = 'user'").Scan(&userRenames); err != nil {
+		t.Fatalf("Failed to count user renames: %v", err)
+	}
+	if userRenames != 2 {
+		t.Errorf("Expected 2 user renames, got %d", userRenames)
+	}
+
+	history, err := db.GetGroupNameHistory(groups[0])
+	if err != nil {
+		t.Fatalf("GetGroupNameHistory failed: %v", err)
+	}
+	if len(history) != 1 || history[0].OldName != "Group" || history[0].NewName != "Weekend Plans" || history[0].ChangedAt != 2000 {
+		t.Errorf("Unexpected group history: %+v", history)
+	}
+
+	if _, err := db.GetGroupNameHistory(9999); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("Expected ErrGroupNotFound, got %v", err)
+	}
+}
+
+func TestSaveMessage_DirectMessages(t *testing.T) {
+	incoming := &signal.Envelope{
+		SourceUUID:   "uuid-1",
+		SourceNumber: "+15550000001",
+		SourceName:   "Alice",
+		Timestamp:    1000,
+		DataMessage:  &signal.DataMessage{Timestamp: 1000, Message: "can we talk tomorrow?"},
+	}
+	reply := &signal.Envelope{
+		SourceUUID: "uuid-self",
+		SourceName: "Summarizarr",
+		Timestamp:  1100,
+		SyncMessage: &signal.SyncMessage{SentMessage: &signal.SentMessage{
+			DestinationNumber: "+15550000001",
+			DestinationUUID:   "uuid-1",
+			Timestamp:         1100,
+			Message:           "sure, 10am",
+		}},
+	}
+	profileUpdate := &signal.Envelope{SourceUUID: "uuid-1", Timestamp: 1200, DataMessage: &signal.DataMessage{Timestamp: 1200}}
+	// Older signal-cli versions only report the number of the contact
+	sentByNumber := func(number string, ts int64) *signal.Envelope {
+		return &signal.Envelope{
+			SourceUUID: "uuid-self",
+			Timestamp:  ts,
+			SyncMessage: &signal.SyncMessage{SentMessage: &signal.SentMessage{
+				DestinationNumber: number,
+				Timestamp:         ts,
+				Message:           "see you",
+			}},
+		}
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		db := newPlainTestDB(t)
+		for _, env := range []*signal.Envelope{incoming, reply} {
+			if err := db.SaveMessage(env); err != nil {
+				t.Fatalf("SaveMessage failed: %v", err)
+			}
+		}
+		if groups, _ := db.GetGroups(); len(groups) != 0 {
+			t.Errorf("Expected no conversations, got %v", groups)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		db := newPlainTestDB(t)
+		db.StoreDirectMessages = true
+		for _, env := range []*signal.Envelope{incoming, reply, profileUpdate, sentByNumber("+15550000001", 1300), sentByNumber("+15550000009", 1400)} {
+			if err := db.SaveMessage(env); err != nil {
+				t.Fatalf("SaveMessage failed: %v", err)
+			}
+		}
+
+		groups, _ := db.GetGroups()
+		if len(groups) != 1 {
+			t.Fatalf("Expected both directions in one conversation, and none for an unknown number, got %v", groups)
+		}
+
+		var groupKey, name, kind string
+		if err := db.QueryRow("SELECT group_id, name, type FROM groups WHERE id = ?", groups[0]).Scan(&groupKey, &name, &kind); err != nil {
+			t.Fatalf("Failed to load conversation: %v", err)
+		}
+		if groupKey != "direct:uuid-1" || name != "Alice" || kind != ConversationDirect {
+			t.Errorf("Unexpected conversation: %q %q %q", groupKey, name, kind)
+		}
+
+		messages, err := db.GetMessagesForSummarization(groups[0], 0, 2000)
+		if err != nil {
+			t.Fatalf("GetMessagesForSummarization failed: %v", err)
+		}
+		if len(messages) != 3 {
+			t.Errorf("Expected 3 messages without the empty profile update, got %d", len(messages))
+		}
+	})
+}
+
+func TestSaveMessage_DirectMessagesPerAccount(t *testing.T) {
+	db := newPlainTestDB(t)
+	db.StoreDirectMessages = true
+	for _, account := range []string{"+15550000001", "+15550000002"} {
+		env := &signal.Envelope{
+			Account:     account,
+			SourceUUID:  "uuid-1",
+			SourceName:  "Alice",
+			Timestamp:   1000,
+			DataMessage: &signal.DataMessage{Timestamp: 1000, Message: "hi " + account},
+		}
+		if err := db.SaveMessage(env); err != nil {
+			t.Fatalf("SaveMessage failed: %v", err)
+		}
+	}
+
+	// A contact writing to two accounts has two conversations
+	rows, err := db.Query("SELECT group_id, account FROM groups ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to load conversations: %v", err)
+	}
+	defer func() { _ = rows.Close() }()
+	var got []string
+	for rows.Next() {
+		var groupKey, account string
+		if err := rows.Scan(&groupKey, &account); err != nil {
+			t.Fatalf("Failed to scan conversation: %v", err)
+		}
+		got = append(got, groupKey+"@"+account)
+	}
+	expected := "direct:+15550000001:uuid-1@+15550000001,direct:+15550000002:uuid-1@+15550000002"
+	if strings.Join(got, ",") != expected {
+		t.Errorf("Expected one conversation per account, got %v", got)
+	}
+	if contact := DirectConversationContact("direct:+15550000001:uuid-1"); contact != "uuid-1" {
+		t.Errorf("Expected the contact of the conversation, got %q", contact)
+	}
+
+	// Conversations stored before they were keyed by account are rekeyed
+	if _, err := db.Exec("INSERT INTO groups (group_id, name, type, account) VALUES ('direct:uuid-2', 'Bob', 'direct', '+15550000001'), ('direct:uuid-3', 'Carol', 'direct', NULL)"); err != nil {
+		t.Fatalf("Failed to insert conversations: %v", err)
+	}
+	if err := db.rekeyDirectConversations(); err != nil {
+		t.Fatalf("rekeyDirectConversations failed: %v", err)
+	}
+	for name, expected := range map[string]string{"Bob": "direct:+15550000001:uuid-2", "Carol": "direct:uuid-3", "Alice": "direct:+15550000001:uuid-1"} {
+		var groupKey string
+		if err := db.QueryRow("SELECT group_id FROM groups WHERE name = ? ORDER BY id LIMIT 1", name).Scan(&groupKey); err != nil || groupKey != expected {
+			t.Errorf("Expected %s to be keyed %q, got %q %v", name, expected, groupKey, err)
+		}
+	}
+}
+
+func TestSaveGroupUpdate_RecordsMembershipChanges(t *testing.T) {
+	db := newPlainTestDB(t)
+
+	update := func(ts int64, details *signal.GroupDetails) {
+		t.Helper()
+		env := &signal.Envelope{
+			SourceUUID:   "uuid-admin",
+			SourceNumber: "+15550000001",
+			SourceName:   "Admin",
+			Timestamp:    ts,
+			DataMessage: &signal.DataMessage{
+				Timestamp: ts,
+				GroupInfo: &signal.GroupInfo{GroupID: "group-1", Type: signal.GroupUpdateTypeUpdate},
+			},
+		}
+		if err := db.SaveMessage(env); err != nil {
+			t.Fatalf("SaveMessage failed: %v", err)
+		}
+		if err := db.SaveGroupUpdate(env, details); err != nil {
+			t.Fatalf("SaveGroupUpdate failed: %v", err)
+		}
+	}
+
+	// First snapshot is the baseline and produces no events
+	update(1000, &signal.GroupDetails{Name: "Group", Members: []string{"+15550000001", "+15550000002"}})
+	update(2000, &signal.GroupDetails{Name: "Group", Members: []string{"+15550000001", "+15550000003"}})
+	update(3000, &signal.GroupDetails{Name: "Book Club", Description: "Monthly reads", Members: []string{"+15550000001", "+15550000003"}})
+	update(4000, &signal.GroupDetails{Name: "Book Club", Description: "Monthly reads", Members: []string{"+15550000001", "+15550000003"}})
+
+	chat := groupMessage("uuid-3", 2500, "hi all")
+	chat.DataMessage.GroupInfo.GroupName = ""
+	if err := db.SaveMessage(chat); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+
+	groups, _ := db.GetGroups()
+	messages, err := db.GetMessagesForSummarization(groups[0], 0, 5000)
+	if err != nil {
+		t.Fatalf("GetMessagesForSummarization failed: %v", err)
+	}
+
+	var got []string
+	for _, m := range messages {
+		if m.MessageType == MessageTypeGroupEvent {
+			got = append(got, m.EventType)
+		} else {
+			got = append(got, "message:"+m.Text)
+		}
+	}
+	expected := []string{
+		GroupEventMemberJoined, GroupEventMemberLeft, "message:hi all",
+		GroupEventRenamed, GroupEventDescriptionChanged, GroupEventUpdated,
+	}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	// Update envelopes themselves are not stored as empty messages
+	var stored int
+	if err := db.QueryRow("SELECT COUNT(*) FROM messages").Scan(&stored); err != nil {
+		t.Fatalf("Failed to count messages: %v", err)
+	}
+	if stored != 1 {
+		t.Errorf("Expected only the chat message to be stored, got %d", stored)
+	}
+
+	var members int
+	if err := db.QueryRow("SELECT COUNT(*) FROM group_members WHERE group_id = ?", groups[0]).Scan(&members); err != nil {
+		t.Fatalf("Failed to count members: %v", err)
+	}
+	if members != 2 {
+		t.Errorf("Expected 2 current members, got %d", members)
+	}
+
+	// The member stored by number is the same user once they write
+	var joinedUser int64
+	if err := db.QueryRow("SELECT user_id FROM group_events WHERE event_type = ?", GroupEventMemberJoined).Scan(&joinedUser); err != nil {
+		t.Fatalf("Failed to load join event: %v", err)
+	}
+	writer := groupMessage("uuid-new", 4500, "thanks for adding me")
+	writer.SourceNumber = "+15550000003"
+	writer.DataMessage.GroupInfo.GroupName = ""
+	if err := db.SaveMessage(writer); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	var writerID int64
+	if err := db.QueryRow("SELECT id FROM users WHERE uuid = 'uuid-new'").Scan(&writerID); err != nil {
+		t.Fatalf("Failed to load writer: %v", err)
+	}
+	if writerID != joinedUser {
+		t.Errorf("Expected writer to reuse member user %d, got %d", joinedUser, writerID)
+	}
+}
+
+func TestSaveMessage_IgnoresRedelivery(t *testing.T) {
+	db := newPlainTestDB(t)
+
+	msg := groupMessage("uuid-1", 1000, "see attached")
+	msg.DataMessage.Attachments = []signal.Attachment{{ContentType: "image/png"}}
+	reaction := &signal.Envelope{
+		SourceUUID: "uuid-2",
+		Timestamp:  1100,
+		DataMessage: &signal.DataMessage{
+			Timestamp: 1100,
+			GroupInfo: &signal.GroupInfo{GroupID: "group-1"},
+			Reaction:  &signal.Reaction{Emoji: "👍", TargetAuthorUUID: "uuid-1", TargetSentTimestamp: 1000},
+		},
+	}
+	edit := &signal.Envelope{
+		SourceUUID: "uuid-1",
+		Timestamp:  1200,
+		EditMessage: &signal.EditMessage{
+			TargetSentTimestamp: 1000,
+			DataMessage:         &signal.DataMessage{Timestamp: 1200, Message: "see attached (v2)", GroupInfo: &signal.GroupInfo{GroupID: "group-1"}},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		for _, env := range []*signal.Envelope{msg, reaction, edit} {
+			if err := db.SaveMessage(env); err != nil {
+				t.Fatalf("SaveMessage failed: %v", err)
+			}
+		}
+	}
+
+	for table, expected := range map[string]int{"messages": 2, "attachments": 1, "message_edits": 1} {
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			t.Fatalf("Failed to count %s: %v", table, err)
+		}
+		if count != expected {
+			t.Errorf("Expected %d rows in %s, got %d", expected, table, count)
+		}
+	}
+}
+
+func TestMigrateMessageIdentity_CollapsesDuplicates(t *testing.T) {
+	db := newPlainTestDB(t)
+
+	// Simulate a database from before the unique index
+	if _, err := db.Exec("DROP INDEX " + messageIdentityIndex); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO users (id, uuid, name) VALUES (1, 'uuid-1', 'Alice');
+		INSERT INTO groups (id, group_id, name) VALUES (1, 'group-1', 'Group');
+		INSERT INTO messages (id, timestamp, message_text, user_id, group_id) VALUES
+			(1, 1000, 'hello', 1, 1), (2, 1000, 'hello', 1, 1), (3, 2000, 'bye', 1, 1), (4, 1000, 'hello', 1, 1);
+		INSERT INTO attachments (message_id, content_type) VALUES (1, 'image/png'), (2, 'image/png'), (4, 'image/png');
+	`); err != nil {
+		t.Fatalf("Failed to insert duplicates: %v", err)
+	}
+
+	if err := db.migrateMessageIdentity(); err != nil {
+		t.Fatalf("migrateMessageIdentity failed: %v", err)
+	}
+
+	var ids []int64
+	rows, err := db.Query("SELECT id FROM messages ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to query messages: %v", err)
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("Failed to scan id: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	_ = rows.Close()
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Errorf("Expected messages 1 and 3 to remain, got %v", ids)
+	}
+
+	var attachments int
+	if err := db.QueryRow("SELECT COUNT(*) FROM attachments").Scan(&attachments); err != nil {
+		t.Fatalf("Failed to count attachments: %v", err)
+	}
+	if attachments != 1 {
+		t.Errorf("Expected attachments of duplicates to be removed, got %d", attachments)
+	}
+
+	if _, err := db.Exec("INSERT INTO messages (timestamp, user_id, group_id) VALUES (2000, 1, 1)"); err == nil {
+		t.Error("Expected unique index to reject a duplicate")
+	}
+}
+
+func TestGetMessagesForSummarization_AggregatesReactions(t *testing.T) {
+	db := newPlainTestDB(t)
+
+	react := func(uuid string, ts int64, emoji string, targetTS int64, remove bool) *signal.Envelope {
+		return &signal.Envelope{
+			SourceUUID: uuid,
+			Timestamp:  ts,
+			DataMessage: &signal.DataMessage{
+				Timestamp: ts,
+				GroupInfo: &signal.GroupInfo{GroupID: "group-1"},
+				Reaction:  &signal.Reaction{Emoji: emoji, TargetAuthorUUID: "uuid-1", TargetSentTimestamp: targetTS, IsRemove: remove},
+			},
+		}
+	}
+
+	for _, env := range []*signal.Envelope{
+		groupMessage("uuid-1", 500, "old announcement"),
+		groupMessage("uuid-1", 1000, "party at 8"),
+		react("uuid-2", 1100, "👍", 1000, false),
+		react("uuid-3", 1200, "👍", 1000, false),
+		react("uuid-4", 1300, "😂", 1000, false),
+		react("uuid-4", 1400, "❤️", 1000, false), // replaces 😂
+		react("uuid-5", 1500, "👍", 1000, false),
+		react("uuid-5", 1600, "👍", 1000, true), // removed again
+		react("uuid-2", 1700, "🎉", 500, false),
+		react("uuid-3", 1800, "🎉", 9999, false), // unknown target
+	} {
+		if err := db.SaveMessage(env); err != nil {
+			t.Fatalf("SaveMessage failed: %v", err)
+		}
+	}
+
+	groups, _ := db.GetGroups()
+	messages, err := db.GetMessagesForSummarization(groups[0], 900, 2000)
+	if err != nil {
+		t.Fatalf("GetMessagesForSummarization failed: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Expected the message and the earlier reaction target, got %+v", messages)
+	}
+
+	party := messages[0]
+	if party.Text != "party at 8" || len(party.Reactions) != 2 ||
+		party.Reactions[0] != (ReactionCount{Emoji: "👍", Count: 2}) ||
+		party.Reactions[1] != (ReactionCount{Emoji: "❤️", Count: 1}) {
+		t.Errorf("Unexpected reactions on message: %+v", party)
+	}
+
+	earlier := messages[1]
+	if earlier.MessageType != MessageTypeEarlierMessage || earlier.Text != "old announcement" ||
+		len(earlier.Reactions) != 1 || earlier.Reactions[0].Emoji != "🎉" {
+		t.Errorf("Unexpected earlier message: %+v", earlier)
+	}
+}
+
+func TestSaveMessage_SameGroupSeenByTwoAccounts(t *testing.T) {
+	db := newPlainTestDB(t)
+
+	for _, account := range []string{"+15550000001", "+15550000002"} {
+		msg := groupMessage("uuid-1", 1000, "hello")
+		msg.Account = account
+		if err := db.SaveMessage(msg); err != nil {
+			t.Fatalf("SaveMessage failed: %v", err)
+		}
+	}
+
+	var groups, messages int
+	if err := db.QueryRow("SELECT COUNT(*) FROM groups").Scan(&groups); err != nil {
+		t.Fatalf("Failed to count groups: %v", err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM messages").Scan(&messages); err != nil {
+		t.Fatalf("Failed to count messages: %v", err)
+	}
+	if groups != 1 || messages != 1 {
+		t.Errorf("Expected 1 group and 1 message, got %d and %d", groups, messages)
+	}
+
+	var groupAccount, messageAccount string
+	if err := db.QueryRow("SELECT g.account, m.account FROM messages m JOIN groups g ON m.group_id = g.id").Scan(&groupAccount, &messageAccount); err != nil {
+		t.Fatalf("Failed to query accounts: %v", err)
+	}
+	if groupAccount != "+15550000001" || messageAccount != "+15550000001" {
+		t.Errorf("Expected the first account to be kept, got group %q and message %q", groupAccount, messageAccount)
+	}
+}
+
+func TestSummaryDelivery(t *testing.T) {
+	db := newPlainTestDB(t)
+
+	msg := groupMessage("uuid-1", 1000, "hello")
+	msg.Account = "+15550000001"
+	if err := db.SaveMessage(msg); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	if err := db.SetGroupSummaryDelivery(1, DeliveryGroup); err != nil {
+		t.Fatalf("SetGroupSummaryDelivery failed: %v", err)
+	}
+	if err := db.SetGroupSummaryDelivery(42, DeliveryGroup); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("Expected ErrGroupNotFound, got %v", err)
+	}
+
+	target, err := db.GetDeliveryTarget(1)
+	if err != nil {
+		t.Fatalf("GetDeliveryTarget failed: %v", err)
+	}
+	expected := DeliveryTarget{Mode: DeliveryGroup, SignalGroupID: "group-1", ConversationType: ConversationGroup, GroupName: "Group", Account: "+15550000001"}
+	if target != expected {
+		t.Errorf("Unexpected target: %+v", target)
+	}
+
+	id, err := db.SaveSummary(1, "summary", 0, 1000)
+	if err != nil {
+		t.Fatalf("SaveSummary failed: %v", err)
+	}
+	if err := db.SetSummaryDeliveryStatus(id, DeliveryStatusFailed, "not registered", 0); err != nil {
+		t.Fatalf("SetSummaryDeliveryStatus failed: %v", err)
+	}
+	summaries, err := db.GetSummaries()
+	if err != nil {
+		t.Fatalf("GetSummaries failed: %v", err)
+	}
+	if len(summaries) != 1 || summaries[0].DeliveryStatus != DeliveryStatusFailed || summaries[0].DeliveryError != "not registered" {
+		t.Errorf("Unexpected summaries: %+v", summaries)
+	}
+}
+
+func TestGroupSettings_ExcludedSendersInEditsAndQuotes(t *testing.T) {
+	db := newPlainTestDB(t)
+
+	if err := db.SaveMessage(groupMessage("uuid-2", 1000, "secret plan")); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	reply := groupMessage("uuid-1", 2000, "sounds good")
+	reply.DataMessage.Quote = &signal.Quote{
+		ID:          1000,
+		AuthorUUID:  "uuid-2",
+		Text:        "secret plan",
+		Attachments: []signal.Attachment{{ContentType: "image/jpeg", Filename: "plan.jpg"}},
+	}
+	if err := db.SaveMessage(reply); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	if err := db.SetGroupSettings(1, GroupSettings{Ingest: true, Summarize: true, ExcludedSenders: []string{"uuid-2"}}); err != nil {
+		t.Fatalf("SetGroupSettings failed: %v", err)
+	}
+
+	// Edits of an excluded sender's earlier message are not stored either
+	edit := &signal.Envelope{
+		SourceUUID: "uuid-2",
+		Timestamp:  3000,
+		EditMessage: &signal.EditMessage{
+			TargetSentTimestamp: 1000,
+			DataMessage: &signal.DataMessage{
+				Timestamp: 3000,
+				Message:   "new secret plan",
+				GroupInfo: &signal.GroupInfo{GroupID: "group-1"},
+			},
+		},
+	}
+	if err := db.SaveMessage(edit); err != nil {
+		t.Fatalf("SaveMessage(edit) failed: %v", err)
+	}
+	var text string
+	if err := db.QueryRow("SELECT message_text FROM messages WHERE timestamp = 1000").Scan(&text); err != nil {
+		t.Fatalf("Failed to load message: %v", err)
+	}
+	if text != "secret plan" {
+		t.Errorf("Expected the edit to be skipped, got %q", text)
+	}
+
+	messages, err := db.GetMessagesForSummarization(1, 0, 5000)
+	if err != nil {
+		t.Fatalf("GetMessagesForSummarization failed: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("Expected only the reply, got %d messages", len(messages))
+	}
+	if messages[0].Text != "sounds good" || messages[0].QuoteText != "" || len(messages[0].Attachments) != 0 {
+		t.Errorf("Expected the quoted content of the excluded sender to be hidden, got %+v", messages[0])
+	}
+}
+
+func TestGroupSettings_EnforcedOnIngestAndSummarization(t *testing.T) {
+	db := newPlainTestDB(t)
+
+	if err := db.SaveMessage(groupMessage("uuid-1", 1000, "first")); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	if err := db.SetGroupSettings(1, GroupSettings{Ingest: true, Summarize: true, ExcludedSenders: []string{"uuid-2"}}); err != nil {
+		t.Fatalf("SetGroupSettings failed: %v", err)
+	}
+	if err := db.SaveMessage(groupMessage("uuid-2", 2000, "secret")); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	if err := db.SaveMessage(groupMessage("uuid-1", 3000, "second")); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+
+	messages, err := db.GetMessagesForSummarization(1, 0, 5000)
+	if err != nil {
+		t.Fatalf("GetMessagesForSummarization failed: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Expected the excluded sender to be dropped, got %d messages", len(messages))
+	}
+
+	// Excluding a sender later also hides what was stored before
+	if err := db.SetGroupSettings(1, GroupSettings{Ingest: false, Summarize: true, ExcludedSenders: []string{"uuid-1"}}); err != nil {
+		t.Fatalf("SetGroupSettings failed: %v", err)
+	}
+	if messages, _ := db.GetMessagesForSummarization(1, 0, 5000); len(messages) != 0 {
+		t.Errorf("Expected no messages from excluded senders, got %d", len(messages))
+	}
+	if err := db.SaveMessage(groupMessage("uuid-3", 4000, "not stored")); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM messages").Scan(&count); err != nil {
+		t.Fatalf("Failed to count messages: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected ingestion to be off, got %d messages", count)
+	}
+
+	if err := db.SetGroupSettings(1, GroupSettings{Ingest: true, Summarize: false}); err != nil {
+		t.Fatalf("SetGroupSettings failed: %v", err)
+	}
+	groups, err := db.GetGroups()
+	if err != nil {
+		t.Fatalf("GetGroups failed: %v", err)
+	}
+	if len(groups) != 0 {
+		t.Errorf("Expected the group to be skipped by the scheduler, got %v", groups)
+	}
+	if messages, _ := db.GetMessagesForSummarization(1, 0, 5000); messages != nil {
+		t.Errorf("Expected no messages for a group with summarization off, got %d", len(messages))
+	}
+}
+
+func TestImportMessage_DeduplicatesAndKeepsNames(t *testing.T) {
+	db := newPlainTestDB(t)
+
+	if err := db.SaveMessage(groupMessage("uuid-1", 5000, "live")); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+
+	lookup, ok, err := db.LookupMessage(groupMessage("uuid-1", 5000, "live"))
+	if err != nil || !ok {
+		t.Fatalf("LookupMessage failed: %v %v", ok, err)
+	}
+	if !lookup.Exists || lookup.GroupID != "group-1" || lookup.Timestamp != 5000 {
+		t.Errorf("Expected the stored message to be found, got %+v", lookup)
+	}
+	if _, ok, _ := db.LookupMessage(&signal.Envelope{SourceUUID: "uuid-1", ReceiptMessage: &signal.ReceiptMessage{}}); ok {
+		t.Error("Expected receipts not to be importable")
+	}
+
+	// History carries the names of the time
+	old := groupMessage("uuid-1", 1000, "history")
+	old.SourceName = "Old Name"
+	old.DataMessage.GroupInfo.GroupName = "Old Group"
+	if lookup, _, _ := db.LookupMessage(old); lookup.Exists {
+		t.Error("Expected the historical message to be new")
+	}
+	if err := db.ImportMessage(old); err != nil {
+		t.Fatalf("ImportMessage failed: %v", err)
+	}
+	if lookup, _, _ := db.LookupMessage(old); !lookup.Exists {
+		t.Error("Expected the imported message to be found")
+	}
+
+	var userName, groupName string
+	var renames int
+	if err := db.QueryRow("SELECT name FROM users WHERE uuid = 'uuid-1'").Scan(&userName); err != nil {
+		t.Fatalf("Failed to query user: %v", err)
+	}
+	if err := db.QueryRow("SELECT name FROM groups WHERE group_id = 'group-1'").Scan(&groupName); err != nil {
+		t.Fatalf("Failed to query group: %v", err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM name_history").Scan(&renames); err != nil {
+		t.Fatalf("Failed to query name history: %v", err)
+	}
+	if userName != "Member uuid-1" || groupName != "Group" || renames != 0 {
+		t.Errorf("Expected names to be kept, got %q %q and %d renames", userName, groupName, renames)
+	}
+
+	if _, err := db.SaveSummary(1, "summary", 0, 2000); err != nil {
+		t.Fatalf("SaveSummary failed: %v", err)
+	}
+	if covered, _ := db.HasSummaryOverlapping(1, 1000, 3000); !covered {
+		t.Error("Expected an overlapping summary")
+	}
+	if covered, _ := db.HasSummaryOverlapping(1, 2000, 3000); covered {
+		t.Error("Expected an adjacent window not to overlap")
+	}
+
+	// Queued windows count until they are summarized
+	if _, err := db.EnqueueSummaryJob(1, 2000, 4000, false); err != nil {
+		t.Fatalf("EnqueueSummaryJob failed: %v", err)
+	}
+	if covered, _ := db.HasSummaryOverlapping(1, 2000, 3000); !covered {
+		t.Error("Expected a queued job to cover the window")
+	}
+}
+
+func TestSummaryJobs_RecordProgress(t *testing.T) {
+	db := newPlainTestDB(t)
+	if err := db.SaveMessage(groupMessage("uuid-1", 1000, "hello")); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+
+	if group, err := db.GetGroupSchedule(1); err != nil || group.SummarizedUntil != 0 {
+		t.Fatalf("Expected a new group to have no progress, got %d %v", group.SummarizedUntil, err)
+	}
+	// Groups summarized before progress was recorded continue after their last summary
+	if _, err := db.SaveSummary(1, "summary", 0, 2000); err != nil {
+		t.Fatalf("SaveSummary failed: %v", err)
+	}
+	if group, _ := db.GetGroupSchedule(1); group.SummarizedUntil != 2000 {
+		t.Errorf("Expected progress from the latest summary, got %d", group.SummarizedUntil)
+	}
+
+	for _, end := range []int64{3000, 4000} {
+		if created, err := db.EnqueueSummaryJob(1, end-1000, end, false); err != nil || !created {
+			t.Fatalf("EnqueueSummaryJob failed: %v %v", created, err)
+		}
+	}
+	if created, _ := db.EnqueueSummaryJob(1, 2000, 3000, true); created {
+		t.Error("Expected a queued window not to be queued twice")
+	}
+	if group, _ := db.GetGroupSchedule(1); group.SummarizedUntil != 2000 || group.QueuedUntil != 4000 {
+		t.Errorf("Expected windows queued until 4000, got %+v", group)
+	}
+
+	// An empty window moves progress without a summary
+	job, err := db.ClaimSummaryJob(0)
+	if err != nil || job == nil || job.Start != 2000 || job.Attempts != 1 {
+		t.Fatalf("Expected the first window, got %+v %v", job, err)
+	}
+	if id, err := db.CompleteSummaryJob(job.ID, SummaryResult{}); err != nil || id != 0 {
+		t.Fatalf("CompleteSummaryJob failed: %d %v", id, err)
+	}
+	job, _ = db.ClaimSummaryJob(0)
+	if id, err := db.CompleteSummaryJob(job.ID, SummaryResult{Text: "next", PromptTokens: 1200, CompletionTokens: 150, Provider: "groq"}); err != nil || id == 0 {
+		t.Fatalf("CompleteSummaryJob failed: %d %v", id, err)
+	}
+	if group, _ := db.GetGroupSchedule(1); group.SummarizedUntil != 4000 {
+		t.Errorf("Expected progress at 4000, got %d", group.SummarizedUntil)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM summaries").Scan(&count); err != nil || count != 2 {
+		t.Errorf("Expected 2 summaries, got %d %v", count, err)
+	}
+	summaries, err := db.GetSummaries()
+	if err != nil {
+		t.Fatalf("GetSummaries failed: %v", err)
+	}
+	for _, s := range summaries {
+		if s.Text == "next" && (s.PromptTokens != 1200 || s.CompletionTokens != 150 || s.Provider != "groq") {
+			t.Errorf("Expected the tokens and provider of the summary to be recorded, got %+v", s)
+		}
+	}
+
+	if _, err := db.GetGroupSchedule(42); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("Expected ErrGroupNotFound, got %v", err)
+	}
+	if n, err := db.PruneSummaryJobs(time.Now().Add(-time.Hour).UnixMilli()); err != nil || n != 0 {
+		t.Errorf("Expected recently finished jobs to be kept, got %d %v", n, err)
+	}
+	if n, err := db.PruneSummaryJobs(time.Now().Add(time.Hour).UnixMilli()); err != nil || n != 2 {
+		t.Errorf("Expected the finished jobs to be pruned, got %d %v", n, err)
+	}
+}
+
+func TestEnqueueSummaryRequest_ManualAndRegenerate(t *testing.T) {
+	db := newPlainTestDB(t)
+	if err := db.SaveMessage(groupMessage("uuid-1", 1000, "hello")); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	if _, err := db.EnqueueSummaryRequest(SummaryRequest{GroupID: 42, Start: 0, End: 2000}); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("Expected ErrGroupNotFound, got %v", err)
+	}
+	if _, err := db.EnqueueSummaryRequest(SummaryRequest{SummaryID: 42}); !errors.Is(err, ErrSummaryNotFound) {
+		t.Errorf("Expected ErrSummaryNotFound, got %v", err)
+	}
+	if _, err := db.GetSummaryJob(42); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+
+	// Manual jobs overlap scheduled windows without moving progress, and run first
+	if _, err := db.EnqueueSummaryJob(1, 0, 2000, true); err != nil {
+		t.Fatalf("EnqueueSummaryJob failed: %v", err)
+	}
+	jobID, err := db.EnqueueSummaryRequest(SummaryRequest{GroupID: 1, Start: 0, End: 2000, Provider: "ollama", Prompt: "Be brief"})
+	if err != nil {
+		t.Fatalf("EnqueueSummaryRequest failed: %v", err)
+	}
+	job, err := db.ClaimSummaryJob(0)
+	if err != nil || job == nil || job.ID != jobID || job.Kind != JobManual || job.Provider != "ollama" || job.Prompt != "Be brief" {
+		t.Fatalf("Expected the manual job, got %+v %v", job, err)
+	}
+	summaryID, err := db.CompleteSummaryJob(job.ID, SummaryResult{Text: "first"})
+	if err != nil || summaryID == 0 {
+		t.Fatalf("CompleteSummaryJob failed: %d %v", summaryID, err)
+	}
+	if group, _ := db.GetGroupSchedule(1); group.SummarizedUntil != 0 || group.QueuedUntil != 2000 {
+		t.Errorf("Expected manual jobs not to move progress, got %+v", group)
+	}
+	if job, _ := db.GetSummaryJob(jobID); job.State != JobDone || job.SummaryID != summaryID {
+		t.Errorf("Expected the job to be done, got %+v", job)
+	}
+
+	// Regenerating keeps the summary ID and the previous text
+	for _, text := range []string{"second", "third"} {
+		jobID, err := db.EnqueueSummaryRequest(SummaryRequest{SummaryID: summaryID})
+		if err != nil {
+			t.Fatalf("EnqueueSummaryRequest failed: %v", err)
+		}
+		job, _ := db.ClaimSummaryJob(0)
+		if job == nil || job.ID != jobID || job.Kind != JobRegenerate || job.GroupID != 1 || job.End != 2000 {
+			t.Fatalf("Expected the regenerate job, got %+v", job)
+		}
+		if id, err := db.CompleteSummaryJob(job.ID, SummaryResult{Text: text}); err != nil || id != summaryID {
+			t.Fatalf("CompleteSummaryJob failed: %d %v", id, err)
+		}
+	}
+	var text string
+	if err := db.QueryRow("SELECT summary_text FROM summaries WHERE id = ?", summaryID).Scan(&text); err != nil || text != "third" {
+		t.Errorf("Expected the regenerated text, got %q %v", text, err)
+	}
+	history, err := db.GetSummaryHistory(summaryID)
+	if err != nil || len(history) != 2 || history[0].Text != "second" || history[1].Text != "first" {
+		t.Errorf("Expected the previous versions newest first, got %+v %v", history, err)
+	}
+
+	if err := db.DeleteSummary(summaryID); err != nil {
+		t.Fatalf("DeleteSummary failed: %v", err)
+	}
+	if _, err := db.GetSummaryHistory(summaryID); !errors.Is(err, ErrSummaryNotFound) {
+		t.Errorf("Expected ErrSummaryNotFound, got %v", err)
+	}
+}
+
+func TestClaimSummaryJob_RunsGroupWindowsInOrder(t *testing.T) {
+	db := newPlainTestDB(t)
+	for _, env := range []*signal.Envelope{groupMessage("uuid-1", 1000, "hello"), {
+		SourceUUID: "uuid-2", Timestamp: 1000,
+		DataMessage: &signal.DataMessage{Timestamp: 1000, Message: "hi", GroupInfo: &signal.GroupInfo{GroupID: "group-2", GroupName: "Other"}},
+	}} {
+		if err := db.SaveMessage(env); err != nil {
+			t.Fatalf("SaveMessage failed: %v", err)
+		}
+	}
+	for _, w := range [][3]int64{{1, 0, 1000}, {1, 1000, 2000}, {2, 0, 1000}} {
+		if _, err := db.EnqueueSummaryJob(w[0], w[1], w[2], false); err != nil {
+			t.Fatalf("EnqueueSummaryJob failed: %v", err)
+		}
+	}
+
+	first, _ := db.ClaimSummaryJob(0)
+	other, _ := db.ClaimSummaryJob(0)
+	if first == nil || other == nil || first.GroupID == other.GroupID {
+		t.Fatalf("Expected one job per group, got %+v and %+v", first, other)
+	}
+	// The second window of group 1 waits for the first
+	if job, _ := db.ClaimSummaryJob(0); job != nil {
+		t.Fatalf("Expected no job while both groups are running, got %+v", job)
+	}
+	group1 := first
+	if group1.GroupID != 1 {
+		group1 = other
+	}
+	if err := db.RetrySummaryJob(group1.ID, "provider down", 5000); err != nil {
+		t.Fatalf("RetrySummaryJob failed: %v", err)
+	}
+	if job, _ := db.ClaimSummaryJob(4999); job != nil {
+		t.Fatalf("Expected the retry to wait, and later windows with it, got %+v", job)
+	}
+	job, _ := db.ClaimSummaryJob(5000)
+	if job == nil || job.ID != group1.ID || job.Attempts != 2 || job.LastError != "provider down" {
+		t.Fatalf("Expected the retried job, got %+v", job)
+	}
+
+	// Interrupted jobs are queued again, a failed one no longer holds back the group
+	if n, err := db.ResetRunningSummaryJobs(); err != nil || n != 2 {
+		t.Fatalf("Expected 2 running jobs to be reset, got %d %v", n, err)
+	}
+	job, _ = db.ClaimSummaryJob(5000)
+	if job.GroupID != 1 {
+		job, _ = db.ClaimSummaryJob(5000)
+	}
+	if err := db.FailSummaryJob(job.ID, "context too long"); err != nil {
+		t.Fatalf("FailSummaryJob failed: %v", err)
+	}
+	if next, _ := db.ClaimSummaryJob(5000); next == nil || next.GroupID != 1 || next.Start != 1000 {
+		t.Errorf("Expected the next window of group 1, got %+v", next)
+	}
+}
+
+func TestRollSummaryJob_CarriesWindowIntoNextSummary(t *testing.T) {
+	db := newPlainTestDB(t)
+	if err := db.SaveMessage(groupMessage("uuid-1", 1500, "ok")); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	for _, start := range []int64{1000, 2000, 3000, 4000} {
+		if _, err := db.EnqueueSummaryJob(1, start, start+1000, false); err != nil {
+			t.Fatalf("EnqueueSummaryJob failed: %v", err)
+		}
+	}
+
+	// Quiet hours put the job back without using up an attempt
+	job, _ := db.ClaimSummaryJob(0)
+	if err := db.DeferSummaryJob(job.ID, 500); err != nil {
+		t.Fatalf("DeferSummaryJob failed: %v", err)
+	}
+	if next, _ := db.ClaimSummaryJob(0); next != nil {
+		t.Fatalf("Expected the group to wait for the deferred job, got %+v", next)
+	}
+	job, _ = db.ClaimSummaryJob(500)
+	if job == nil || job.Start != 1000 || job.Attempts != 1 {
+		t.Fatalf("Expected the deferred job with one attempt, got %+v", job)
+	}
+
+	if err := db.RollSummaryJob(job.ID); err != nil {
+		t.Fatalf("RollSummaryJob failed: %v", err)
+	}
+	// An empty window keeps the rolled one for the next summary
+	job, _ = db.ClaimSummaryJob(500)
+	if err := db.RollSummaryJob(job.ID); err != nil {
+		t.Fatalf("RollSummaryJob failed: %v", err)
+	}
+	job, _ = db.ClaimSummaryJob(500)
+	if _, err := db.CompleteSummaryJob(job.ID, SummaryResult{}); err != nil {
+		t.Fatalf("CompleteSummaryJob failed: %v", err)
+	}
+	group, _ := db.GetGroupSchedule(1)
+	if group.SummarizedUntil != 4000 || group.CarryFrom != 1000 {
+		t.Fatalf("Expected windows from 1000 to be carried, got %+v", group)
+	}
+
+	job, _ = db.ClaimSummaryJob(500)
+	summaryID, err := db.CompleteSummaryJob(job.ID, SummaryResult{Text: "summary"})
+	if err != nil || summaryID == 0 {
+		t.Fatalf("CompleteSummaryJob failed: %d %v", summaryID, err)
+	}
+	var start, end int64
+	if err := db.QueryRow("SELECT start_timestamp, end_timestamp FROM summaries WHERE id = ?", summaryID).Scan(&start, &end); err != nil || start != 1000 || end != 5000 {
+		t.Errorf("Expected the summary to cover the rolled windows, got %d-%d %v", start, end, err)
+	}
+	if group, _ := db.GetGroupSchedule(1); group.SummarizedUntil != 5000 || group.CarryFrom != 0 {
+		t.Errorf("Expected the carried windows to be summarized, got %+v", group)
+	}
+}
+
+func TestSetGroupSchedule(t *testing.T) {
+	db := newPlainTestDB(t)
+	if err := db.SaveMessage(groupMessage("uuid-1", 1000, "hello")); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+
+	five := 5
+	if err := db.SetGroupSchedule(1, schedule.Config{Spec: "0 8 * * *", TimeZone: "Europe/Berlin", QuietHours: "off", MinMessages: &five}); err != nil {
+		t.Fatalf("SetGroupSchedule failed: %v", err)
+	}
+	schedules, err := db.ListGroupSchedules()
+	if err != nil || len(schedules) != 1 {
+		t.Fatalf("Expected one group, got %v %v", schedules, err)
+	}
+	if s := schedules[0]; s.Name != "Group" || s.Schedule != "0 8 * * *" || s.TimeZone != "Europe/Berlin" ||
+		s.QuietHours != "off" || s.MinMessages == nil || *s.MinMessages != 5 || s.MinChars != nil {
+		t.Errorf("Unexpected schedule: %+v", s)
+	}
+
+	// Empty values inherit the global schedule again
+	if err := db.SetGroupSchedule(1, schedule.Config{}); err != nil {
+		t.Fatalf("SetGroupSchedule failed: %v", err)
+	}
+	if s, _ := db.GetGroupSchedule(1); s.Config() != (schedule.Config{}) {
+		t.Errorf("Expected the schedule to be cleared, got %+v", s)
+	}
+	if err := db.SetGroupSchedule(42, schedule.Config{Spec: "1h"}); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("Expected ErrGroupNotFound, got %v", err)
+	}
+}
+
+func TestLLMCalls_UsageAndSummaryLink(t *testing.T) {
+	db := newPlainTestDB(t)
+	if err := db.SaveMessage(groupMessage("uuid-1", 1500, "ok")); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	jobID, err := db.EnqueueSummaryRequest(SummaryRequest{GroupID: 1, Start: 1000, End: 2000})
+	if err != nil {
+		t.Fatalf("EnqueueSummaryRequest failed: %v", err)
+	}
+
+	day := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC).UnixMilli()
+	for _, call := range []LLMCall{
+		{GroupID: 1, JobID: jobID, Provider: "openai", Model: "gpt-4o-mini", Error: "timeout", LatencyMs: 120000, CreatedAt: day},
+		{GroupID: 1, JobID: jobID, Provider: "openai", Model: "gpt-4o-mini", PromptTokens: 1000, CompletionTokens: 100, Cost: 0.25, CreatedAt: day + 1000},
+		{Provider: "local", PromptTokens: 50, CompletionTokens: 5, CreatedAt: day + 24*time.Hour.Milliseconds()},
+	} {
+		if err := db.RecordLLMCall(call); err != nil {
+			t.Fatalf("RecordLLMCall failed: %v", err)
+		}
+	}
+
+	job, _ := db.ClaimSummaryJob(0)
+	summaryID, err := db.CompleteSummaryJob(job.ID, SummaryResult{Text: "summary"})
+	if err != nil {
+		t.Fatalf("CompleteSummaryJob failed: %v", err)
+	}
+	var linked int
+	if err := db.QueryRow("SELECT COUNT(*) FROM llm_calls WHERE summary_id = ?", summaryID).Scan(&linked); err != nil || linked != 2 {
+		t.Errorf("Expected both calls of the job linked to the summary, got %d %v", linked, err)
+	}
+
+	usage, err := db.GetLLMUsage(day-time.Hour.Milliseconds(), day+48*time.Hour.Milliseconds())
+	if err != nil {
+		t.Fatalf("GetLLMUsage failed: %v", err)
+	}
+	if usage.Total != (UsageTotals{Calls: 3, FailedCalls: 1, PromptTokens: 1050, CompletionTokens: 105, Cost: 0.25}) {
+		t.Errorf("Unexpected total: %+v", usage.Total)
+	}
+	if len(usage.Groups) != 1 || usage.Groups[0].GroupName != "Group" || usage.Groups[0].Calls != 2 {
+		t.Errorf("Expected the calls of the group, got %+v", usage.Groups)
+	}
+	if len(usage.Days) != 2 || usage.Days[0].Day != "2024-03-01" || usage.Days[0].Cost != 0.25 || usage.Days[1].Calls != 1 {
+		t.Errorf("Expected two days, got %+v", usage.Days)
+	}
+
+	if cost, err := db.LLMCostSince(day + 2000); err != nil || cost != 0 {
+		t.Errorf("Expected no cost after the paid calls, got %v %v", cost, err)
+	}
+	if cost, _ := db.LLMCostSince(day); cost != 0.25 {
+		t.Errorf("Expected the cost of the day, got %v", cost)
+	}
 }
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Summary delivery targets stored in groups.summary_delivery. An empty target
+// keeps summaries in the web UI only.
+const (
+	DeliveryGroup  = "group"  // post into the summarized group itself
+	DeliverySelf   = "self"   // post to the account's note-to-self chat
+	DeliveryDigest = "digest" // post into the configured digest group
+)
+
+// Delivery states stored in summaries.delivery_status.
+const (
+	DeliveryStatusSent   = "sent"
+	DeliveryStatusFailed = "failed"
+)
+
+// ValidSummaryDelivery reports whether target is a known delivery target.
+func ValidSummaryDelivery(target string) bool {
+	switch target {
+	case "", DeliveryGroup, DeliverySelf, DeliveryDigest:
+		return true
+	}
+	return false
+}
+
+// DeliveryTarget describes where summaries of a group are posted.
+type DeliveryTarget struct {
+	Mode             string
+	SignalGroupID    string
+	ConversationType string
+	GroupName        string
+	// Account that received the group; empty for groups stored before
+	// accounts were tracked
+	Account string
+}
+
+// GetDeliveryTarget returns the delivery settings of a group.
+func (db *DB) GetDeliveryTarget(groupID int64) (DeliveryTarget, error) {
+	var t DeliveryTarget
+	var mode, conversationType, name, account sql.NullString
+	err := db.QueryRow("SELECT summary_delivery, group_id, type, name, account FROM groups WHERE id = ?", groupID).
+		Scan(&mode, &t.SignalGroupID, &conversationType, &name, &account)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, ErrGroupNotFound
+	}
+	if err != nil {
+		return t, fmt.Errorf("failed to query group delivery: %w", err)
+	}
+	t.Mode = mode.String
+	t.ConversationType = conversationType.String
+	if t.ConversationType == "" {
+		t.ConversationType = ConversationGroup
+	}
+	t.GroupName = name.String
+	t.Account = account.String
+	return t, nil
+}
+
+// SetGroupSummaryDelivery sets where summaries of a group are posted. An
+// empty target turns posting off.
+func (db *DB) SetGroupSummaryDelivery(groupID int64, target string) error {
+	if !ValidSummaryDelivery(target) {
+		return fmt.Errorf("invalid summary delivery target: %s", target)
+	}
+	res, err := db.Exec("UPDATE groups SET summary_delivery = ? WHERE id = ?", nullIfEmpty(target), groupID)
+	if err != nil {
+		return fmt.Errorf("failed to update summary delivery: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// SetSummaryDeliveryStatus records the outcome of posting a summary.
+func (db *DB) SetSummaryDeliveryStatus(summaryID int64, status, deliveryError string, deliveredAt int64) error {
+	var at interface{}
+	if deliveredAt > 0 {
+		at = deliveredAt
+	}
+	if _, err := db.Exec("UPDATE summaries SET delivery_status = ?, delivery_error = ?, delivered_at = ? WHERE id = ?",
+		status, nullIfEmpty(deliveryError), at, summaryID); err != nil {
+		return fmt.Errorf("failed to update summary delivery status: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Ephemeral message policies control how disappearing and view-once messages
+// are stored.
+const (
+	// EphemeralPolicyRespect drops view-once content and stores expiring
+	// messages only until their timer runs out.
+	EphemeralPolicyRespect = "respect"
+	// EphemeralPolicySkip stores neither view-once nor expiring messages.
+	EphemeralPolicySkip = "skip"
+	// EphemeralPolicyKeep stores everything indefinitely.
+	EphemeralPolicyKeep = "keep"
+)
+
+// ErrGroupNotFound is returned when a group lookup by internal ID fails.
+var ErrGroupNotFound = errors.New("group not found")
+
+// ValidEphemeralPolicy reports whether p is a known ephemeral policy.
+func ValidEphemeralPolicy(p string) bool {
+	switch p {
+	case EphemeralPolicyRespect, EphemeralPolicySkip, EphemeralPolicyKeep:
+		return true
+	}
+	return false
+}
+
+func (db *DB) defaultEphemeralPolicy() string {
+	if ValidEphemeralPolicy(db.DefaultEphemeralPolicy) {
+		return db.DefaultEphemeralPolicy
+	}
+	return EphemeralPolicyRespect
+}
+
+// groupEphemeralPolicy returns the effective policy for a group.
+func (db *DB) groupEphemeralPolicy(tx *sql.Tx, groupID int64) (string, error) {
+	var policy sql.NullString
+	if err := tx.QueryRow("SELECT ephemeral_policy FROM groups WHERE id = ?", groupID).Scan(&policy); err != nil {
+		return "", fmt.Errorf("failed to query ephemeral policy: %w", err)
+	}
+	if policy.Valid && ValidEphemeralPolicy(policy.String) {
+		return policy.String, nil
+	}
+	return db.defaultEphemeralPolicy(), nil
+}
+
+// applyEphemeralPolicy decides whether a message is stored and, if it
+// disappears, when it expires (ms since epoch).
+func applyEphemeralPolicy(policy string, timestamp int64, expiresInSeconds int, viewOnce bool) (store bool, expiresAt sql.NullInt64) {
+	if policy == EphemeralPolicyKeep {
+		return true, expiresAt
+	}
+	if viewOnce {
+		return false, expiresAt
+	}
+	if expiresInSeconds > 0 {
+		if policy == EphemeralPolicySkip {
+			return false, expiresAt
+		}
+		expiresAt = sql.NullInt64{Int64: timestamp + int64(expiresInSeconds)*1000, Valid: true}
+	}
+	return true, expiresAt
+}
+
+// GroupEphemeralPolicy returns the configured policy for a group and whether it
+// is inherited from the default.
+func (db *DB) GroupEphemeralPolicy(groupID int64) (policy string, inherited bool, err error) {
+	var p sql.NullString
+	err = db.QueryRow("SELECT ephemeral_policy FROM groups WHERE id = ?", groupID).Scan(&p)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, ErrGroupNotFound
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get ephemeral policy for group %d: %w", groupID, err)
+	}
+	if p.Valid && ValidEphemeralPolicy(p.String) {
+		return p.String, false, nil
+	}
+	return db.defaultEphemeralPolicy(), true, nil
+}
+
+// SetGroupEphemeralPolicy overrides the policy for a group. An empty policy
+// restores the default.
+func (db *DB) SetGroupEphemeralPolicy(groupID int64, policy string) error {
+	if policy != "" && !ValidEphemeralPolicy(policy) {
+		return fmt.Errorf("invalid ephemeral policy %q", policy)
+	}
+	var value any
+	if policy != "" {
+		value = policy
+	}
+	res, err := db.Exec("UPDATE groups SET ephemeral_policy = ? WHERE id = ?", value, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to set ephemeral policy: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// PurgeExpiredMessages deletes disappearing messages whose timer ran out
+// before now (ms since epoch) and returns how many were removed.
+func (db *DB) PurgeExpiredMessages(now int64) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("Failed to rollback transaction", "error", err)
+		}
+	}()
+
+	// Child rows are removed explicitly so purging does not depend on the
+	// foreign_keys pragma being enabled on this connection
+	const expired = "SELECT id FROM messages WHERE expires_at IS NOT NULL AND expires_at <= ?"
+	if _, err := tx.Exec("DELETE FROM attachments WHERE message_id IN ("+expired+")", now); err != nil {
+		return 0, fmt.Errorf("failed to purge attachments: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM message_edits WHERE message_id IN ("+expired+")", now); err != nil {
+		return 0, fmt.Errorf("failed to purge edit history: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM message_mentions WHERE message_id IN ("+expired+")", now); err != nil {
+		return 0, fmt.Errorf("failed to purge mentions: %w", err)
+	}
+	res, err := tx.Exec("DELETE FROM messages WHERE expires_at IS NOT NULL AND expires_at <= ?", now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge expired messages: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit purge: %w", err)
+	}
+
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// RunExpirySweeper purges expired messages every interval until ctx is done.
+func (db *DB) RunExpirySweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := db.PurgeExpiredMessages(time.Now().UnixMilli())
+		if err != nil {
+			slog.Error("Failed to purge expired messages", "error", err)
+		} else if n > 0 {
+			slog.Info("Purged expired messages", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"summarizarr/internal/signal"
+)
+
+// Group event types stored in group_events.event_type.
+const (
+	GroupEventMemberJoined       = "member_joined"
+	GroupEventMemberLeft         = "member_left"
+	GroupEventRenamed            = "renamed"
+	GroupEventDescriptionChanged = "description_changed"
+	// GroupEventUpdated covers changes signal-cli does not detail, such as
+	// a new avatar or changed permissions.
+	GroupEventUpdated = "updated"
+)
+
+// MessageTypeGroupEvent is the MessageForSummary.MessageType of group events.
+const MessageTypeGroupEvent = "group_event"
+
+func saveGroupEvent(tx *sql.Tx, groupID int64, eventType string, userID int64, detail string, timestamp int64) error {
+	var user interface{}
+	if userID > 0 {
+		user = userID
+	}
+	if _, err := tx.Exec("INSERT INTO group_events (group_id, event_type, user_id, detail, timestamp) VALUES (?, ?, ?, ?, ?)",
+		groupID, eventType, user, detail, timestamp); err != nil {
+		return fmt.Errorf("failed to insert group event: %w", err)
+	}
+	return nil
+}
+
+// SaveGroupUpdate stores the current membership of a group and records the
+// differences to the previously stored state as group events. The first
+// snapshot of a group only establishes the baseline.
+func (db *DB) SaveGroupUpdate(msg *signal.Envelope, details *signal.GroupDetails) error {
+	group := msg.Group()
+	if group == nil {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("Failed to rollback transaction", "error", err)
+		}
+	}()
+
+	groupID, err := db.findOrCreateGroup(tx, group.GroupID, details.Name, ConversationGroup, msg.Account)
+	if err != nil {
+		return fmt.Errorf("failed to find or create group: %w", err)
+	}
+	ingest, _, err := groupFlags(tx, groupID)
+	if err != nil {
+		return err
+	}
+	if !ingest {
+		return tx.Commit()
+	}
+
+	var actorID int64
+	if msg.SourceUUID != "" {
+		if actorID, err = db.findOrCreateUser(tx, msg.SourceUUID, msg.SourceNumber, msg.SourceName); err != nil {
+			return fmt.Errorf("failed to find or create user: %w", err)
+		}
+	}
+	at := msg.Timestamp
+
+	previous := make(map[string]bool)
+	rows, err := tx.Query("SELECT member FROM group_members WHERE group_id = ?", groupID)
+	if err != nil {
+		return fmt.Errorf("failed to query group members: %w", err)
+	}
+	for rows.Next() {
+		var member string
+		if err := rows.Scan(&member); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("failed to scan group member: %w", err)
+		}
+		previous[member] = true
+	}
+	if err := rows.Close(); err != nil {
+		return fmt.Errorf("failed to close group members: %w", err)
+	}
+	// A group always has at least one member (us), so none stored means first sync
+	baseline := len(previous) == 0
+
+	var oldDescription sql.NullString
+	if err := tx.QueryRow("SELECT description FROM groups WHERE id = ?", groupID).Scan(&oldDescription); err != nil {
+		return fmt.Errorf("failed to query group description: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM group_members WHERE group_id = ?", groupID); err != nil {
+		return fmt.Errorf("failed to clear group members: %w", err)
+	}
+	admins := make(map[string]bool, len(details.Admins))
+	for _, a := range details.Admins {
+		admins[a] = true
+	}
+
+	changed := false
+	current := make(map[string]bool, len(details.Members))
+	for _, member := range details.Members {
+		if member == "" || current[member] {
+			continue
+		}
+		current[member] = true
+
+		userID, err := db.findOrCreateMember(tx, member)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO group_members (group_id, member, user_id, is_admin) VALUES (?, ?, ?, ?)",
+			groupID, member, userID, admins[member]); err != nil {
+			return fmt.Errorf("failed to insert group member: %w", err)
+		}
+		if !baseline && !previous[member] {
+			if err := saveGroupEvent(tx, groupID, GroupEventMemberJoined, userID, "", at); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+
+	if !baseline {
+		// Sorted for a stable event order
+		var left []string
+		for member := range previous {
+			if !current[member] {
+				left = append(left, member)
+			}
+		}
+		sort.Strings(left)
+		for _, member := range left {
+			userID, err := db.findOrCreateMember(tx, member)
+			if err != nil {
+				return err
+			}
+			if err := saveGroupEvent(tx, groupID, GroupEventMemberLeft, userID, "", at); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+
+	renamed, err := renameIfChanged(tx, nameEntityGroup, groupID, details.Name, at)
+	if err != nil {
+		return err
+	}
+	if renamed {
+		if err := saveGroupEvent(tx, groupID, GroupEventRenamed, actorID, details.Name, at); err != nil {
+			return err
+		}
+		changed = true
+	}
+
+	if details.Description != oldDescription.String {
+		if _, err := tx.Exec("UPDATE groups SET description = ? WHERE id = ?", details.Description, groupID); err != nil {
+			return fmt.Errorf("failed to update group description: %w", err)
+		}
+		if !baseline {
+			if err := saveGroupEvent(tx, groupID, GroupEventDescriptionChanged, actorID, "", at); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+
+	// The envelope's own rename was already recorded by SaveMessage
+	if !baseline && !changed && group.Type == signal.GroupUpdateTypeUpdate && !db.hasGroupEventAt(tx, groupID, at) {
+		if err := saveGroupEvent(tx, groupID, GroupEventUpdated, actorID, "", at); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// hasGroupEventAt reports whether an event was already recorded for the
+// update envelope with the given timestamp.
+func (db *DB) hasGroupEventAt(tx *sql.Tx, groupID int64, timestamp int64) bool {
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM group_events WHERE group_id = ? AND timestamp = ?", groupID, timestamp).Scan(&n); err != nil {
+		slog.Warn("Failed to check for group events", "error", err)
+		return false
+	}
+	return n > 0
+}
+
+// findOrCreateMember resolves a member identifier from signal-cli, which is a
+// phone number or a UUID, to a user. Unknown members are created without a
+// name so summaries fall back to a generic label until they write.
+func (db *DB) findOrCreateMember(tx *sql.Tx, member string) (int64, error) {
+	column := "uuid"
+	if strings.HasPrefix(member, "+") {
+		column = "number"
+	}
+
+	var id int64
+	err := tx.QueryRow("SELECT id FROM users WHERE "+column+" = ? ORDER BY id LIMIT 1", member).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("failed to query member: %w", err)
+	}
+
+	res, err := tx.Exec("INSERT INTO users ("+column+") VALUES (?)", member)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert member: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// getGroupEvents returns the group events in a time window as summary lines.
+func (db *DB) getGroupEvents(groupID int64, start, end int64) ([]MessageForSummary, error) {
+	rows, err := db.Query(`
+		SELECT e.timestamp, COALESCE(e.user_id, 0), e.event_type, COALESCE(e.detail, '')
+		FROM group_events e
+		WHERE e.group_id = ? AND e.timestamp BETWEEN ? AND ?
+		ORDER BY e.timestamp ASC, e.id ASC
+	`, groupID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group events: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("Failed to close rows", "error", err, "context", "getGroupEvents")
+		}
+	}()
+
+	var events []MessageForSummary
+	for rows.Next() {
+		e := MessageForSummary{GroupID: groupID, MessageType: MessageTypeGroupEvent}
+		if err := rows.Scan(&e.Timestamp, &e.UserID, &e.EventType, &e.Text); err != nil {
+			return nil, fmt.Errorf("failed to scan group event: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// mergeByTimestamp interleaves two timestamp-ordered slices. Entries of extra
+// sort before messages at the same instant.
+func mergeByTimestamp(messages, extra []MessageForSummary) []MessageForSummary {
+	if len(extra) == 0 {
+		return messages
+	}
+	merged := make([]MessageForSummary, 0, len(messages)+len(extra))
+	i, j := 0, 0
+	for i < len(messages) && j < len(extra) {
+		if extra[j].Timestamp <= messages[i].Timestamp {
+			merged = append(merged, extra[j])
+			j++
+		} else {
+			merged = append(merged, messages[i])
+			i++
+		}
+	}
+	merged = append(merged, messages[i:]...)
+	return append(merged, extra[j:]...)
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"fmt"
+
+	"summarizarr/internal/signal"
+)
+
+// MessageLookup describes where SaveMessage stores an envelope.
+type MessageLookup struct {
+	// GroupID is the Signal group ID, or the synthetic ID of a direct
+	// conversation
+	GroupID   string
+	GroupName string
+	Timestamp int64
+	// Exists is set when the message is already stored, in which case
+	// SaveMessage skips it as a duplicate
+	Exists bool
+}
+
+// LookupMessage reports where SaveMessage would store an envelope without
+// writing anything, which lets imports report duplicates before they run. ok
+// is false for envelopes that do not add a message: receipts, edits,
+// deletions and messages outside a conversation.
+func (db *DB) LookupMessage(msg *signal.Envelope) (lookup MessageLookup, ok bool, err error) {
+	if msg.ReceiptMessage != nil || msg.Edit() != nil {
+		return MessageLookup{}, false, nil
+	}
+	if del, _ := msg.Deletion(); del != nil {
+		return MessageLookup{}, false, nil
+	}
+
+	groupInfo := msg.Group()
+	text, attachments, reaction := "", []signal.Attachment(nil), (*signal.Reaction)(nil)
+	lookup.Timestamp = msg.Timestamp
+	switch {
+	case msg.DataMessage != nil:
+		text, attachments, reaction = msg.DataMessage.Message, msg.DataMessage.Attachments, msg.DataMessage.Reaction
+	case msg.SyncMessage != nil && msg.SyncMessage.SentMessage != nil:
+		sent := msg.SyncMessage.SentMessage
+		text, attachments, reaction = sent.Message, sent.Attachments, sent.Reaction
+		if sent.Timestamp > 0 {
+			lookup.Timestamp = sent.Timestamp
+		}
+	default:
+		return MessageLookup{}, false, nil
+	}
+
+	if groupInfo != nil {
+		if groupInfo.Type == signal.GroupUpdateTypeUpdate && !hasContent(text, attachments, reaction) {
+			return MessageLookup{}, false, nil
+		}
+		lookup.GroupID, lookup.GroupName = groupInfo.GroupID, groupInfo.GroupName
+	} else {
+		directInfo, directName, err := db.directConversation(msg)
+		if err != nil {
+			return MessageLookup{}, false, err
+		}
+		if directInfo == nil {
+			return MessageLookup{}, false, nil
+		}
+		lookup.GroupID, lookup.GroupName = directInfo.GroupID, directName
+	}
+
+	var count int
+	if err := db.QueryRow(`
+		SELECT COUNT(*) FROM messages m
+		JOIN users u ON m.user_id = u.id
+		JOIN groups g ON m.group_id = g.id
+		WHERE g.group_id = ? AND u.uuid = ? AND m.timestamp = ?
+	`, lookup.GroupID, msg.SourceUUID, lookup.Timestamp).Scan(&count); err != nil {
+		return MessageLookup{}, false, fmt.Errorf("failed to look up message: %w", err)
+	}
+	lookup.Exists = count > 0
+	return lookup, true, nil
+}
+
+// ImportMessage stores an envelope read from an export, like SaveMessage.
+// Exports carry the names of the time, so known users and groups keep their
+// current name.
+func (db *DB) ImportMessage(msg *signal.Envelope) error {
+	return db.saveMessage(msg, true)
+}
+
+// HasSummaryOverlapping reports whether a summary of the group, or a summary
+// job that is queued or running, already covers part of the window.
+func (db *DB) HasSummaryOverlapping(groupID int64, start, end int64) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM summaries WHERE group_id = ? AND start_timestamp < ? AND end_timestamp > ?)
+			+ (SELECT COUNT(*) FROM summary_jobs WHERE group_id = ? AND state IN ('pending', 'running') AND start_timestamp < ? AND end_timestamp > ?)
+	`, groupID, end, start, groupID, end, start).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to query summaries: %w", err)
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,436 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// Summary job states
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+	// JobRolled windows had too little activity and are summarized with
+	// the next window
+	JobRolled = "rolled"
+)
+
+// Summary job kinds
+const (
+	// JobScheduled summarizes a window of the group's schedule
+	JobScheduled = "scheduled"
+	// JobManual summarizes a time range requested through the API
+	JobManual = "manual"
+	// JobRegenerate replaces the text of an existing summary
+	JobRegenerate = "regenerate"
+)
+
+// ErrJobNotFound is returned for summary jobs that do not exist.
+var ErrJobNotFound = errors.New("summary job not found")
+
+// ErrSummaryNotFound is returned for summaries that do not exist.
+var ErrSummaryNotFound = errors.New("summary not found")
+
+// SummaryJob is the summarization of one window of a group.
+type SummaryJob struct {
+	ID      int64  `json:"id"`
+	Kind    string `json:"kind"`
+	GroupID int64  `json:"groupId"`
+	Start   int64  `json:"start"`
+	End     int64  `json:"end"`
+	// Deliver posts the summary to Signal
+	Deliver bool `json:"deliver"`
+	// Provider and Prompt override the configured ones if not empty
+	Provider string `json:"provider,omitempty"`
+	Prompt   string `json:"prompt,omitempty"`
+	State    string `json:"state"`
+	Attempts int    `json:"attempts"`
+	// LastError is the error of the last failed attempt
+	LastError string `json:"lastError,omitempty"`
+	// RunAfter is the earliest time of the next attempt in ms
+	RunAfter int64 `json:"runAfter"`
+	// SummaryID is the summary that was created, or is regenerated
+	SummaryID int64  `json:"summaryId,omitempty"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// SummaryRequest asks for a summary outside the schedule.
+type SummaryRequest struct {
+	GroupID    int64
+	Start, End int64
+	// SummaryID regenerates an existing summary, whose group and window
+	// replace GroupID, Start and End
+	SummaryID int64
+	Provider  string
+	Prompt    string
+}
+
+const summaryJobColumns = `id, kind, group_id, start_timestamp, end_timestamp, deliver, COALESCE(provider, ''), COALESCE(prompt, ''),
+	state, attempts, COALESCE(last_error, ''), run_after, COALESCE(summary_id, 0), created_at, updated_at`
+
+func scanSummaryJob(row interface{ Scan(...any) error }) (*SummaryJob, error) {
+	var job SummaryJob
+	err := row.Scan(&job.ID, &job.Kind, &job.GroupID, &job.Start, &job.End, &job.Deliver, &job.Provider, &job.Prompt,
+		&job.State, &job.Attempts, &job.LastError, &job.RunAfter, &job.SummaryID, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetSummaryJob returns a summary job.
+func (db *DB) GetSummaryJob(jobID int64) (*SummaryJob, error) {
+	job, err := scanSummaryJob(db.QueryRow("SELECT "+summaryJobColumns+" FROM summary_jobs WHERE id = ?", jobID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query summary job: %w", err)
+	}
+	return job, nil
+}
+
+// EnqueueSummaryRequest queues a manual summary or the regeneration of a
+// summary and returns the job ID.
+func (db *DB) EnqueueSummaryRequest(req SummaryRequest) (int64, error) {
+	kind := JobManual
+	if req.SummaryID != 0 {
+		kind = JobRegenerate
+		err := db.QueryRow("SELECT group_id, start_timestamp, end_timestamp FROM summaries WHERE id = ?", req.SummaryID).
+			Scan(&req.GroupID, &req.Start, &req.End)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrSummaryNotFound
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to query summary: %w", err)
+		}
+	} else {
+		var exists int
+		if err := db.QueryRow("SELECT COUNT(*) FROM groups WHERE id = ?", req.GroupID).Scan(&exists); err != nil {
+			return 0, fmt.Errorf("failed to query group: %w", err)
+		}
+		if exists == 0 {
+			return 0, ErrGroupNotFound
+		}
+	}
+
+	res, err := db.Exec(`
+		INSERT INTO summary_jobs (kind, group_id, start_timestamp, end_timestamp, provider, prompt, summary_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, kind, req.GroupID, req.Start, req.End, nullIfEmpty(req.Provider), nullIfEmpty(req.Prompt),
+		sql.NullInt64{Int64: req.SummaryID, Valid: req.SummaryID != 0})
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue summary job: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// EnqueueSummaryJob queues the summarization of a window of the group's
+// schedule. It reports false if the window was already queued.
+func (db *DB) EnqueueSummaryJob(groupID, start, end int64, deliver bool) (bool, error) {
+	res, err := db.Exec(`
+		INSERT OR IGNORE INTO summary_jobs (group_id, start_timestamp, end_timestamp, deliver)
+		VALUES (?, ?, ?, ?)
+	`, groupID, start, end, deliver)
+	if err != nil {
+		return false, fmt.Errorf("failed to enqueue summary job: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to enqueue summary job: %w", err)
+	}
+	return n > 0, nil
+}
+
+// ClaimSummaryJob marks the next job that is due as running and returns it,
+// or nil if no job is due. Jobs of a group run one at a time, oldest window
+// first, so a window waiting for a retry holds back the later ones.
+func (db *DB) ClaimSummaryJob(now int64) (*SummaryJob, error) {
+	// Requested summaries go first, as someone is waiting for them
+	job, err := scanSummaryJob(db.QueryRow(`
+		UPDATE summary_jobs
+		SET state = 'running', attempts = attempts + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT j.id FROM summary_jobs j
+			WHERE j.state = 'pending' AND j.run_after <= ?
+			AND (j.kind != 'scheduled' OR NOT EXISTS (
+				SELECT 1 FROM summary_jobs o
+				WHERE o.group_id = j.group_id AND o.id != j.id AND o.kind = 'scheduled'
+				AND (o.state = 'running' OR (o.state = 'pending' AND o.start_timestamp < j.start_timestamp))
+			))
+			ORDER BY j.kind = 'scheduled', j.run_after, j.start_timestamp, j.id
+			LIMIT 1
+		) AND state = 'pending'
+		RETURNING `+summaryJobColumns, now))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim summary job: %w", err)
+	}
+	return job, nil
+}
+
+// SummaryResult is a generated summary, the tokens generating it took and
+// the provider that generated it.
+type SummaryResult struct {
+	Text             string
+	PromptTokens     int
+	CompletionTokens int
+	Provider         string
+}
+
+// CompleteSummaryJob saves the summary of a running job. Scheduled jobs
+// record their window as summarized, and an empty summary records it without
+// a summary. Regenerated summaries keep their ID and their previous text in
+// summary_history. It returns the summary ID, or 0 if nothing was saved.
+func (db *DB) CompleteSummaryJob(jobID int64, result SummaryResult) (int64, error) {
+	summaryText := result.Text
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("Failed to rollback transaction", "error", err)
+		}
+	}()
+
+	job, err := scanSummaryJob(tx.QueryRow("SELECT "+summaryJobColumns+" FROM summary_jobs WHERE id = ?", jobID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrJobNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to query summary job: %w", err)
+	}
+
+	var summaryID int64
+	switch job.Kind {
+	case JobRegenerate:
+		summaryID = job.SummaryID
+		if err := replaceSummary(tx, summaryID, summaryText); err != nil {
+			return 0, err
+		}
+	case JobManual:
+		// Pin the progress of groups that fall back to their latest summary
+		if _, err := tx.Exec(`
+			UPDATE groups SET summarized_until = COALESCE((SELECT MAX(end_timestamp) FROM summaries WHERE group_id = groups.id), 0)
+			WHERE id = ? AND summarized_until IS NULL
+		`, job.GroupID); err != nil {
+			return 0, fmt.Errorf("failed to update summary progress: %w", err)
+		}
+		res, err := tx.Exec("INSERT INTO summaries (group_id, summary_text, start_timestamp, end_timestamp) VALUES (?, ?, ?, ?)", job.GroupID, summaryText, job.Start, job.End)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert summary: %w", err)
+		}
+		if summaryID, err = res.LastInsertId(); err != nil {
+			return 0, fmt.Errorf("failed to get summary id: %w", err)
+		}
+	default:
+		if summaryID, err = saveSummaryWindow(tx, job.GroupID, summaryText, job.Start, job.End); err != nil {
+			return 0, err
+		}
+	}
+	if summaryID != 0 {
+		if _, err := tx.Exec("UPDATE summaries SET prompt_tokens = ?, completion_tokens = ?, provider = NULLIF(?, '') WHERE id = ?",
+			result.PromptTokens, result.CompletionTokens, result.Provider, summaryID); err != nil {
+			return 0, fmt.Errorf("failed to record summary tokens: %w", err)
+		}
+		// Calls of failed attempts count towards the summary as well
+		if _, err := tx.Exec("UPDATE llm_calls SET summary_id = ? WHERE job_id = ?", summaryID, jobID); err != nil {
+			return 0, fmt.Errorf("failed to link llm calls: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`
+		UPDATE summary_jobs SET state = 'done', last_error = NULL, summary_id = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, sql.NullInt64{Int64: summaryID, Valid: summaryID != 0}, jobID); err != nil {
+		return 0, fmt.Errorf("failed to complete summary job: %w", err)
+	}
+	return summaryID, tx.Commit()
+}
+
+// RollSummaryJob records the window of a scheduled job as processed without
+// a summary. Its messages are summarized with the next window.
+func (db *DB) RollSummaryJob(jobID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("Failed to rollback transaction", "error", err)
+		}
+	}()
+
+	var groupID, start, end int64
+	err = tx.QueryRow("SELECT group_id, start_timestamp, end_timestamp FROM summary_jobs WHERE id = ?", jobID).Scan(&groupID, &start, &end)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrJobNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query summary job: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE groups SET summary_carry_from = COALESCE(summary_carry_from, ?), summarized_until = ? WHERE id = ?",
+		start, end, groupID); err != nil {
+		return fmt.Errorf("failed to roll summary window: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE summary_jobs SET state = 'rolled', last_error = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ?", jobID); err != nil {
+		return fmt.Errorf("failed to complete summary job: %w", err)
+	}
+	return tx.Commit()
+}
+
+// DeferSummaryJob queues a claimed job again at runAfter without counting
+// the attempt.
+func (db *DB) DeferSummaryJob(jobID int64, runAfter int64) error {
+	if _, err := db.Exec(`
+		UPDATE summary_jobs SET state = 'pending', attempts = MAX(attempts - 1, 0), run_after = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, runAfter, jobID); err != nil {
+		return fmt.Errorf("failed to defer summary job: %w", err)
+	}
+	return nil
+}
+
+// RetrySummaryJob records a failed attempt and queues the job again at
+// runAfter.
+func (db *DB) RetrySummaryJob(jobID int64, lastError string, runAfter int64) error {
+	if _, err := db.Exec(`
+		UPDATE summary_jobs SET state = 'pending', last_error = ?, run_after = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, lastError, runAfter, jobID); err != nil {
+		return fmt.Errorf("failed to reschedule summary job: %w", err)
+	}
+	return nil
+}
+
+// FailSummaryJob gives up on a job. Later windows of the group are
+// summarized without it.
+func (db *DB) FailSummaryJob(jobID int64, lastError string) error {
+	if _, err := db.Exec(`
+		UPDATE summary_jobs SET state = 'failed', last_error = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, lastError, jobID); err != nil {
+		return fmt.Errorf("failed to mark summary job failed: %w", err)
+	}
+	return nil
+}
+
+// ResetRunningSummaryJobs queues the jobs that were interrupted by a
+// shutdown again.
+func (db *DB) ResetRunningSummaryJobs() (int64, error) {
+	res, err := db.Exec("UPDATE summary_jobs SET state = 'pending', updated_at = CURRENT_TIMESTAMP WHERE state = 'running'")
+	if err != nil {
+		return 0, fmt.Errorf("failed to reset running summary jobs: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// PruneSummaryJobs deletes jobs that finished before the given time in ms.
+// Failed jobs are kept.
+func (db *DB) PruneSummaryJobs(before int64) (int64, error) {
+	res, err := db.Exec("DELETE FROM summary_jobs WHERE state IN ('done', 'rolled') AND updated_at < datetime(? / 1000, 'unixepoch')", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune summary jobs: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// replaceSummary moves the text of a summary to summary_history and replaces
+// it.
+func replaceSummary(tx *sql.Tx, summaryID int64, summaryText string) error {
+	res, err := tx.Exec(`
+		INSERT INTO summary_history (summary_id, summary_text, created_at)
+		SELECT id, summary_text, created_at FROM summaries WHERE id = ?
+	`, summaryID)
+	if err != nil {
+		return fmt.Errorf("failed to save summary history: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrSummaryNotFound
+	}
+	if _, err := tx.Exec("UPDATE summaries SET summary_text = ?, created_at = CURRENT_TIMESTAMP WHERE id = ?", summaryText, summaryID); err != nil {
+		return fmt.Errorf("failed to update summary: %w", err)
+	}
+	return nil
+}
+
+// SummaryVersion is an earlier text of a regenerated summary.
+type SummaryVersion struct {
+	ID         int64  `json:"id"`
+	Text       string `json:"text"`
+	CreatedAt  string `json:"created_at"`
+	ReplacedAt string `json:"replaced_at"`
+}
+
+// GetSummaryHistory returns the earlier versions of a summary, newest first.
+func (db *DB) GetSummaryHistory(summaryID int64) ([]SummaryVersion, error) {
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM summaries WHERE id = ?", summaryID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to query summary: %w", err)
+	}
+	if exists == 0 {
+		return nil, ErrSummaryNotFound
+	}
+
+	rows, err := db.Query(`
+		SELECT id, COALESCE(summary_text, ''), COALESCE(created_at, ''), replaced_at
+		FROM summary_history WHERE summary_id = ?
+		ORDER BY id DESC
+	`, summaryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query summary history: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("Failed to close rows", "error", err, "context", "GetSummaryHistory")
+		}
+	}()
+
+	versions := []SummaryVersion{}
+	for rows.Next() {
+		var v SummaryVersion
+		if err := rows.Scan(&v.ID, &v.Text, &v.CreatedAt, &v.ReplacedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan summary version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// saveSummaryWindow saves a summary, if not empty, and records the window as
+// summarized.
+func saveSummaryWindow(tx *sql.Tx, groupID int64, summaryText string, start, end int64) (int64, error) {
+	var summaryID int64
+	if summaryText != "" {
+		// The summary covers the windows rolled into this one
+		var carryFrom sql.NullInt64
+		if err := tx.QueryRow("SELECT summary_carry_from FROM groups WHERE id = ?", groupID).Scan(&carryFrom); err != nil {
+			return 0, fmt.Errorf("failed to query rolled windows: %w", err)
+		}
+		if carryFrom.Valid && carryFrom.Int64 < start {
+			start = carryFrom.Int64
+		}
+		res, err := tx.Exec("INSERT INTO summaries (group_id, summary_text, start_timestamp, end_timestamp) VALUES (?, ?, ?, ?)", groupID, summaryText, start, end)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert summary: %w", err)
+		}
+		if summaryID, err = res.LastInsertId(); err != nil {
+			return 0, fmt.Errorf("failed to get summary id: %w", err)
+		}
+	}
+	// Empty windows keep the rolled ones for the next summary
+	if _, err := tx.Exec(`
+		UPDATE groups SET summarized_until = ?, summary_carry_from = CASE WHEN ? THEN NULL ELSE summary_carry_from END
+		WHERE id = ?
+	`, end, summaryText != "", groupID); err != nil {
+		return 0, fmt.Errorf("failed to update summarized window: %w", err)
+	}
+	return summaryID, nil
+}
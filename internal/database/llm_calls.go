@@ -0,0 +1,142 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// LLMCall is one call to an AI provider.
+type LLMCall struct {
+	// Group and job the call summarized for, 0 if none
+	GroupID          int64
+	JobID            int64
+	Provider         string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	// Cost in USD from the price table
+	Cost      float64
+	LatencyMs int64
+	// Error is empty for successful calls
+	Error     string
+	CreatedAt int64
+}
+
+// RecordLLMCall saves a call to an AI provider.
+func (db *DB) RecordLLMCall(call LLMCall) error {
+	_, err := db.Exec(`
+		INSERT INTO llm_calls (group_id, job_id, provider, model, prompt_tokens, completion_tokens, cost, latency_ms, error, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, sql.NullInt64{Int64: call.GroupID, Valid: call.GroupID != 0}, sql.NullInt64{Int64: call.JobID, Valid: call.JobID != 0},
+		call.Provider, call.Model, call.PromptTokens, call.CompletionTokens, call.Cost, call.LatencyMs,
+		sql.NullString{String: call.Error, Valid: call.Error != ""}, call.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record llm call: %w", err)
+	}
+	return nil
+}
+
+// LLMCostSince returns the cost in USD of the calls since a time in ms.
+func (db *DB) LLMCostSince(since int64) (float64, error) {
+	var cost float64
+	if err := db.QueryRow("SELECT COALESCE(SUM(cost), 0) FROM llm_calls WHERE created_at >= ?", since).Scan(&cost); err != nil {
+		return 0, fmt.Errorf("failed to query llm cost: %w", err)
+	}
+	return cost, nil
+}
+
+// UsageTotals adds up the calls to AI providers.
+type UsageTotals struct {
+	Calls            int     `json:"calls"`
+	FailedCalls      int     `json:"failedCalls"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// GroupUsage is the usage of summaries of one group.
+type GroupUsage struct {
+	GroupID   int64  `json:"groupId"`
+	GroupName string `json:"groupName"`
+	UsageTotals
+}
+
+// DayUsage is the usage of one UTC day.
+type DayUsage struct {
+	Day string `json:"day"`
+	UsageTotals
+}
+
+// LLMUsage is the usage of a time range, in total, per group and per day.
+type LLMUsage struct {
+	Total  UsageTotals  `json:"total"`
+	Groups []GroupUsage `json:"groups"`
+	Days   []DayUsage   `json:"days"`
+}
+
+// usageTotalsColumns aggregates llm_calls into UsageTotals
+const usageTotalsColumns = `COUNT(*), COUNT(c.error), COALESCE(SUM(c.prompt_tokens), 0), COALESCE(SUM(c.completion_tokens), 0), COALESCE(SUM(c.cost), 0)`
+
+// GetLLMUsage aggregates the calls from start to end, in ms, end excluded.
+// Groups are ordered by cost, days by date.
+func (db *DB) GetLLMUsage(start, end int64) (LLMUsage, error) {
+	usage := LLMUsage{Groups: []GroupUsage{}, Days: []DayUsage{}}
+	t := &usage.Total
+	err := db.QueryRow("SELECT "+usageTotalsColumns+" FROM llm_calls c WHERE c.created_at >= ? AND c.created_at < ?", start, end).
+		Scan(&t.Calls, &t.FailedCalls, &t.PromptTokens, &t.CompletionTokens, &t.Cost)
+	if err != nil {
+		return usage, fmt.Errorf("failed to query llm usage: %w", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT c.group_id, COALESCE(g.name, ''), `+usageTotalsColumns+`
+		FROM llm_calls c LEFT JOIN groups g ON g.id = c.group_id
+		WHERE c.created_at >= ? AND c.created_at < ? AND c.group_id IS NOT NULL
+		GROUP BY c.group_id ORDER BY SUM(c.cost) DESC, c.group_id
+	`, start, end)
+	if err != nil {
+		return usage, fmt.Errorf("failed to query llm usage per group: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("Failed to close rows", "error", err, "context", "GetLLMUsage")
+		}
+	}()
+	for rows.Next() {
+		var g GroupUsage
+		if err := rows.Scan(&g.GroupID, &g.GroupName, &g.Calls, &g.FailedCalls, &g.PromptTokens, &g.CompletionTokens, &g.Cost); err != nil {
+			return usage, fmt.Errorf("failed to scan llm usage: %w", err)
+		}
+		usage.Groups = append(usage.Groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return usage, fmt.Errorf("failed to read llm usage per group: %w", err)
+	}
+
+	dayRows, err := db.Query(`
+		SELECT strftime('%Y-%m-%d', c.created_at / 1000, 'unixepoch') AS day, `+usageTotalsColumns+`
+		FROM llm_calls c
+		WHERE c.created_at >= ? AND c.created_at < ?
+		GROUP BY day ORDER BY day
+	`, start, end)
+	if err != nil {
+		return usage, fmt.Errorf("failed to query llm usage per day: %w", err)
+	}
+	defer func() {
+		if err := dayRows.Close(); err != nil {
+			slog.Error("Failed to close rows", "error", err, "context", "GetLLMUsage")
+		}
+	}()
+	for dayRows.Next() {
+		var d DayUsage
+		if err := dayRows.Scan(&d.Day, &d.Calls, &d.FailedCalls, &d.PromptTokens, &d.CompletionTokens, &d.Cost); err != nil {
+			return usage, fmt.Errorf("failed to scan llm usage: %w", err)
+		}
+		usage.Days = append(usage.Days, d)
+	}
+	if err := dayRows.Err(); err != nil {
+		return usage, fmt.Errorf("failed to read llm usage per day: %w", err)
+	}
+	return usage, nil
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"summarizarr/internal/signal"
+)
+
+// Entity types recorded in name_history.
+const (
+	nameEntityUser  = "user"
+	nameEntityGroup = "group"
+)
+
+// NameChange is a single rename of a user or group.
+type NameChange struct {
+	OldName   string `json:"oldName"`
+	NewName   string `json:"newName"`
+	ChangedAt int64  `json:"changedAt"`
+}
+
+// renameIfChanged updates the name of a user or group and records the old
+// name in name_history. Empty names are ignored: Signal omits names from many
+// envelopes, which does not mean they were cleared. It reports whether an
+// existing name was replaced.
+func renameIfChanged(tx *sql.Tx, entityType string, id int64, name string, at int64) (bool, error) {
+	if name == "" {
+		return false, nil
+	}
+
+	table := "users"
+	if entityType == nameEntityGroup {
+		table = "groups"
+	}
+
+	var current sql.NullString
+	if err := tx.QueryRow("SELECT name FROM "+table+" WHERE id = ?", id).Scan(&current); err != nil {
+		return false, fmt.Errorf("failed to query %s name: %w", entityType, err)
+	}
+	if current.String == name {
+		return false, nil
+	}
+
+	if _, err := tx.Exec("UPDATE "+table+" SET name = ? WHERE id = ?", name, id); err != nil {
+		return false, fmt.Errorf("failed to rename %s: %w", entityType, err)
+	}
+	// A missing name is a first sighting rather than a rename
+	if current.String == "" {
+		return false, nil
+	}
+	if _, err := tx.Exec("INSERT INTO name_history (entity_type, entity_id, old_name, new_name, changed_at) VALUES (?, ?, ?, ?, ?)",
+		entityType, id, current.String, name, at); err != nil {
+		return false, fmt.Errorf("failed to record %s rename: %w", entityType, err)
+	}
+	slog.Info("Name changed", "type", entityType, "id", id, "from", current.String, "to", name)
+	return true, nil
+}
+
+// syncUserName refreshes the profile name of a known sender from any
+// envelope, including ones that are otherwise not stored (receipts, edits).
+func (db *DB) syncUserName(msg *signal.Envelope) error {
+	if msg.SourceUUID == "" || msg.SourceName == "" {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("Failed to rollback transaction", "error", err)
+		}
+	}()
+
+	var id int64
+	err = tx.QueryRow("SELECT id FROM users WHERE uuid = ?", msg.SourceUUID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query user: %w", err)
+	}
+
+	if _, err := renameIfChanged(tx, nameEntityUser, id, msg.SourceName, msg.Timestamp); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetGroupNameHistory returns the renames of a group, most recent first.
+func (db *DB) GetGroupNameHistory(groupID int64) ([]NameChange, error) {
+	var exists int
+	err := db.QueryRow("SELECT 1 FROM groups WHERE id = ?", groupID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group: %w", err)
+	}
+
+	rows, err := db.Query(`
+		SELECT COALESCE(old_name, ''), COALESCE(new_name, ''), changed_at
+		FROM name_history
+		WHERE entity_type = ? AND entity_id = ?
+		ORDER BY changed_at DESC, id DESC
+	`, nameEntityGroup, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query name history: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("Failed to close rows", "error", err, "context", "GetGroupNameHistory")
+		}
+	}()
+
+	history := []NameChange{}
+	for rows.Next() {
+		var c NameChange
+		if err := rows.Scan(&c.OldName, &c.NewName, &c.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan name change: %w", err)
+		}
+		history = append(history, c)
+	}
+	return history, rows.Err()
+}
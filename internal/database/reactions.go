@@ -0,0 +1,137 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MessageTypeEarlierMessage marks a message from before the summarized window
+// that is only included because it received reactions within it.
+const MessageTypeEarlierMessage = "earlier_message"
+
+// ReactionCount is how many members currently react to a message with an emoji.
+type ReactionCount struct {
+	Emoji string
+	Count int
+}
+
+// messageIdentity is how Signal addresses a message: author and sent timestamp.
+type messageIdentity struct {
+	authorUUID string
+	timestamp  int64
+}
+
+type reactionEvent struct {
+	reactor int64
+	emoji   string
+	target  messageIdentity
+	remove  bool
+	at      int64
+}
+
+// applyReactions resolves reactions to the messages they target and attaches
+// aggregated counts. A member has at most one reaction per message: a newer
+// reaction replaces the previous one and a removal cancels it. Targets outside
+// the window are loaded and returned separately, positioned at their first
+// reaction; reactions to unknown or deleted messages are dropped.
+func (db *DB) applyReactions(messages []MessageForSummary, byIdentity map[messageIdentity]int, reactions []reactionEvent, groupID int64) ([]MessageForSummary, error) {
+	type reactorKey struct {
+		reactor int64
+		target  messageIdentity
+	}
+
+	// Reactions arrive ordered by timestamp, so the last one per member wins
+	current := make(map[reactorKey]reactionEvent)
+	var order []reactorKey
+	for _, r := range reactions {
+		key := reactorKey{r.reactor, r.target}
+		if _, seen := current[key]; !seen {
+			order = append(order, key)
+		}
+		if r.remove {
+			current[key] = reactionEvent{}
+			continue
+		}
+		current[key] = r
+	}
+
+	counts := make(map[messageIdentity][]ReactionCount)
+	firstAt := make(map[messageIdentity]int64)
+	var targets []messageIdentity
+	for _, key := range order {
+		r := current[key]
+		if r.emoji == "" {
+			continue
+		}
+		list, seen := counts[r.target]
+		if !seen {
+			targets = append(targets, r.target)
+			firstAt[r.target] = r.at
+		}
+		found := false
+		for i := range list {
+			if list[i].Emoji == r.emoji {
+				list[i].Count++
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, ReactionCount{Emoji: r.emoji, Count: 1})
+		}
+		counts[r.target] = list
+	}
+
+	var earlier []MessageForSummary
+	for _, target := range targets {
+		list := counts[target]
+		// Most popular first; ties keep the order reactions were first seen
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Count > list[j].Count })
+
+		if i, ok := byIdentity[target]; ok {
+			messages[i].Reactions = list
+			continue
+		}
+
+		msg, err := db.findReactionTarget(groupID, target)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		msg.Timestamp = firstAt[target]
+		msg.Reactions = list
+		earlier = append(earlier, msg)
+	}
+
+	sort.SliceStable(earlier, func(i, j int) bool { return earlier[i].Timestamp < earlier[j].Timestamp })
+	return earlier, nil
+}
+
+// findReactionTarget loads a message that received reactions but was sent
+// before the summarized window.
+func (db *DB) findReactionTarget(groupID int64, target messageIdentity) (MessageForSummary, error) {
+	msg := MessageForSummary{GroupID: groupID, MessageType: MessageTypeEarlierMessage}
+	err := db.QueryRow(`
+		SELECT m.id, m.user_id, COALESCE(u.name, ''), COALESCE(m.message_text, '')
+		FROM messages m
+		JOIN users u ON m.user_id = u.id
+		WHERE m.group_id = ? AND u.uuid = ? AND m.timestamp = ?
+			AND COALESCE(m.is_deleted, FALSE) = FALSE
+			AND COALESCE(m.message_type, 'message') != 'reaction'
+			AND (m.expires_at IS NULL OR m.expires_at > ?)
+			AND `+excludedSenderFilter("m.group_id")+`
+		LIMIT 1
+	`, groupID, target.authorUUID, target.timestamp, time.Now().UnixMilli()).Scan(&msg.ID, &msg.UserID, &msg.UserName, &msg.Text)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return msg, err
+		}
+		return msg, fmt.Errorf("failed to load reaction target: %w", err)
+	}
+	return msg, nil
+}
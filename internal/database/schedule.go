@@ -0,0 +1,129 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"summarizarr/internal/schedule"
+)
+
+// summarizedUntil is the progress of the scheduler for the group g: the
+// recorded window end, or the latest summary of groups summarized before
+// progress was recorded.
+const summarizedUntil = "COALESCE(g.summarized_until, (SELECT MAX(s.end_timestamp) FROM summaries s WHERE s.group_id = g.id), 0)"
+
+// GroupSchedule is the summarization schedule of a group. Empty fields use
+// the global settings.
+type GroupSchedule struct {
+	GroupID         int64  `json:"groupId"`
+	Name            string `json:"name"`
+	Schedule        string `json:"schedule"`
+	TimeZone        string `json:"timezone"`
+	QuietHours      string `json:"quietHours"`
+	MinMessages     *int   `json:"minMessages"`
+	MinParticipants *int   `json:"minParticipants"`
+	MinChars        *int   `json:"minChars"`
+	// SummarizedUntil is the end of the last processed window in ms, 0 if
+	// the group was never summarized
+	SummarizedUntil int64 `json:"summarizedUntil"`
+	// QueuedUntil is the end of the last window queued for summarization
+	QueuedUntil int64 `json:"queuedUntil"`
+	// CarryFrom is the start of the windows that were rolled into the next
+	// one for too little activity, 0 if none
+	CarryFrom int64 `json:"carryFrom"`
+}
+
+// Config returns the group's own settings.
+func (s GroupSchedule) Config() schedule.Config {
+	return schedule.Config{
+		Spec:            s.Schedule,
+		TimeZone:        s.TimeZone,
+		QuietHours:      s.QuietHours,
+		MinMessages:     s.MinMessages,
+		MinParticipants: s.MinParticipants,
+		MinChars:        s.MinChars,
+	}
+}
+
+const groupScheduleColumns = "g.id, COALESCE(g.name, ''), COALESCE(g.summary_schedule, ''), COALESCE(g.summary_timezone, ''), " +
+	"COALESCE(g.summary_quiet_hours, ''), g.summary_min_messages, g.summary_min_participants, g.summary_min_chars, " + summarizedUntil +
+	", COALESCE((SELECT MAX(j.end_timestamp) FROM summary_jobs j WHERE j.group_id = g.id AND j.kind = 'scheduled'), 0)" +
+	", COALESCE(g.summary_carry_from, 0)"
+
+func scanGroupSchedule(row interface{ Scan(...any) error }) (GroupSchedule, error) {
+	var s GroupSchedule
+	var minMessages, minParticipants, minChars sql.NullInt64
+	err := row.Scan(&s.GroupID, &s.Name, &s.Schedule, &s.TimeZone, &s.QuietHours, &minMessages, &minParticipants, &minChars,
+		&s.SummarizedUntil, &s.QueuedUntil, &s.CarryFrom)
+	s.MinMessages, s.MinParticipants, s.MinChars = intOrNil(minMessages), intOrNil(minParticipants), intOrNil(minChars)
+	return s, err
+}
+
+func intOrNil(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	n := int(v.Int64)
+	return &n
+}
+
+// GetGroupSchedule returns the schedule of a group.
+func (db *DB) GetGroupSchedule(groupID int64) (GroupSchedule, error) {
+	s, err := scanGroupSchedule(db.QueryRow("SELECT "+groupScheduleColumns+" FROM groups g WHERE g.id = ?", groupID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return GroupSchedule{}, ErrGroupNotFound
+	}
+	if err != nil {
+		return GroupSchedule{}, fmt.Errorf("failed to query group schedule: %w", err)
+	}
+	return s, nil
+}
+
+// ListGroupSchedules returns the schedules of the groups that are
+// summarized.
+func (db *DB) ListGroupSchedules() ([]GroupSchedule, error) {
+	rows, err := db.Query(`
+		SELECT ` + groupScheduleColumns + ` FROM groups g
+		LEFT JOIN group_settings gs ON gs.group_id = g.id
+		WHERE COALESCE(gs.summarize, TRUE)
+		ORDER BY g.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group schedules: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("Failed to close rows", "error", err, "context", "ListGroupSchedules")
+		}
+	}()
+
+	schedules := []GroupSchedule{}
+	for rows.Next() {
+		s, err := scanGroupSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan group schedule: %w", err)
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// SetGroupSchedule overrides the schedule settings of a group. Empty values
+// go back to the global setting. Callers validate the settings.
+func (db *DB) SetGroupSchedule(groupID int64, config schedule.Config) error {
+	res, err := db.Exec(`
+		UPDATE groups SET summary_schedule = ?, summary_timezone = ?, summary_quiet_hours = ?,
+			summary_min_messages = ?, summary_min_participants = ?, summary_min_chars = ?
+		WHERE id = ?
+	`, nullIfEmpty(config.Spec), nullIfEmpty(config.TimeZone), nullIfEmpty(config.QuietHours),
+		config.MinMessages, config.MinParticipants, config.MinChars, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to update group schedule: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// GroupSettings controls what is stored and summarized for a group. Groups
+// without a group_settings row use the defaults: everything on, no exclusions.
+type GroupSettings struct {
+	Ingest    bool `json:"ingest"`
+	Summarize bool `json:"summarize"`
+	// ExcludedSenders are UUIDs or phone numbers whose messages are neither
+	// stored nor summarized
+	ExcludedSenders []string `json:"excludedSenders"`
+}
+
+// excludedSenderFilter is an SQL condition that drops rows from excluded
+// senders. It expects the sender in u (users) and the group in groupColumn.
+func excludedSenderFilter(groupColumn string) string {
+	return "NOT EXISTS (SELECT 1 FROM group_excluded_senders x WHERE x.group_id = " + groupColumn + " AND x.sender IN (u.uuid, u.number))"
+}
+
+// excludedQuoteAuthor is an SQL condition that holds when the message in m
+// quotes an excluded sender, whose quoted text must not be summarized either.
+func excludedQuoteAuthor(groupColumn string) string {
+	return "EXISTS (SELECT 1 FROM group_excluded_senders x LEFT JOIN users q ON q.uuid = m.quote_author_uuid" +
+		" WHERE x.group_id = " + groupColumn + " AND m.quote_author_uuid != '' AND x.sender IN (m.quote_author_uuid, q.number))"
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// groupFlags returns the ingest and summarize switches of a group.
+func groupFlags(q queryRower, groupID int64) (ingest, summarize bool, err error) {
+	err = q.QueryRow("SELECT ingest, summarize FROM group_settings WHERE group_id = ?", groupID).Scan(&ingest, &summarize)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, true, nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("failed to query group settings: %w", err)
+	}
+	return ingest, summarize, nil
+}
+
+// shouldIngest reports whether a message from the sender may be stored in
+// the group.
+func shouldIngest(tx *sql.Tx, groupID int64, senderUUID, senderNumber string) (bool, error) {
+	ingest, _, err := groupFlags(tx, groupID)
+	if err != nil || !ingest {
+		return false, err
+	}
+	var excluded int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM group_excluded_senders WHERE group_id = ? AND sender IN (?, ?)",
+		groupID, senderUUID, senderNumber).Scan(&excluded); err != nil {
+		return false, fmt.Errorf("failed to query excluded senders: %w", err)
+	}
+	return excluded == 0, nil
+}
+
+// GetGroupSettings returns the settings of a group.
+func (db *DB) GetGroupSettings(groupID int64) (GroupSettings, error) {
+	var exists int
+	err := db.QueryRow("SELECT 1 FROM groups WHERE id = ?", groupID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return GroupSettings{}, ErrGroupNotFound
+	}
+	if err != nil {
+		return GroupSettings{}, fmt.Errorf("failed to query group: %w", err)
+	}
+
+	settings := GroupSettings{ExcludedSenders: []string{}}
+	if settings.Ingest, settings.Summarize, err = groupFlags(db, groupID); err != nil {
+		return GroupSettings{}, err
+	}
+
+	rows, err := db.Query("SELECT sender FROM group_excluded_senders WHERE group_id = ? ORDER BY sender", groupID)
+	if err != nil {
+		return GroupSettings{}, fmt.Errorf("failed to query excluded senders: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Error("Failed to close rows", "error", err, "context", "GetGroupSettings")
+		}
+	}()
+	for rows.Next() {
+		var sender string
+		if err := rows.Scan(&sender); err != nil {
+			return GroupSettings{}, fmt.Errorf("failed to scan excluded sender: %w", err)
+		}
+		settings.ExcludedSenders = append(settings.ExcludedSenders, sender)
+	}
+	return settings, rows.Err()
+}
+
+// SetGroupSettings replaces the settings of a group.
+func (db *DB) SetGroupSettings(groupID int64, settings GroupSettings) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			slog.Error("Failed to rollback transaction", "error", err)
+		}
+	}()
+
+	var exists int
+	err = tx.QueryRow("SELECT 1 FROM groups WHERE id = ?", groupID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrGroupNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query group: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO group_settings (group_id, ingest, summarize) VALUES (?, ?, ?)
+		ON CONFLICT (group_id) DO UPDATE SET ingest = excluded.ingest, summarize = excluded.summarize
+	`, groupID, settings.Ingest, settings.Summarize); err != nil {
+		return fmt.Errorf("failed to save group settings: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM group_excluded_senders WHERE group_id = ?", groupID); err != nil {
+		return fmt.Errorf("failed to clear excluded senders: %w", err)
+	}
+	for _, sender := range settings.ExcludedSenders {
+		sender = strings.TrimSpace(sender)
+		if sender == "" {
+			continue
+		}
+		if _, err := tx.Exec("INSERT OR IGNORE INTO group_excluded_senders (group_id, sender) VALUES (?, ?)", groupID, sender); err != nil {
+			return fmt.Errorf("failed to save excluded sender: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
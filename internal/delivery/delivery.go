@@ -0,0 +1,129 @@
+// Package delivery posts generated summaries back into Signal.
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"summarizarr/internal/database"
+	"summarizarr/internal/signal"
+)
+
+// MaxMessageLength is the longest text sent as one Signal message. Longer
+// texts are sent by Signal clients as attachments, which many do not preview.
+const MaxMessageLength = 2000
+
+// DB is the interface for the database.
+type DB interface {
+	GetDeliveryTarget(groupID int64) (database.DeliveryTarget, error)
+	SetSummaryDeliveryStatus(summaryID int64, status, deliveryError string, deliveredAt int64) error
+}
+
+// Sender sends a text message from an account.
+type Sender interface {
+	Send(ctx context.Context, account string, recipients []string, message string) (int64, error)
+}
+
+// Deliverer posts summaries to the target configured per group.
+type Deliverer struct {
+	db             DB
+	sender         Sender
+	defaultAccount string
+	digestGroup    string
+}
+
+// New creates a Deliverer. defaultAccount sends for groups without a known
+// account; digestGroup is the Signal group ID used by the digest target.
+func New(db DB, sender Sender, defaultAccount, digestGroup string) *Deliverer {
+	return &Deliverer{
+		db:             db,
+		sender:         sender,
+		defaultAccount: defaultAccount,
+		digestGroup:    digestGroup,
+	}
+}
+
+// DeliverSummary posts a summary if its group opted in and records the
+// outcome on the summary. Groups without a delivery target are skipped.
+func (d *Deliverer) DeliverSummary(ctx context.Context, summaryID, groupID int64, summary string) error {
+	target, err := d.db.GetDeliveryTarget(groupID)
+	if err != nil {
+		return err
+	}
+	if target.Mode == "" {
+		return nil
+	}
+
+	account := target.Account
+	if account == "" {
+		account = d.defaultAccount
+	}
+
+	sendErr := d.send(ctx, target, account, summary)
+	if sendErr != nil {
+		if err := d.db.SetSummaryDeliveryStatus(summaryID, database.DeliveryStatusFailed, sendErr.Error(), 0); err != nil {
+			slog.Error("Failed to record summary delivery", "summary_id", summaryID, "error", err)
+		}
+		return fmt.Errorf("failed to deliver summary: %w", sendErr)
+	}
+
+	slog.Info("Delivered summary to Signal", "summary_id", summaryID, "group_id", groupID, "target", target.Mode)
+	return d.db.SetSummaryDeliveryStatus(summaryID, database.DeliveryStatusSent, "", time.Now().UnixMilli())
+}
+
+func (d *Deliverer) send(ctx context.Context, target database.DeliveryTarget, account, summary string) error {
+	if account == "" {
+		return errors.New("no Signal account to send from")
+	}
+
+	var recipient string
+	text := ToSignalStyles(summary)
+	switch target.Mode {
+	case database.DeliveryGroup:
+		recipient = conversationRecipient(target)
+	case database.DeliverySelf:
+		recipient = account
+	case database.DeliveryDigest:
+		if d.digestGroup == "" {
+			return errors.New("SUMMARY_DIGEST_GROUP is not configured")
+		}
+		recipient = signal.GroupRecipient(d.digestGroup)
+	default:
+		return fmt.Errorf("unknown delivery target: %s", target.Mode)
+	}
+	// Outside the summarized group, say which conversation the summary is about
+	if target.Mode != database.DeliveryGroup && target.GroupName != "" {
+		text = "**Summary of " + target.GroupName + "**\n\n" + text
+	}
+	return d.sendStyled(ctx, account, recipient, text)
+}
+
+// Reply converts markdown to Signal styles and posts it to a recipient,
+// split into several messages if needed.
+func (d *Deliverer) Reply(ctx context.Context, account, recipient, text string) error {
+	return d.sendStyled(ctx, account, recipient, ToSignalStyles(text))
+}
+
+func (d *Deliverer) sendStyled(ctx context.Context, account, recipient, text string) error {
+	for i, part := range Split(text, MaxMessageLength) {
+		if _, err := d.sender.Send(ctx, account, []string{recipient}, part); err != nil {
+			if i > 0 {
+				return fmt.Errorf("sent %d parts, then: %w", i, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// conversationRecipient addresses a stored conversation: a group, or the
+// contact of a direct conversation.
+func conversationRecipient(target database.DeliveryTarget) string {
+	if target.ConversationType == database.ConversationDirect {
+		return database.DirectConversationContact(target.SignalGroupID)
+	}
+	return signal.GroupRecipient(target.SignalGroupID)
+}
@@ -0,0 +1,134 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"summarizarr/internal/database"
+)
+
+func TestToSignalStyles(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		expected string
+	}{
+		{"heading", "## Key **Topics**", "**Key Topics**"},
+		{"bullets", "* first\n- second\n  + nested", "• first\n• second\n  • nested"},
+		{"bold and italic", "__Decided:__ meet _Friday_", "**Decided:** meet *Friday*"},
+		{"snake case is not italic", "see config_file_name", "see config_file_name"},
+		{"strikethrough", "~~cancelled~~", "~cancelled~"},
+		{"link", "[docs](https://example.com)", "docs (https://example.com)"},
+		{"rule and fence", "a\n---\n```\ncode_here\n```", "a\ncode_here"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToSignalStyles(tt.markdown); got != tt.expected {
+				t.Errorf("ToSignalStyles(%q) = %q, expected %q", tt.markdown, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	text := strings.Repeat("a", 30) + "\n\n" + strings.Repeat("b", 30) + " " + strings.Repeat("c", 10)
+	parts := Split(text, 40)
+	expected := []string{strings.Repeat("a", 30), strings.Repeat("b", 30), strings.Repeat("c", 10)}
+	if strings.Join(parts, "|") != strings.Join(expected, "|") {
+		t.Errorf("Unexpected parts: %q", parts)
+	}
+
+	// No boundary at all falls back to a hard cut
+	if parts := Split(strings.Repeat("x", 25), 10); len(parts) != 3 || parts[2] != "xxxxx" {
+		t.Errorf("Unexpected hard split: %q", parts)
+	}
+	if parts := Split("   ", 10); len(parts) != 0 {
+		t.Errorf("Expected no parts for blank text, got %q", parts)
+	}
+}
+
+type fakeDB struct {
+	target database.DeliveryTarget
+	status string
+	errMsg string
+}
+
+func (f *fakeDB) GetDeliveryTarget(groupID int64) (database.DeliveryTarget, error) {
+	return f.target, nil
+}
+
+func (f *fakeDB) SetSummaryDeliveryStatus(summaryID int64, status, deliveryError string, deliveredAt int64) error {
+	f.status = status
+	f.errMsg = deliveryError
+	return nil
+}
+
+type sentMessage struct {
+	account   string
+	recipient string
+	text      string
+}
+
+type fakeSender struct {
+	sent []sentMessage
+	err  error
+}
+
+func (f *fakeSender) Send(ctx context.Context, account string, recipients []string, message string) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.sent = append(f.sent, sentMessage{account, recipients[0], message})
+	return 1, nil
+}
+
+func TestDeliverSummary(t *testing.T) {
+	t.Run("opted out", func(t *testing.T) {
+		db := &fakeDB{target: database.DeliveryTarget{SignalGroupID: "group-1"}}
+		sender := &fakeSender{}
+		if err := New(db, sender, "+1", "").DeliverSummary(context.Background(), 1, 1, "text"); err != nil {
+			t.Fatalf("DeliverSummary failed: %v", err)
+		}
+		if len(sender.sent) != 0 || db.status != "" {
+			t.Errorf("Expected nothing to be sent, got %+v", sender.sent)
+		}
+	})
+
+	t.Run("same group from its account", func(t *testing.T) {
+		db := &fakeDB{target: database.DeliveryTarget{Mode: database.DeliveryGroup, SignalGroupID: "group-1", ConversationType: database.ConversationGroup, Account: "+2"}}
+		sender := &fakeSender{}
+		if err := New(db, sender, "+1", "").DeliverSummary(context.Background(), 1, 1, "# Summary"); err != nil {
+			t.Fatalf("DeliverSummary failed: %v", err)
+		}
+		if len(sender.sent) != 1 || sender.sent[0] != (sentMessage{"+2", "group.Z3JvdXAtMQ==", "**Summary**"}) {
+			t.Errorf("Unexpected messages: %+v", sender.sent)
+		}
+		if db.status != database.DeliveryStatusSent {
+			t.Errorf("Expected status sent, got %q", db.status)
+		}
+	})
+
+	t.Run("digest names the group", func(t *testing.T) {
+		db := &fakeDB{target: database.DeliveryTarget{Mode: database.DeliveryDigest, GroupName: "Book Club"}}
+		sender := &fakeSender{}
+		if err := New(db, sender, "+1", "digest-1").DeliverSummary(context.Background(), 1, 1, "text"); err != nil {
+			t.Fatalf("DeliverSummary failed: %v", err)
+		}
+		if len(sender.sent) != 1 || sender.sent[0].text != "**Summary of Book Club**\n\ntext" {
+			t.Errorf("Unexpected messages: %+v", sender.sent)
+		}
+	})
+
+	t.Run("failure is recorded", func(t *testing.T) {
+		db := &fakeDB{target: database.DeliveryTarget{Mode: database.DeliverySelf}}
+		sender := &fakeSender{err: errors.New("account not registered")}
+		if err := New(db, sender, "+1", "").DeliverSummary(context.Background(), 1, 1, "text"); err == nil {
+			t.Fatal("Expected an error")
+		}
+		if db.status != database.DeliveryStatusFailed || db.errMsg != "account not registered" {
+			t.Errorf("Expected failure to be recorded, got %q %q", db.status, db.errMsg)
+		}
+	})
+}
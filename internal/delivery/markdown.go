@@ -0,0 +1,96 @@
+package delivery
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	headingPattern    = regexp.MustCompile(`^#{1,6}\s+(.*?)\s*#*$`)
+	bulletPattern     = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+	rulePattern       = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	linkPattern       = regexp.MustCompile(`\[([^\]]+)\]\((\S+?)\)`)
+	underscoreBold    = regexp.MustCompile(`__(\S(?:.*?\S)?)__`)
+	underscoreItalic  = regexp.MustCompile(`(^|[^\w_])_(\S(?:[^_]*?\S)?)_($|[^\w_])`)
+	strikePattern     = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	boldMarkerPattern = regexp.MustCompile(`\*\*`)
+)
+
+// ToSignalStyles converts the markdown that LLMs produce into the syntax of
+// signal-cli-rest-api's styled text mode: **bold**, *italic*, ~strikethrough~
+// and `monospace`. Markdown without a Signal equivalent (headings, bullets,
+// links, rules, code fences) is rewritten as plain text.
+func ToSignalStyles(markdown string) string {
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	out := make([]string, 0, len(lines))
+	inCode := false
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			out = append(out, line)
+			continue
+		}
+
+		if rulePattern.MatchString(line) {
+			continue
+		}
+		if m := headingPattern.FindStringSubmatch(line); m != nil {
+			// Headings become bold lines; nested bold would end the span early
+			if title := boldMarkerPattern.ReplaceAllString(m[1], ""); title != "" {
+				line = "**" + title + "**"
+			} else {
+				line = ""
+			}
+		} else if m := bulletPattern.FindStringSubmatch(line); m != nil {
+			// A leading "* " would otherwise start an italic span
+			line = m[1] + "• " + line[len(m[0]):]
+		}
+
+		line = linkPattern.ReplaceAllStringFunc(line, func(s string) string {
+			m := linkPattern.FindStringSubmatch(s)
+			if m[1] == m[2] {
+				return m[2]
+			}
+			return m[1] + " (" + m[2] + ")"
+		})
+		line = underscoreBold.ReplaceAllString(line, "**$1**")
+		line = underscoreItalic.ReplaceAllString(line, "$1*$2*$3")
+		line = strikePattern.ReplaceAllString(line, "~$1~")
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// Split breaks text into parts of at most limit characters, preferring
+// paragraph, then line, then word boundaries so styles rarely span two parts.
+func Split(text string, limit int) []string {
+	var parts []string
+	for {
+		text = strings.TrimSpace(text)
+		runes := []rune(text)
+		if len(runes) <= limit {
+			if text != "" {
+				parts = append(parts, text)
+			}
+			return parts
+		}
+
+		window := string(runes[:limit])
+		cut := -1
+		for _, sep := range []string{"\n\n", "\n", " "} {
+			// Cuts in the first half of the window would leave tiny parts
+			if i := strings.LastIndex(window, sep); i > len(window)/2 {
+				cut = i
+				break
+			}
+		}
+		if cut < 0 {
+			cut = len(window)
+		}
+		parts = append(parts, strings.TrimSpace(text[:cut]))
+		text = text[cut:]
+	}
+}
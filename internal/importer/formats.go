@@ -0,0 +1,397 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"summarizarr/internal/signal"
+)
+
+// Supported export formats.
+const (
+	FormatAuto      = "auto"
+	FormatSignalCLI = "signal-cli"
+	FormatDesktop   = "desktop"
+	FormatText      = "text"
+)
+
+// TranscriptPrefix namespaces the synthetic sender IDs of plain text
+// transcripts, which only carry display names.
+const TranscriptPrefix = "transcript:"
+
+// ParseOptions describes an export file.
+type ParseOptions struct {
+	Format string
+	// Account is the Signal number the history belongs to. Desktop exports
+	// need it to attribute outgoing messages.
+	Account string
+	// GroupID and GroupName name the conversation of a text transcript
+	GroupID   string
+	GroupName string
+	// Location is the time zone of transcript timestamps, UTC if nil
+	Location *time.Location
+}
+
+// Parse turns an export into envelopes as signal-cli would have delivered
+// them, so they can be stored by database.SaveMessage.
+func Parse(data []byte, opts ParseOptions) ([]*signal.Envelope, error) {
+	format := opts.Format
+	if format == "" || format == FormatAuto {
+		format = detectFormat(data)
+	}
+	switch format {
+	case FormatSignalCLI:
+		return parseSignalCLI(data, opts.Account)
+	case FormatDesktop:
+		return parseDesktop(data, opts.Account)
+	case FormatText:
+		return parseTranscript(data, opts)
+	default:
+		return nil, fmt.Errorf("unknown import format: %s", format)
+	}
+}
+
+// ValidFormat reports whether format can be passed to Parse.
+func ValidFormat(format string) bool {
+	switch format {
+	case "", FormatAuto, FormatSignalCLI, FormatDesktop, FormatText:
+		return true
+	}
+	return false
+}
+
+func detectFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	isJSON := bytes.HasPrefix(trimmed, []byte("{"))
+	if rest, ok := bytes.CutPrefix(trimmed, []byte("[")); ok {
+		// Transcripts may also start with a bracket: "[2024-03-01 14:05] ..."
+		rest = bytes.TrimSpace(rest)
+		isJSON = bytes.HasPrefix(rest, []byte("{")) || bytes.HasPrefix(rest, []byte("]"))
+	}
+	if !isJSON {
+		return FormatText
+	}
+	if bytes.Contains(trimmed, []byte(`"conversationId"`)) || bytes.Contains(trimmed, []byte(`"conversations"`)) {
+		return FormatDesktop
+	}
+	return FormatSignalCLI
+}
+
+// parseSignalCLI reads the output of "signal-cli receive --output=json": one
+// {"envelope": ...} object per line, or a JSON array of them.
+func parseSignalCLI(data []byte, account string) ([]*signal.Envelope, error) {
+	var wrappers []signal.EnvelopeWrapper
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &wrappers); err != nil {
+			return nil, fmt.Errorf("failed to parse signal-cli export: %w", err)
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		for {
+			var wrapper signal.EnvelopeWrapper
+			err := decoder.Decode(&wrapper)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse signal-cli export: %w", err)
+			}
+			wrappers = append(wrappers, wrapper)
+		}
+	}
+
+	envelopes := make([]*signal.Envelope, 0, len(wrappers))
+	for _, wrapper := range wrappers {
+		if wrapper.Envelope == nil {
+			continue
+		}
+		wrapper.Envelope.Account = wrapper.Account
+		if wrapper.Envelope.Account == "" {
+			wrapper.Envelope.Account = account
+		}
+		envelopes = append(envelopes, wrapper.Envelope)
+	}
+	return envelopes, nil
+}
+
+// desktopExport is the conversations and messages of a Signal Desktop
+// database, as written by Desktop export tools.
+type desktopExport struct {
+	Conversations []desktopConversation `json:"conversations"`
+	Messages      []desktopMessage      `json:"messages"`
+}
+
+type desktopConversation struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	GroupID     string `json:"groupId"`
+	Name        string `json:"name"`
+	ProfileName string `json:"profileName"`
+	E164        string `json:"e164"`
+	ServiceID   string `json:"serviceId"`
+	UUID        string `json:"uuid"`
+}
+
+func (c desktopConversation) serviceID() string {
+	if c.ServiceID != "" {
+		return c.ServiceID
+	}
+	return c.UUID
+}
+
+func (c desktopConversation) displayName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.ProfileName
+}
+
+type desktopMessage struct {
+	ConversationID  string `json:"conversationId"`
+	Type            string `json:"type"`
+	Body            string `json:"body"`
+	SentAt          int64  `json:"sent_at"`
+	Timestamp       int64  `json:"timestamp"`
+	ReceivedAt      int64  `json:"received_at"`
+	Source          string `json:"source"`
+	SourceServiceID string `json:"sourceServiceId"`
+	SourceUUID      string `json:"sourceUuid"`
+	Quote           *struct {
+		ID         int64  `json:"id"`
+		AuthorACI  string `json:"authorAci"`
+		AuthorUUID string `json:"authorUuid"`
+		Text       string `json:"text"`
+	} `json:"quote"`
+	Attachments []struct {
+		ContentType string `json:"contentType"`
+		FileName    string `json:"fileName"`
+		Size        int64  `json:"size"`
+		Caption     string `json:"caption"`
+	} `json:"attachments"`
+	BodyRanges []struct {
+		Start      int    `json:"start"`
+		Length     int    `json:"length"`
+		MentionACI string `json:"mentionAci"`
+		MentionID  string `json:"mentionUuid"`
+	} `json:"bodyRanges"`
+	Reactions []struct {
+		Emoji     string `json:"emoji"`
+		FromID    string `json:"fromId"`
+		Timestamp int64  `json:"timestamp"`
+	} `json:"reactions"`
+}
+
+// parseDesktop converts a Signal Desktop export. Group conversations keep
+// their group ID, so imported history joins the live group. Messages are
+// either an object with conversations and messages, or a bare message array.
+func parseDesktop(data []byte, account string) ([]*signal.Envelope, error) {
+	var export desktopExport
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &export.Messages); err != nil {
+			return nil, fmt.Errorf("failed to parse Signal Desktop export: %w", err)
+		}
+	} else if err := json.Unmarshal(trimmed, &export); err != nil {
+		return nil, fmt.Errorf("failed to parse Signal Desktop export: %w", err)
+	}
+
+	conversations := make(map[string]desktopConversation, len(export.Conversations))
+	names := make(map[string]string)
+	self := ""
+	for _, c := range export.Conversations {
+		conversations[c.ID] = c
+		if c.Type == "private" && c.serviceID() != "" {
+			names[c.serviceID()] = c.displayName()
+		}
+		if account != "" && c.E164 == account {
+			self = c.serviceID()
+		}
+	}
+
+	var envelopes []*signal.Envelope
+	for _, m := range export.Messages {
+		if m.Type != "incoming" && m.Type != "outgoing" {
+			// Group changes, calls, safety number changes, ...
+			continue
+		}
+		conversation := conversations[m.ConversationID]
+		sentAt := m.SentAt
+		if sentAt == 0 {
+			sentAt = m.Timestamp
+		}
+
+		sourceUUID := m.SourceServiceID
+		if sourceUUID == "" {
+			sourceUUID = m.SourceUUID
+		}
+		sourceNumber := m.Source
+		if m.Type == "outgoing" {
+			if sourceUUID == "" {
+				sourceUUID = self
+			}
+			sourceNumber = account
+		}
+		if sourceUUID == "" {
+			// Without a sender ID the message cannot be deduplicated
+			continue
+		}
+
+		env := &signal.Envelope{
+			SourceUUID:              sourceUUID,
+			SourceNumber:            sourceNumber,
+			SourceName:              names[sourceUUID],
+			Timestamp:               sentAt,
+			ServerReceivedTimestamp: m.ReceivedAt,
+			Account:                 account,
+		}
+
+		data := &signal.DataMessage{Timestamp: sentAt, Message: m.Body}
+		if conversation.Type == "group" && conversation.GroupID != "" {
+			data.GroupInfo = &signal.GroupInfo{GroupID: conversation.GroupID, GroupName: conversation.Name, Type: "DELIVER"}
+		}
+		if q := m.Quote; q != nil {
+			author := q.AuthorACI
+			if author == "" {
+				author = q.AuthorUUID
+			}
+			data.Quote = &signal.Quote{ID: q.ID, AuthorUUID: author, Text: q.Text}
+		}
+		for _, a := range m.Attachments {
+			data.Attachments = append(data.Attachments, signal.Attachment{
+				ContentType: a.ContentType, Filename: a.FileName, Size: a.Size, Caption: a.Caption,
+			})
+		}
+		for _, r := range m.BodyRanges {
+			mentioned := r.MentionACI
+			if mentioned == "" {
+				mentioned = r.MentionID
+			}
+			if mentioned != "" {
+				data.Mentions = append(data.Mentions, signal.Mention{UUID: mentioned, Start: r.Start, Length: r.Length})
+			}
+		}
+
+		if m.Type == "outgoing" {
+			sent := &signal.SentMessage{
+				Timestamp: sentAt, Message: data.Message, GroupInfo: data.GroupInfo,
+				Quote: data.Quote, Attachments: data.Attachments, Mentions: data.Mentions,
+			}
+			if data.GroupInfo == nil {
+				sent.DestinationUUID = conversation.serviceID()
+				sent.DestinationNumber = conversation.E164
+			}
+			env.SyncMessage = &signal.SyncMessage{SentMessage: sent}
+		} else {
+			env.DataMessage = data
+		}
+		envelopes = append(envelopes, env)
+
+		// Reactions are stored on the message; replay them as reaction messages
+		for _, r := range m.Reactions {
+			from := conversations[r.FromID]
+			reactor := from.serviceID()
+			if reactor == "" || r.Timestamp == 0 {
+				continue
+			}
+			reaction := &signal.DataMessage{
+				Timestamp: r.Timestamp,
+				GroupInfo: data.GroupInfo,
+				Reaction:  &signal.Reaction{Emoji: r.Emoji, TargetAuthorUUID: sourceUUID, TargetSentTimestamp: sentAt},
+			}
+			if reaction.GroupInfo == nil && reactor == self {
+				// Our own reaction in a direct conversation
+				continue
+			}
+			envelopes = append(envelopes, &signal.Envelope{
+				SourceUUID:   reactor,
+				SourceNumber: from.E164,
+				SourceName:   from.displayName(),
+				Timestamp:    r.Timestamp,
+				DataMessage:  reaction,
+				Account:      account,
+			})
+		}
+	}
+
+	sort.SliceStable(envelopes, func(i, j int) bool { return envelopes[i].Timestamp < envelopes[j].Timestamp })
+	return envelopes, nil
+}
+
+// transcriptLine matches "[2024-03-01 14:05] Alice: text" and
+// "2024-03-01 14:05:09 - Alice: text".
+var transcriptLine = regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}(?::\d{2})?)\]?(?:\s+-)?\s+([^:]+?):\s?(.*)$`)
+
+// parseTranscript reads a plain text transcript with one message per line.
+// Lines without a timestamp continue the previous message. Senders are only
+// known by name, so they get a synthetic ID derived from it.
+func parseTranscript(data []byte, opts ParseOptions) ([]*signal.Envelope, error) {
+	if opts.GroupID == "" {
+		return nil, errors.New("text transcripts need a group ID")
+	}
+	location := opts.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	var envelopes []*signal.Envelope
+	// Transcripts have minute precision; messages sent by the same member in
+	// the same minute are spread over milliseconds to keep them apart
+	seen := make(map[string]int)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		m := transcriptLine.FindStringSubmatch(line)
+		if m == nil {
+			if len(envelopes) > 0 && strings.TrimSpace(line) != "" {
+				last := envelopes[len(envelopes)-1].DataMessage
+				last.Message += "\n" + line
+				continue
+			}
+			if strings.TrimSpace(line) != "" {
+				return nil, fmt.Errorf("line %d: expected a timestamp and sender", lineNumber)
+			}
+			continue
+		}
+
+		layout := "2006-01-02 15:04"
+		if len(m[1]) > len(layout) {
+			layout += ":05"
+		}
+		sentAt, err := time.ParseInLocation(layout, strings.Replace(m[1], "T", " ", 1), location)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		name := strings.TrimSpace(m[2])
+		sender := TranscriptPrefix + strings.ToLower(name)
+		timestamp := sentAt.UnixMilli()
+		key := fmt.Sprintf("%s/%d", sender, timestamp)
+		offset := seen[key]
+		seen[key]++
+		timestamp += int64(offset)
+
+		envelopes = append(envelopes, &signal.Envelope{
+			SourceUUID: sender,
+			SourceName: name,
+			Timestamp:  timestamp,
+			Account:    opts.Account,
+			DataMessage: &signal.DataMessage{
+				Timestamp: timestamp,
+				Message:   m[3],
+				GroupInfo: &signal.GroupInfo{GroupID: opts.GroupID, GroupName: opts.GroupName, Type: "DELIVER"},
+			},
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+	return envelopes, nil
+}
@@ -0,0 +1,234 @@
+// Package importer loads chat history from Signal exports, so a fresh
+// install has something to summarize.
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"summarizarr/internal/database"
+	"summarizarr/internal/schedule"
+	"summarizarr/internal/signal"
+)
+
+// DB is the interface for the database.
+type DB interface {
+	LookupMessage(msg *signal.Envelope) (database.MessageLookup, bool, error)
+	ImportMessage(msg *signal.Envelope) error
+	FindGroupID(signalGroupID string) (int64, error)
+	GetGroupSchedule(groupID int64) (database.GroupSchedule, error)
+	GetMessagesForSummarization(groupID int64, start, end int64) ([]database.MessageForSummary, error)
+	HasSummaryOverlapping(groupID int64, start, end int64) (bool, error)
+	EnqueueSummaryRequest(req database.SummaryRequest) (int64, error)
+}
+
+// Report describes the outcome of an import. In a dry run, it describes what
+// the import would do.
+type Report struct {
+	DryRun    bool `json:"dryRun"`
+	Envelopes int  `json:"envelopes"`
+	// Imported counts new messages. Messages of groups that do not ingest, or
+	// of excluded senders, are counted but not stored.
+	Imported   int `json:"imported"`
+	Duplicates int `json:"duplicates"`
+	// Updates counts edits and deletions applied to stored messages
+	Updates int `json:"updates"`
+	// Skipped counts receipts and messages outside a stored conversation
+	Skipped int           `json:"skipped"`
+	Groups  []GroupReport `json:"groups"`
+	// BackfillJobs are the summary jobs queued by Backfill
+	BackfillJobs []int64 `json:"backfillJobs,omitempty"`
+}
+
+// GroupReport describes the messages imported into one conversation.
+type GroupReport struct {
+	GroupID    string `json:"groupId"`
+	Name       string `json:"name"`
+	Imported   int    `json:"imported"`
+	Duplicates int    `json:"duplicates"`
+	// First and Last are the timestamps of the oldest and newest new message
+	First int64 `json:"first"`
+	Last  int64 `json:"last"`
+}
+
+// Importer stores parsed exports and backfills their summaries.
+type Importer struct {
+	db       DB
+	schedule schedule.Config
+	now      func() time.Time
+}
+
+// New creates an Importer. Backfilled summaries cover the windows the
+// scheduler would summarize: those of the group's own schedule, or of the
+// given default.
+func New(db DB, defaults schedule.Config) *Importer {
+	return &Importer{db: db, schedule: defaults, now: time.Now}
+}
+
+// messageKey identifies a message the way the messages table does.
+type messageKey struct {
+	groupID   string
+	sender    string
+	timestamp int64
+}
+
+// Import stores envelopes through the same path as live messages. Messages
+// that are already stored, or appear twice in the export, are skipped.
+func (i *Importer) Import(ctx context.Context, envelopes []*signal.Envelope, dryRun bool) (*Report, error) {
+	report := &Report{DryRun: dryRun, Envelopes: len(envelopes), Groups: []GroupReport{}}
+	groups := make(map[string]int)
+	seen := make(map[messageKey]bool)
+
+	for n, env := range envelopes {
+		if n%500 == 0 && ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+
+		lookup, ok, err := i.db.LookupMessage(env)
+		if err != nil {
+			return report, err
+		}
+		if !ok {
+			del, _ := env.Deletion()
+			if env.Edit() == nil && del == nil {
+				report.Skipped++
+				continue
+			}
+			report.Updates++
+			if !dryRun {
+				if err := i.db.ImportMessage(env); err != nil {
+					return report, fmt.Errorf("failed to import message: %w", err)
+				}
+			}
+			continue
+		}
+
+		index, found := groups[lookup.GroupID]
+		if !found {
+			index = len(report.Groups)
+			groups[lookup.GroupID] = index
+			report.Groups = append(report.Groups, GroupReport{GroupID: lookup.GroupID, Name: lookup.GroupName})
+		}
+		group := &report.Groups[index]
+		if group.Name == "" {
+			group.Name = lookup.GroupName
+		}
+
+		key := messageKey{lookup.GroupID, env.SourceUUID, lookup.Timestamp}
+		if lookup.Exists || seen[key] {
+			report.Duplicates++
+			group.Duplicates++
+			continue
+		}
+		seen[key] = true
+
+		if !dryRun {
+			if err := i.db.ImportMessage(env); err != nil {
+				return report, fmt.Errorf("failed to import message: %w", err)
+			}
+		}
+		report.Imported++
+		group.Imported++
+		if group.First == 0 || lookup.Timestamp < group.First {
+			group.First = lookup.Timestamp
+		}
+		if lookup.Timestamp > group.Last {
+			group.Last = lookup.Timestamp
+		}
+	}
+
+	slog.Info("Imported messages", "dry_run", dryRun, "imported", report.Imported,
+		"duplicates", report.Duplicates, "updates", report.Updates, "skipped", report.Skipped, "groups", len(report.Groups))
+	return report, nil
+}
+
+// Backfill queues summary jobs for the past windows that received new
+// messages, which the scheduler's workers then summarize. Windows follow the
+// group's schedule and end where the scheduler's own windows start. Windows
+// that already have a summary or a queued job are left alone. Backfilled
+// summaries are not posted to Signal.
+func (i *Importer) Backfill(report *Report) error {
+	if _, err := i.schedule.Parse(); err != nil {
+		return fmt.Errorf("invalid backfill schedule: %w", err)
+	}
+	if report.DryRun {
+		return errors.New("cannot backfill a dry run")
+	}
+
+	now := i.now()
+	for _, group := range report.Groups {
+		if group.Imported == 0 {
+			continue
+		}
+		groupID, err := i.db.FindGroupID(group.GroupID)
+		if errors.Is(err, database.ErrGroupNotFound) {
+			// Nothing was stored, e.g. because the group does not ingest
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		own, err := i.db.GetGroupSchedule(groupID)
+		if err != nil {
+			return err
+		}
+		sched, err := i.schedule.Override(own.Config()).Parse()
+		if err != nil {
+			return fmt.Errorf("invalid schedule of group %d: %w", groupID, err)
+		}
+
+		limit := schedulerStart(sched, own, now)
+		start := schedule.Prev(sched, time.UnixMilli(group.First))
+		if start.IsZero() {
+			slog.Warn("No schedule window before the imported messages", "group_id", groupID, "schedule", sched)
+			continue
+		}
+		for end := sched.Next(start); !end.IsZero() && !end.After(limit) && start.UnixMilli() <= group.Last; start, end = end, sched.Next(end) {
+			jobID, err := i.backfillWindow(groupID, start.UnixMilli(), end.UnixMilli())
+			if err != nil {
+				return err
+			}
+			if jobID != 0 {
+				report.BackfillJobs = append(report.BackfillJobs, jobID)
+			}
+		}
+	}
+
+	slog.Info("Queued backfilled summaries", "jobs", len(report.BackfillJobs))
+	return nil
+}
+
+// schedulerStart returns where the windows of the scheduler start, which
+// covers the group from there on: the windows rolled into its next summary,
+// or the end of the windows it processed or queued. Groups it never ran for
+// start with the last window that ended.
+func schedulerStart(sched schedule.Schedule, group database.GroupSchedule, now time.Time) time.Time {
+	if group.CarryFrom > 0 {
+		return time.UnixMilli(group.CarryFrom)
+	}
+	if until := max(group.SummarizedUntil, group.QueuedUntil); until > 0 {
+		return time.UnixMilli(until)
+	}
+	return schedule.Prev(sched, schedule.Prev(sched, now).Add(-time.Millisecond))
+}
+
+// backfillWindow queues the summary of a window and returns the job ID, or 0
+// if the window has no messages or is already covered.
+func (i *Importer) backfillWindow(groupID, start, end int64) (int64, error) {
+	covered, err := i.db.HasSummaryOverlapping(groupID, start, end)
+	if err != nil || covered {
+		return 0, err
+	}
+	// Windows are half-open; the message query includes both bounds
+	messages, err := i.db.GetMessagesForSummarization(groupID, start, end-1)
+	if err != nil || len(messages) == 0 {
+		return 0, err
+	}
+
+	slog.Info("Queueing backfilled summary", "group_id", groupID, "start_ms", start, "end_ms", end, "message_count", len(messages))
+	return i.db.EnqueueSummaryRequest(database.SummaryRequest{GroupID: groupID, Start: start, End: end})
+}
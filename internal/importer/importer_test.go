@@ -0,0 +1,297 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"summarizarr/internal/database"
+	"summarizarr/internal/schedule"
+	"summarizarr/internal/signal"
+)
+
+func TestParse_SignalCLI(t *testing.T) {
+	lines := `{"envelope":{"sourceUuid":"uuid-1","sourceName":"Alice","timestamp":1000,"dataMessage":{"timestamp":1000,"message":"hi","groupInfo":{"groupId":"g1"}}},"account":"+1"}
+{"envelope":{"sourceUuid":"uuid-2","timestamp":2000,"receiptMessage":{"isRead":true}}}`
+
+	envelopes, err := Parse([]byte(lines), ParseOptions{Account: "+9"})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(envelopes) != 2 {
+		t.Fatalf("Expected 2 envelopes, got %d", len(envelopes))
+	}
+	if envelopes[0].Account != "+1" || envelopes[1].Account != "+9" {
+		t.Errorf("Expected the wrapper account, then the default, got %q and %q", envelopes[0].Account, envelopes[1].Account)
+	}
+
+	array := "[" + `{"envelope":{"sourceUuid":"uuid-1","timestamp":1000}}` + "]"
+	if envelopes, err := Parse([]byte(array), ParseOptions{Format: FormatSignalCLI}); err != nil || len(envelopes) != 1 {
+		t.Errorf("Expected the array form to parse, got %d envelopes, %v", len(envelopes), err)
+	}
+}
+
+func TestParse_Desktop(t *testing.T) {
+	export := `{
+		"conversations": [
+			{"id": "c-group", "type": "group", "groupId": "g1", "name": "Book Club"},
+			{"id": "c-alice", "type": "private", "serviceId": "uuid-alice", "e164": "+2", "profileName": "Alice"},
+			{"id": "c-me", "type": "private", "serviceId": "uuid-me", "e164": "+1"}
+		],
+		"messages": [
+			{"conversationId": "c-group", "type": "outgoing", "body": "chapter 3?", "sent_at": 2000},
+			{"conversationId": "c-group", "type": "incoming", "body": "yes", "sent_at": 1000, "sourceServiceId": "uuid-alice",
+			 "reactions": [{"emoji": "👍", "fromId": "c-me", "timestamp": 3000}]},
+			{"conversationId": "c-group", "type": "group-v2-change", "sent_at": 500}
+		]
+	}`
+
+	envelopes, err := Parse([]byte(export), ParseOptions{Account: "+1"})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(envelopes) != 3 {
+		t.Fatalf("Expected 3 envelopes, got %d", len(envelopes))
+	}
+
+	incoming := envelopes[0]
+	if incoming.SourceUUID != "uuid-alice" || incoming.SourceName != "Alice" || incoming.DataMessage.GroupInfo.GroupID != "g1" {
+		t.Errorf("Unexpected incoming envelope: %+v", incoming)
+	}
+	outgoing := envelopes[1]
+	if outgoing.SourceUUID != "uuid-me" || outgoing.SyncMessage == nil || outgoing.SyncMessage.SentMessage.Message != "chapter 3?" {
+		t.Errorf("Expected our message as a sync message, got %+v", outgoing)
+	}
+	reaction := envelopes[2].DataMessage.Reaction
+	if reaction == nil || reaction.TargetAuthorUUID != "uuid-alice" || reaction.TargetSentTimestamp != 1000 {
+		t.Errorf("Unexpected reaction: %+v", reaction)
+	}
+}
+
+func TestParse_Transcript(t *testing.T) {
+	transcript := "[2024-03-01 14:05] Alice: see you\nat six\n2024-03-01 14:05:00 - Alice: bring snacks\n\n[2024-03-01 14:07] Bob: ok\n"
+
+	envelopes, err := Parse([]byte(transcript), ParseOptions{GroupID: "g1", GroupName: "Friends"})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(envelopes) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(envelopes))
+	}
+	want := time.Date(2024, 3, 1, 14, 5, 0, 0, time.UTC).UnixMilli()
+	if envelopes[0].Timestamp != want || envelopes[0].DataMessage.Message != "see you\nat six" {
+		t.Errorf("Unexpected first message: %d %q", envelopes[0].Timestamp, envelopes[0].DataMessage.Message)
+	}
+	if envelopes[1].Timestamp != want+1 {
+		t.Errorf("Expected a second message in the same minute to be kept apart, got %d", envelopes[1].Timestamp)
+	}
+	if envelopes[2].SourceUUID != TranscriptPrefix+"bob" || envelopes[2].SourceName != "Bob" {
+		t.Errorf("Unexpected sender: %q %q", envelopes[2].SourceUUID, envelopes[2].SourceName)
+	}
+
+	if _, err := Parse([]byte(transcript), ParseOptions{Format: FormatText}); err == nil {
+		t.Error("Expected an error without a group ID")
+	}
+	if _, err := Parse([]byte("no timestamp here"), ParseOptions{GroupID: "g1"}); err == nil {
+		t.Error("Expected an error for a line without a timestamp")
+	}
+}
+
+type fakeDB struct {
+	stored   map[int64]bool
+	imported []*signal.Envelope
+	covered  map[int64]bool
+	jobs     []database.SummaryRequest
+	queueErr error
+	schedule database.GroupSchedule
+}
+
+func (f *fakeDB) LookupMessage(msg *signal.Envelope) (database.MessageLookup, bool, error) {
+	group := msg.Group()
+	if group == nil {
+		return database.MessageLookup{}, false, nil
+	}
+	return database.MessageLookup{GroupID: group.GroupID, GroupName: group.GroupName, Timestamp: msg.Timestamp, Exists: f.stored[msg.Timestamp]}, true, nil
+}
+
+func (f *fakeDB) ImportMessage(msg *signal.Envelope) error {
+	f.imported = append(f.imported, msg)
+	return nil
+}
+
+func (f *fakeDB) FindGroupID(signalGroupID string) (int64, error) {
+	if signalGroupID != "g1" {
+		return 0, database.ErrGroupNotFound
+	}
+	return 1, nil
+}
+
+func (f *fakeDB) GetGroupSchedule(groupID int64) (database.GroupSchedule, error) {
+	return f.schedule, nil
+}
+
+func (f *fakeDB) GetMessagesForSummarization(groupID int64, start, end int64) ([]database.MessageForSummary, error) {
+	var messages []database.MessageForSummary
+	for _, env := range f.imported {
+		if env.Timestamp >= start && env.Timestamp <= end {
+			messages = append(messages, database.MessageForSummary{Timestamp: env.Timestamp})
+		}
+	}
+	return messages, nil
+}
+
+func (f *fakeDB) HasSummaryOverlapping(groupID int64, start, end int64) (bool, error) {
+	for _, job := range f.jobs {
+		if job.Start < end && job.End > start {
+			return true, nil
+		}
+	}
+	return f.covered[start], nil
+}
+
+func (f *fakeDB) EnqueueSummaryRequest(req database.SummaryRequest) (int64, error) {
+	if f.queueErr != nil {
+		return 0, f.queueErr
+	}
+	f.jobs = append(f.jobs, req)
+	return int64(len(f.jobs)), nil
+}
+
+// starts returns the window starts of the queued jobs.
+func (f *fakeDB) starts() []int64 {
+	var starts []int64
+	for _, job := range f.jobs {
+		starts = append(starts, job.Start)
+	}
+	return starts
+}
+
+func message(uuid string, ts int64) *signal.Envelope {
+	return &signal.Envelope{SourceUUID: uuid, Timestamp: ts, DataMessage: &signal.DataMessage{
+		Timestamp: ts, Message: "text", GroupInfo: &signal.GroupInfo{GroupID: "g1", GroupName: "Group"},
+	}}
+}
+
+func TestImport_DeduplicatesAndReports(t *testing.T) {
+	hour := time.Hour.Milliseconds()
+	envelopes := []*signal.Envelope{
+		message("uuid-1", 1*hour),
+		message("uuid-1", 1*hour), // repeated in the export
+		message("uuid-2", 2*hour), // already stored
+		message("uuid-1", 5*hour),
+		{SourceUUID: "uuid-1", ReceiptMessage: &signal.ReceiptMessage{}},
+		{SourceUUID: "uuid-1", DataMessage: &signal.DataMessage{RemoteDelete: &signal.RemoteDelete{Timestamp: hour}}},
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		db := &fakeDB{stored: map[int64]bool{2 * hour: true}}
+		report, err := New(db, schedule.Config{Spec: "1h"}).Import(context.Background(), envelopes, true)
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		if len(db.imported) != 0 {
+			t.Errorf("Expected a dry run to store nothing, got %d", len(db.imported))
+		}
+		if report.Imported != 2 || report.Duplicates != 2 || report.Updates != 1 || report.Skipped != 1 {
+			t.Errorf("Unexpected report: %+v", report)
+		}
+		if len(report.Groups) != 1 || report.Groups[0].First != hour || report.Groups[0].Last != 5*hour {
+			t.Errorf("Unexpected group report: %+v", report.Groups)
+		}
+	})
+
+	t.Run("import and backfill", func(t *testing.T) {
+		db := &fakeDB{stored: map[int64]bool{2 * hour: true}, covered: map[int64]bool{5 * hour: true}}
+		imp := New(db, schedule.Config{Spec: "1h"})
+		report, err := imp.Import(context.Background(), envelopes, false)
+		if err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+		// Two new messages and the deletion
+		if len(db.imported) != 3 {
+			t.Fatalf("Expected 3 stored envelopes, got %d", len(db.imported))
+		}
+
+		if err := imp.Backfill(report); err != nil {
+			t.Fatalf("Backfill failed: %v", err)
+		}
+		// Hours 2-4 have no new messages and hour 5 already has a summary
+		if len(db.jobs) != 1 || db.jobs[0] != (database.SummaryRequest{GroupID: 1, Start: hour, End: 2 * hour}) || len(report.BackfillJobs) != 1 {
+			t.Errorf("Expected only the first hour to be queued, got %+v", db.jobs)
+		}
+
+		// Queued windows are not summarized twice
+		report.BackfillJobs = nil
+		if err := imp.Backfill(report); err != nil {
+			t.Fatalf("Backfill failed: %v", err)
+		}
+		if len(db.jobs) != 1 || len(report.BackfillJobs) != 0 {
+			t.Errorf("Expected no duplicate job, got %+v", db.jobs)
+		}
+	})
+
+	t.Run("backfill skips windows with a queued job", func(t *testing.T) {
+		// A scheduler window waiting for a retry
+		db := &fakeDB{jobs: []database.SummaryRequest{{GroupID: 1, Start: hour, End: 2 * hour}}}
+		imp := New(db, schedule.Config{Spec: "1h"})
+		report, _ := imp.Import(context.Background(), envelopes[:1], false)
+		if err := imp.Backfill(report); err != nil {
+			t.Fatalf("Backfill failed: %v", err)
+		}
+		if len(db.jobs) != 1 || len(report.BackfillJobs) != 0 {
+			t.Errorf("Expected no duplicate job, got %+v", db.jobs)
+		}
+	})
+
+	t.Run("backfill leaves the scheduler's windows", func(t *testing.T) {
+		// The scheduler starts with the last window that ended
+		db := &fakeDB{}
+		imp := New(db, schedule.Config{Spec: "1h"})
+		imp.now = func() time.Time { return time.UnixMilli(6*hour + 1) }
+		report, _ := imp.Import(context.Background(), envelopes[3:4], false)
+		if err := imp.Backfill(report); err != nil {
+			t.Fatalf("Backfill failed: %v", err)
+		}
+		if len(db.jobs) != 0 {
+			t.Errorf("Expected the window of the scheduler to be skipped, got %v", db.starts())
+		}
+
+		// Later on it has processed windows up to its progress, or rolled
+		// them into its next summary
+		for _, group := range []database.GroupSchedule{{SummarizedUntil: 5 * hour}, {SummarizedUntil: 8 * hour, CarryFrom: 5 * hour}} {
+			db := &fakeDB{schedule: group}
+			imp := New(db, schedule.Config{Spec: "1h"})
+			report, _ := imp.Import(context.Background(), envelopes[:4], false)
+			if err := imp.Backfill(report); err != nil {
+				t.Fatalf("Backfill failed: %v", err)
+			}
+			if starts := db.starts(); len(starts) != 2 || starts[0] != hour || starts[1] != 2*hour {
+				t.Errorf("Expected the windows before %d to be queued, got %v", group.SummarizedUntil, starts)
+			}
+		}
+	})
+
+	t.Run("backfill follows the group schedule", func(t *testing.T) {
+		// Daily windows ending at 08:00 in Berlin, an hour after midnight UTC
+		db := &fakeDB{schedule: database.GroupSchedule{Schedule: "0 8 * * *", TimeZone: "Europe/Berlin"}}
+		imp := New(db, schedule.Config{Spec: "1h"})
+		imp.now = func() time.Time { return time.UnixMilli(50 * hour) }
+		report, _ := imp.Import(context.Background(), envelopes[:1], false)
+		if err := imp.Backfill(report); err != nil {
+			t.Fatalf("Backfill failed: %v", err)
+		}
+		if starts := db.starts(); len(starts) != 1 || starts[0] != -17*hour {
+			t.Errorf("Expected the window starting at 08:00 the day before, got %v", starts)
+		}
+	})
+
+	t.Run("queue errors stop the backfill", func(t *testing.T) {
+		db := &fakeDB{queueErr: errors.New("database is locked")}
+		imp := New(db, schedule.Config{Spec: "1h"})
+		report, _ := imp.Import(context.Background(), envelopes[:1], false)
+		if err := imp.Backfill(report); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+}
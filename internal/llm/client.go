@@ -58,6 +58,13 @@ func NewClient(config Config) *Client {
 
 // Summarize generates a summary using the configured OpenAI-compatible provider
 func (c *Client) Summarize(ctx context.Context, prompt string) (string, error) {
+	summary, _, _, err := c.SummarizeWithUsage(ctx, prompt)
+	return summary, err
+}
+
+// SummarizeWithUsage generates a summary like Summarize, and returns the
+// tokens of the prompt and of the summary as reported by the provider.
+func (c *Client) SummarizeWithUsage(ctx context.Context, prompt string) (string, int, int, error) {
 	resp, err := c.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
 		Model: c.model,
 		Messages: []openai.ChatCompletionMessage{{
@@ -66,19 +73,19 @@ func (c *Client) Summarize(ctx context.Context, prompt string) (string, error) {
 		}},
 	})
 	if err != nil {
-		return "", err
+		return "", 0, 0, err
 	}
 
 	// Validate response has choices before accessing
 	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response choices returned from AI provider")
+		return "", 0, 0, fmt.Errorf("no response choices returned from AI provider")
 	}
 
 	// Validate choice has content
 	choice := resp.Choices[0]
 	if choice.Message.Content == "" {
-		return "", fmt.Errorf("empty response content from AI provider")
+		return "", 0, 0, fmt.Errorf("empty response content from AI provider")
 	}
 
-	return choice.Message.Content, nil
+	return choice.Message.Content, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, nil
 }
@@ -21,6 +21,7 @@ const (
 type Client struct {
 	baseURL string
 	model   string
+	numCtx  int
 	client  *http.Client
 }
 
@@ -41,6 +42,13 @@ func NewClient(host, model string) *Client {
 	}
 }
 
+// WithContextSize sets the context size the model is loaded with, instead
+// of the Ollama default.
+func (c *Client) WithContextSize(numCtx int) *Client {
+	c.numCtx = numCtx
+	return c
+}
+
 // ChatCompletionMessage represents a message in the conversation
 type ChatCompletionMessage struct {
 	Role    string `json:"role"`
@@ -53,6 +61,12 @@ type ChatCompletionRequest struct {
 	Messages    []ChatCompletionMessage `json:"messages"`
 	Temperature float32                 `json:"temperature,omitempty"`
 	Stream      bool                    `json:"stream"`
+	Options     *ChatOptions            `json:"options,omitempty"`
+}
+
+// ChatOptions holds model parameters of a chat completion request
+type ChatOptions struct {
+	NumCtx int `json:"num_ctx,omitempty"`
 }
 
 // ChatCompletionResponse represents a chat completion response
@@ -64,6 +78,9 @@ type ChatCompletionResponse struct {
 		Content string `json:"content"`
 	} `json:"message"`
 	Done bool `json:"done"`
+	// Tokens of the prompt and of the response
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
 }
 
 // ListModelsResponse represents the response from listing models
@@ -121,6 +138,13 @@ func (c *Client) ListModels(ctx context.Context) (*ListModelsResponse, error) {
 
 // Summarize generates a summary using the local model with the provided prompt
 func (c *Client) Summarize(ctx context.Context, prompt string) (string, error) {
+	summary, _, _, err := c.SummarizeWithUsage(ctx, prompt)
+	return summary, err
+}
+
+// SummarizeWithUsage generates a summary like Summarize, and returns the
+// tokens of the prompt and of the summary.
+func (c *Client) SummarizeWithUsage(ctx context.Context, prompt string) (string, int, int, error) {
 	// Create chat completion request
 	chatReq := ChatCompletionRequest{
 		Model:       c.model,
@@ -133,6 +157,9 @@ func (c *Client) Summarize(ctx context.Context, prompt string) (string, error) {
 			},
 		},
 	}
+	if c.numCtx > 0 {
+		chatReq.Options = &ChatOptions{NumCtx: c.numCtx}
+	}
 
 	// Retry logic for API calls
 	maxRetries := 3
@@ -143,43 +170,43 @@ func (c *Client) Summarize(ctx context.Context, prompt string) (string, error) {
 
 			select {
 			case <-ctx.Done():
-				return "", ctx.Err()
+				return "", 0, 0, ctx.Err()
 			case <-time.After(waitTime):
 			}
 		}
 
-		summary, err := c.performChatCompletion(ctx, chatReq)
+		resp, err := c.performChatCompletion(ctx, chatReq)
 		if err == nil {
-			return summary, nil
+			return strings.TrimSpace(resp.Message.Content), resp.PromptEvalCount, resp.EvalCount, nil
 		}
 
 		slog.WarnContext(ctx, "Summarization attempt failed", "attempt", attempt+1, "error", err)
 
 		// Don't retry on context cancellation
 		if ctx.Err() != nil {
-			return "", ctx.Err()
+			return "", 0, 0, ctx.Err()
 		}
 	}
 
-	return "", fmt.Errorf("failed to generate summary after %d attempts", maxRetries)
+	return "", 0, 0, fmt.Errorf("failed to generate summary after %d attempts", maxRetries)
 }
 
 // performChatCompletion executes a single chat completion request
-func (c *Client) performChatCompletion(ctx context.Context, chatReq ChatCompletionRequest) (string, error) {
+func (c *Client) performChatCompletion(ctx context.Context, chatReq ChatCompletionRequest) (*ChatCompletionResponse, error) {
 	body, err := json.Marshal(chatReq)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal chat request: %w", err)
+		return nil, fmt.Errorf("failed to marshal chat request: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/chat", bytes.NewReader(body))
 	if err != nil {
-		return "", fmt.Errorf("failed to create chat request: %w", err)
+		return nil, fmt.Errorf("failed to create chat request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send chat request: %w", err)
+		return nil, fmt.Errorf("failed to send chat request: %w", err)
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
@@ -189,19 +216,19 @@ func (c *Client) performChatCompletion(ctx context.Context, chatReq ChatCompleti
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("chat request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		return nil, fmt.Errorf("chat request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 
 	var chatResp ChatCompletionResponse
 	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
-		return "", fmt.Errorf("failed to decode chat response: %w", err)
+		return nil, fmt.Errorf("failed to decode chat response: %w", err)
 	}
 
 	if !chatResp.Done {
-		return "", fmt.Errorf("chat completion not finished")
+		return nil, fmt.Errorf("chat completion not finished")
 	}
 
-	return strings.TrimSpace(chatResp.Message.Content), nil
+	return &chatResp, nil
 }
 
 // HealthCheck verifies that the Ollama server is responsive
@@ -298,10 +325,11 @@ func (c *Client) TestModelInference(ctx context.Context) error {
 		Stream: false,
 	}
 
-	response, err := c.performChatCompletion(testCtx, chatReq)
+	resp, err := c.performChatCompletion(testCtx, chatReq)
 	if err != nil {
 		return fmt.Errorf("model inference test failed: %w", err)
 	}
+	response := strings.TrimSpace(resp.Message.Content)
 
 	if len(strings.TrimSpace(response)) == 0 {
 		return fmt.Errorf("model returned empty response")
@@ -0,0 +1,69 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours is a daily period during which no summaries are generated.
+type QuietHours struct {
+	// start and end are minutes after midnight. Periods that end before they
+	// start span midnight.
+	start, end int
+	location   *time.Location
+}
+
+// ParseQuietHours parses a period such as "22:00-07:00". It returns nil for
+// an empty period or "off".
+func ParseQuietHours(spec string, location *time.Location) (*QuietHours, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || strings.EqualFold(spec, "off") {
+		return nil, nil
+	}
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid quiet hours %q: expected HH:MM-HH:MM", spec)
+	}
+	q := &QuietHours{location: location}
+	var err error
+	if q.start, err = parseClock(from); err != nil {
+		return nil, fmt.Errorf("invalid quiet hours %q: %w", spec, err)
+	}
+	if q.end, err = parseClock(to); err != nil {
+		return nil, fmt.Errorf("invalid quiet hours %q: %w", spec, err)
+	}
+	if q.start == q.end {
+		return nil, fmt.Errorf("invalid quiet hours %q: start and end are equal", spec)
+	}
+	return q, nil
+}
+
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Until returns the end of the quiet period t is in, or the zero time if t
+// is outside quiet hours.
+func (q *QuietHours) Until(t time.Time) time.Time {
+	t = t.In(q.location)
+	minute := t.Hour()*60 + t.Minute()
+	day := 0
+	switch {
+	case q.start < q.end && minute >= q.start && minute < q.end:
+	case q.start > q.end && minute >= q.start:
+		day = 1
+	case q.start > q.end && minute < q.end:
+	default:
+		return time.Time{}
+	}
+	return time.Date(t.Year(), t.Month(), t.Day()+day, q.end/60, q.end%60, 0, 0, q.location)
+}
+
+func (q *QuietHours) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", q.start/60, q.start%60, q.end/60, q.end%60)
+}
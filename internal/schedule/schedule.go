@@ -0,0 +1,348 @@
+// Package schedule parses summarization schedules: fixed intervals such as
+// "6h" and cron expressions such as "0 8 * * *", evaluated in a time zone,
+// and the quiet hours and activity minimums that hold summaries back.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule yields the times at which summarization windows end. A run at
+// Next(t) summarizes the window that started at t.
+type Schedule interface {
+	// Next returns the first time after t, or the zero time if there is none.
+	Next(t time.Time) time.Time
+	String() string
+}
+
+// Config is a schedule as configured: a spec and the time zone it runs in,
+// and the conditions a window is summarized under.
+type Config struct {
+	Spec     string `json:"schedule"`
+	TimeZone string `json:"timezone"`
+	// QuietHours such as "22:00-07:00" defer summaries to their end. "off"
+	// turns inherited quiet hours off.
+	QuietHours string `json:"quietHours"`
+	// Windows below any of the minimums are rolled into the next window.
+	// Nil inherits the minimum.
+	MinMessages     *int `json:"minMessages"`
+	MinParticipants *int `json:"minParticipants"`
+	MinChars        *int `json:"minChars"`
+}
+
+func (c Config) location() (*time.Location, error) {
+	if c.TimeZone == "" {
+		return time.UTC, nil
+	}
+	location, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", c.TimeZone, err)
+	}
+	return location, nil
+}
+
+// Parse parses the spec in the configured time zone, UTC if empty. It also
+// validates the quiet hours and minimums.
+func (c Config) Parse() (Schedule, error) {
+	location, err := c.location()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ParseQuietHours(c.QuietHours, location); err != nil {
+		return nil, err
+	}
+	for _, minimum := range []*int{c.MinMessages, c.MinParticipants, c.MinChars} {
+		if minimum != nil && *minimum < 0 {
+			return nil, fmt.Errorf("minimum %d is negative", *minimum)
+		}
+	}
+	return Parse(c.Spec, location)
+}
+
+// Quiet parses the quiet hours in the configured time zone. It returns nil
+// if there are none.
+func (c Config) Quiet() (*QuietHours, error) {
+	location, err := c.location()
+	if err != nil {
+		return nil, err
+	}
+	return ParseQuietHours(c.QuietHours, location)
+}
+
+// Minimums returns the minimum number of messages, participants and
+// characters of a window, 0 if not set.
+func (c Config) Minimums() (messages, participants, chars int) {
+	value := func(minimum *int) int {
+		if minimum == nil {
+			return 0
+		}
+		return *minimum
+	}
+	return value(c.MinMessages), value(c.MinParticipants), value(c.MinChars)
+}
+
+// Override returns c with the fields set in override replaced.
+func (c Config) Override(override Config) Config {
+	if override.Spec != "" {
+		c.Spec = override.Spec
+	}
+	if override.TimeZone != "" {
+		c.TimeZone = override.TimeZone
+	}
+	if override.QuietHours != "" {
+		c.QuietHours = override.QuietHours
+	}
+	if override.MinMessages != nil {
+		c.MinMessages = override.MinMessages
+	}
+	if override.MinParticipants != nil {
+		c.MinParticipants = override.MinParticipants
+	}
+	if override.MinChars != nil {
+		c.MinChars = override.MinChars
+	}
+	return c
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a schedule: a duration ("30m", "6h", "@every 6h"), a cron
+// expression with five fields ("0 8 * * 1-5") or a descriptor such as
+// "@daily". Intervals are aligned to the clock, so "1h" ends windows on the
+// hour. Cron expressions may set their own time zone with a CRON_TZ= prefix.
+func Parse(spec string, location *time.Location) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, errors.New("empty schedule")
+	}
+	if tz, rest, ok := strings.Cut(spec, " "); ok && strings.HasPrefix(tz, "CRON_TZ=") {
+		var err error
+		if location, err = time.LoadLocation(strings.TrimPrefix(tz, "CRON_TZ=")); err != nil {
+			return nil, fmt.Errorf("invalid time zone in %q: %w", spec, err)
+		}
+		spec = strings.TrimSpace(rest)
+	}
+
+	if every, ok := strings.CutPrefix(spec, "@every "); ok {
+		spec = strings.TrimSpace(every)
+	}
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d < time.Minute {
+			return nil, fmt.Errorf("interval %s is shorter than a minute", d)
+		}
+		return &interval{every: d, location: location}, nil
+	}
+
+	if expr, ok := descriptors[spec]; ok {
+		spec = expr
+	}
+	return parseCron(spec, location)
+}
+
+// interval ends windows every d, aligned to midnight in its time zone when d
+// divides a day, and to the Unix epoch otherwise.
+type interval struct {
+	every    time.Duration
+	location *time.Location
+}
+
+func (s *interval) Next(t time.Time) time.Time {
+	if (24*time.Hour)%s.every == 0 {
+		t = t.In(s.location)
+		midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location)
+		next := midnight.Add((t.Sub(midnight)/s.every + 1) * s.every)
+		// Days are 23 or 25 hours long when daylight saving time changes
+		if tomorrow := midnight.AddDate(0, 0, 1); next.After(tomorrow) {
+			next = tomorrow
+		}
+		return next
+	}
+	return t.Truncate(s.every).Add(s.every)
+}
+
+func (s *interval) String() string {
+	return s.every.String()
+}
+
+// cron is a standard five-field cron expression.
+type cron struct {
+	spec                          string
+	minute, hour, dom, month, dow uint64
+	domRestricted, dowRestricted  bool
+	location                      *time.Location
+}
+
+var (
+	monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	dayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+func parseCron(spec string, location *time.Location) (Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected a duration or five cron fields", spec)
+	}
+	c := &cron{spec: spec, location: location}
+	var err error
+	if c.minute, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid minute in %q: %w", spec, err)
+	}
+	if c.hour, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("invalid hour in %q: %w", spec, err)
+	}
+	if c.dom, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("invalid day of month in %q: %w", spec, err)
+	}
+	if c.month, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("invalid month in %q: %w", spec, err)
+	}
+	if c.dow, err = parseField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("invalid day of week in %q: %w", spec, err)
+	}
+	// 7 is another name for Sunday
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domRestricted = fields[2] != "*" && fields[2] != "?"
+	c.dowRestricted = fields[4] != "*" && fields[4] != "?"
+	return c, nil
+}
+
+// parseField parses a comma-separated list of values, ranges and steps into
+// a bit set.
+func parseField(field string, low, high int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+
+		start, end := low, high
+		switch {
+		case rangePart == "*" || rangePart == "?":
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = parseValue(from, names); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(to, names); err != nil {
+				return 0, err
+			}
+		default:
+			value, err := parseValue(rangePart, names)
+			if err != nil {
+				return 0, err
+			}
+			start = value
+			if !hasStep {
+				end = value
+			}
+		}
+		if start < low || end > high || start > end {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, low, high)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(value string, names map[string]int) (int, error) {
+	if n, ok := names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	return n, nil
+}
+
+func (c *cron) Next(t time.Time) time.Time {
+	t = t.In(c.location).Truncate(time.Minute).Add(time.Minute)
+	// Impossible dates such as February 30 never match
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.location)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.location)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.location)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches follows cron: when both the day of month and the day of week
+// are restricted, either may match.
+func (c *cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domRestricted && c.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+func (c *cron) String() string {
+	return c.spec
+}
+
+// Prev returns the last time of the schedule at or before t, or the zero
+// time if there is none within two years.
+func Prev(s Schedule, t time.Time) time.Time {
+	for span := time.Hour; span <= 2*366*24*time.Hour; span *= 4 {
+		prev := s.Next(t.Add(-span))
+		if prev.IsZero() || prev.After(t) {
+			continue
+		}
+		for {
+			next := s.Next(prev)
+			if next.IsZero() || next.After(t) {
+				return prev
+			}
+			prev = next
+		}
+	}
+	return time.Time{}
+}
+
+// NextRun returns when a group whose windows were processed up to until is
+// summarized next. Groups that were never summarized, or are behind, run at
+// the next check.
+func NextRun(s Schedule, until, now time.Time) time.Time {
+	if until.IsZero() {
+		return now
+	}
+	next := s.Next(until)
+	if !next.IsZero() && next.Before(now) {
+		return now
+	}
+	return next
+}
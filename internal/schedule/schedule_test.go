@@ -0,0 +1,160 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	return location
+}
+
+func TestParse_Next(t *testing.T) {
+	berlin := mustLocation(t, "Europe/Berlin")
+	from := time.Date(2024, 3, 1, 10, 17, 30, 0, time.UTC) // a Friday
+
+	tests := []struct {
+		spec     string
+		location *time.Location
+		expected time.Time
+	}{
+		{"1h", time.UTC, time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)},
+		{"@every 30m", time.UTC, time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)},
+		{"24h", berlin, time.Date(2024, 3, 2, 0, 0, 0, 0, berlin)},
+		{"0 8 * * *", berlin, time.Date(2024, 3, 2, 8, 0, 0, 0, berlin)},
+		{"CRON_TZ=Europe/Berlin 0 8 * * *", time.UTC, time.Date(2024, 3, 2, 8, 0, 0, 0, berlin)},
+		{"*/15 9-17 * * mon-fri", time.UTC, time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)},
+		{"0 9 * * 1", time.UTC, time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)},
+		{"@monthly", time.UTC, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.UTC, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Day of month or day of week
+		{"0 0 15 * sun", time.UTC, time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := Parse(tt.spec, tt.location)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if got := s.Next(from); !got.Equal(tt.expected) {
+				t.Errorf("Next = %s, expected %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "10s", "0 8 * *", "60 * * * *", "0 8 * * funday", "*/0 * * * *", "CRON_TZ=Mars/Base 0 8 * * *"} {
+		if _, err := Parse(spec, time.UTC); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+	if _, err := (Config{Spec: "1h", TimeZone: "Nowhere/City"}).Parse(); err == nil {
+		t.Error("Expected an unknown time zone to be rejected")
+	}
+}
+
+func TestCron_DaylightSavingTime(t *testing.T) {
+	berlin := mustLocation(t, "Europe/Berlin")
+	s, err := Parse("0 8 * * *", berlin)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	// Clocks moved forward on March 31, 2024; 8am stays 8am local time
+	next := s.Next(time.Date(2024, 3, 30, 8, 0, 0, 0, berlin))
+	if expected := time.Date(2024, 3, 31, 8, 0, 0, 0, berlin); !next.Equal(expected) || next.Sub(time.Date(2024, 3, 30, 8, 0, 0, 0, berlin)) != 23*time.Hour {
+		t.Errorf("Expected %s, 23 hours later, got %s", expected, next)
+	}
+}
+
+func TestPrevAndNextRun(t *testing.T) {
+	s, err := Parse("0 8 * * *", time.UTC)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	if prev := Prev(s, now); !prev.Equal(time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected Prev: %s", prev)
+	}
+	if prev := Prev(s, time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)); !prev.Equal(time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected Prev to include t, got %s", prev)
+	}
+
+	if run := NextRun(s, time.Time{}, now); !run.Equal(now) {
+		t.Errorf("Expected a new group to run now, got %s", run)
+	}
+	if run := NextRun(s, time.Date(2024, 2, 28, 8, 0, 0, 0, time.UTC), now); !run.Equal(now) {
+		t.Errorf("Expected a group that is behind to run now, got %s", run)
+	}
+	if run := NextRun(s, time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC), now); !run.Equal(time.Date(2024, 3, 2, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected next run: %s", run)
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	berlin := mustLocation(t, "Europe/Berlin")
+	q, err := ParseQuietHours("22:00-07:30", berlin)
+	if err != nil {
+		t.Fatalf("ParseQuietHours failed: %v", err)
+	}
+	tests := []struct {
+		at       time.Time
+		expected time.Time
+	}{
+		{time.Date(2024, 3, 1, 21, 59, 0, 0, berlin), time.Time{}},
+		{time.Date(2024, 3, 1, 22, 0, 0, 0, berlin), time.Date(2024, 3, 2, 7, 30, 0, 0, berlin)},
+		{time.Date(2024, 3, 2, 3, 0, 0, 0, berlin), time.Date(2024, 3, 2, 7, 30, 0, 0, berlin)},
+		{time.Date(2024, 3, 2, 7, 30, 0, 0, berlin), time.Time{}},
+		// Evaluated in the configured time zone
+		{time.Date(2024, 3, 1, 21, 30, 0, 0, time.UTC), time.Date(2024, 3, 2, 7, 30, 0, 0, berlin)},
+	}
+	for _, tt := range tests {
+		if got := q.Until(tt.at); !got.Equal(tt.expected) {
+			t.Errorf("Until(%s) = %s, expected %s", tt.at, got, tt.expected)
+		}
+	}
+
+	daytime, _ := ParseQuietHours("09:00-17:00", time.UTC)
+	if got := daytime.Until(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)); !got.Equal(time.Date(2024, 3, 1, 17, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected end of daytime quiet hours: %s", got)
+	}
+
+	for _, spec := range []string{"", "off", "OFF"} {
+		if q, err := ParseQuietHours(spec, time.UTC); q != nil || err != nil {
+			t.Errorf("Expected no quiet hours for %q, got %v %v", spec, q, err)
+		}
+	}
+	for _, spec := range []string{"22:00", "22:00-25:00", "8-9", "07:00-07:00"} {
+		if _, err := ParseQuietHours(spec, time.UTC); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestConfig_Override(t *testing.T) {
+	five, zero := 5, 0
+	global := Config{Spec: "1h", TimeZone: "UTC", QuietHours: "22:00-07:00", MinMessages: &five}
+	group := global.Override(Config{QuietHours: "off", MinMessages: &zero})
+	if group.Spec != "1h" || group.QuietHours != "off" || *group.MinMessages != 0 {
+		t.Errorf("Unexpected override: %+v", group)
+	}
+	if q, err := group.Quiet(); q != nil || err != nil {
+		t.Errorf("Expected quiet hours to be off, got %v %v", q, err)
+	}
+	if messages, participants, chars := global.Minimums(); messages != 5 || participants != 0 || chars != 0 {
+		t.Errorf("Unexpected minimums: %d %d %d", messages, participants, chars)
+	}
+
+	negative := -1
+	if _, err := (Config{Spec: "1h", MinChars: &negative}).Parse(); err == nil {
+		t.Error("Expected a negative minimum to be rejected")
+	}
+	if _, err := (Config{Spec: "1h", QuietHours: "late"}).Parse(); err == nil {
+		t.Error("Expected invalid quiet hours to be rejected")
+	}
+}
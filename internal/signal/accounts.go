@@ -0,0 +1,66 @@
+package signal
+
+import (
+	"strings"
+	"sync"
+)
+
+// Accounts is the set of Signal accounts this process listens on, shared by
+// their clients. Summaries and bot replies one account posts into a group are
+// received by the other accounts in it and must not be stored as chat.
+// Envelopes do not always carry the sender's number, so the UUIDs of the
+// accounts are learned from the envelopes they send.
+type Accounts struct {
+	mu      sync.Mutex
+	numbers map[string]bool
+	uuids   map[string]string // UUID to number
+}
+
+// NewAccounts creates the set of configured account numbers.
+func NewAccounts(numbers []string) *Accounts {
+	a := &Accounts{numbers: make(map[string]bool), uuids: make(map[string]string)}
+	for _, number := range numbers {
+		a.numbers[number] = true
+	}
+	return a
+}
+
+// sender returns the configured account that sent an envelope, or "".
+func (a *Accounts) sender(env *Envelope) string {
+	number := env.SourceNumber
+	if number == "" && strings.HasPrefix(env.Source, "+") {
+		number = env.Source
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if number != "" {
+		if !a.numbers[number] {
+			return ""
+		}
+		if env.SourceUUID != "" {
+			a.uuids[env.SourceUUID] = number
+		}
+		return number
+	}
+	return a.uuids[env.SourceUUID]
+}
+
+// WithAccounts drops envelopes sent by the other accounts of a process
+// listening on several.
+func WithAccounts(accounts *Accounts) ClientOption {
+	return func(c *Client) {
+		c.accounts = accounts
+	}
+}
+
+// fromOtherAccount reports whether an envelope was sent by another account
+// this process listens on. Messages an account sent itself arrive as sync
+// messages and are kept.
+func (c *Client) fromOtherAccount(env *Envelope) bool {
+	if c.accounts == nil {
+		return false
+	}
+	sender := c.accounts.sender(env)
+	return sender != "" && sender != c.number
+}
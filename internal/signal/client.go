@@ -3,19 +3,53 @@ package signal
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand"
+	"net/http"
+	"sync"
 	"time"
+)
 
-	"github.com/coder/websocket"
+const (
+	// Reconnect backoff bounds for the supervised listener
+	defaultInitialBackoff = 1 * time.Second
+	defaultMaxBackoff     = 60 * time.Second
 )
 
-// Client is a Signal client that connects to the signal-cli-rest-api.
+// Client is a Signal client that receives messages from signal-cli through a
+// pluggable Receiver and persists them.
 type Client struct {
-	addr   string
-	number string
-	conn   *websocket.Conn
-	db     DB
+	addr     string
+	number   string
+	db       DB
+	receiver Receiver
+
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	// httpClient talks to the REST endpoints, e.g. for group details
+	httpClient *http.Client
+	// syncGroups enables fetching group membership over REST
+	syncGroups bool
+	// syncedGroups holds the group IDs whose membership was fetched
+	syncedGroups sync.Map
+	// groupSyncs queues group IDs for the workers that fetch them, so the
+	// receive loop never waits on the REST API. pendingGroups holds the
+	// latest envelope of each queued group.
+	groupSyncs     chan string
+	groupSyncDelay time.Duration
+	groupSyncMu    sync.Mutex
+	pendingGroups  map[string]*Envelope
+	// commands intercepts bot commands before messages are stored
+	commands *CommandRouter
+	// accounts are the other accounts of this process, whose messages are
+	// not stored
+	accounts *Accounts
+
+	mu     sync.RWMutex
+	status Status
 }
 
 // DB is the interface for the database.
@@ -23,85 +57,216 @@ type DB interface {
 	SaveMessage(msg *Envelope) error
 }
 
-// NewClient creates a new Signal client.
-func NewClient(addr, number string, db DB) *Client {
-	return &Client{
-		addr:   addr,
-		number: number,
-		db:     db,
+// Status is a point-in-time snapshot of the listener connection state.
+type Status struct {
+	Account        string    `json:"account"`
+	Receiver       string    `json:"receiver"`
+	Connected      bool      `json:"connected"`
+	Reconnecting   bool      `json:"reconnecting"`
+	ConnectedSince time.Time `json:"connectedSince,omitzero"`
+	LastMessageAt  time.Time `json:"lastMessageAt,omitzero"`
+	ReconnectCount int64     `json:"reconnectCount"`
+	LastError      string    `json:"lastError,omitempty"`
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithReceiver replaces the default websocket receiver.
+func WithReceiver(receiver Receiver) ClientOption {
+	return func(c *Client) {
+		c.receiver = receiver
+	}
+}
+
+// WithGroupSync enables or disables fetching group membership from the REST
+// API. It needs signal-cli-rest-api and is enabled by default.
+func WithGroupSync(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.syncGroups = enabled
+	}
+}
+
+// WithCommands runs bot commands typed into groups through router.
+func WithCommands(router *CommandRouter) ClientOption {
+	return func(c *Client) {
+		c.commands = router
+	}
+}
+
+// NewClient creates a new Signal client. Without options it receives over the
+// signal-cli-rest-api websocket at addr.
+func NewClient(addr, number string, db DB, options ...ClientOption) *Client {
+	c := &Client{
+		addr:           addr,
+		number:         number,
+		db:             db,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+		httpClient:     &http.Client{Timeout: 10 * time.Second},
+		syncGroups:     true,
+		groupSyncs:     make(chan string, groupSyncQueue),
+		groupSyncDelay: defaultGroupSyncDelay,
+		pendingGroups:  make(map[string]*Envelope),
 	}
+	for _, option := range options {
+		option(c)
+	}
+	if c.receiver == nil {
+		c.receiver = NewWebSocketReceiver(addr, number)
+	}
+	c.status.Account = number
+	c.status.Receiver = c.receiver.String()
+	return c
+}
+
+// Status returns the current connection state of the listener.
+func (c *Client) Status() Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.status
 }
 
-// Listen connects to the WebSocket and listens for messages.
+// Listen receives messages until ctx is cancelled. Connection failures are
+// never fatal: the client reconnects with jittered exponential backoff and
+// resumes receiving.
 func (c *Client) Listen(ctx context.Context) error {
-	wsURL := fmt.Sprintf("ws://%s/v1/receive/%s", c.addr, c.number)
-	slog.Info("Connecting to WebSocket", "url", wsURL)
+	slog.Info("Starting Signal listener", "account", c.number, "receiver", c.receiver.String())
+	c.startGroupSync(ctx)
 
-	var err error
-	maxRetries := 5
-	retryDelay := 5 * time.Second
+	attempt := 0
+	for {
+		connected, err := c.runSession(ctx)
+		if ctx.Err() != nil {
+			c.setDisconnected(nil, false)
+			slog.Info("Signal listener stopped")
+			return nil
+		}
 
-	for i := 0; i < maxRetries; i++ {
-		c.conn, _, err = websocket.Dial(ctx, wsURL, nil)
-		if err == nil {
-			break // Success
+		// A session that got connected resets the backoff schedule
+		if connected {
+			attempt = 0
 		}
-		slog.Warn("WebSocket connection failed", "attempt", i+1, "max_attempts", maxRetries, "error", err, "retry_delay", retryDelay)
+		delay := c.backoff(attempt)
+		attempt++
+
+		c.setDisconnected(err, true)
+		slog.Warn("Signal connection lost, reconnecting", "account", c.number, "error", err, "attempt", attempt, "retry_delay", delay)
+
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(retryDelay):
+			c.setDisconnected(nil, false)
+			slog.Info("Signal listener stopped")
+			return nil
+		case <-time.After(delay):
 		}
 	}
+}
 
-	if err != nil {
-		return fmt.Errorf("failed to dial websocket after %d retries: %w", maxRetries, err)
-	}
-
+// runSession runs the receiver once until its connection fails. It reports
+// whether a connection was established so the caller can reset its backoff.
+func (c *Client) runSession(ctx context.Context) (connected bool, err error) {
+	// A panic while handling a message must not take down the process
 	defer func() {
-		if err := c.conn.Close(websocket.StatusInternalError, "internal error"); err != nil {
-			slog.Error("Failed to close websocket connection", "error", err)
+		if r := recover(); r != nil {
+			slog.Error("Recovered from panic in Signal listener", "panic", r)
+			err = fmt.Errorf("listener panic: %v", r)
 		}
 	}()
 
-	for {
-		select {
-		case <-ctx.Done():
-			if err := c.conn.Close(websocket.StatusNormalClosure, ""); err != nil {
-				slog.Error("Failed to close websocket connection gracefully", "error", err)
-			}
-			return nil
-		default:
-			messageType, data, err := c.conn.Read(ctx)
-			if err != nil {
-				// Handle close errors
-				if websocket.CloseStatus(err) == websocket.StatusNormalClosure {
-					return nil
-				}
-				return fmt.Errorf("failed to read message: %w", err)
-			}
-
-			if messageType == websocket.MessageText {
-				var wrapper EnvelopeWrapper
-				if err := json.Unmarshal(data, &wrapper); err != nil {
-					slog.Error("Error unmarshaling message", "error", err)
-					continue
-				}
-
-				if wrapper.Envelope == nil {
-					slog.Debug("Received message with empty envelope")
-					continue
-				}
-
-				slog.Debug("Received message", "envelope", wrapper.Envelope)
-
-				if err := c.db.SaveMessage(wrapper.Envelope); err != nil {
-					slog.Error("Error saving message", "error", err)
-					continue
-				}
-
-				slog.Info("Saved message", "from", wrapper.Envelope.DisplayName())
-			}
-		}
+	err = c.receiver.Receive(ctx,
+		func() {
+			connected = true
+			c.setConnected()
+			slog.Info("Connected to signal-cli", "account", c.number, "receiver", c.receiver.String())
+		},
+		func(ctx context.Context, data []byte) {
+			c.touch()
+			c.handleMessage(ctx, data)
+		})
+	if err == nil {
+		err = errors.New("receiver stopped")
+	}
+	return connected, err
+}
+
+// handleMessage decodes a single frame and persists the envelope it carries.
+func (c *Client) handleMessage(ctx context.Context, data []byte) {
+	var wrapper EnvelopeWrapper
+	if err := json.Unmarshal(data, &wrapper); err != nil {
+		slog.Error("Error unmarshaling message", "error", err)
+		return
+	}
+
+	if wrapper.Envelope == nil {
+		slog.Debug("Received message with empty envelope")
+		return
 	}
+
+	wrapper.Envelope.Account = c.number
+	slog.Debug("Received message", "envelope", wrapper.Envelope)
+
+	if c.fromOtherAccount(wrapper.Envelope) {
+		slog.Debug("Skipping message from another configured account", "account", c.number)
+		return
+	}
+
+	if c.commands != nil && c.commands.Route(ctx, c.number, wrapper.Envelope) {
+		return
+	}
+
+	if err := c.db.SaveMessage(wrapper.Envelope); err != nil {
+		slog.Error("Error saving message", "error", err)
+		return
+	}
+
+	slog.Info("Saved message", "account", c.number, "from", wrapper.Envelope.DisplayName())
+
+	c.syncGroup(wrapper.Envelope)
+}
+
+// backoff returns the delay before reconnect attempt n using exponential
+// growth capped at maxBackoff, with jitter in [d/2, d).
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.initialBackoff
+	for i := 0; i < attempt && d < c.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+func (c *Client) setConnected() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.Connected = true
+	c.status.Reconnecting = false
+	c.status.ConnectedSince = time.Now()
+	c.status.LastError = ""
+}
+
+func (c *Client) setDisconnected(err error, reconnecting bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if reconnecting {
+		c.status.ReconnectCount++
+	}
+	c.status.Connected = false
+	c.status.Reconnecting = reconnecting
+	c.status.ConnectedSince = time.Time{}
+	if err != nil {
+		c.status.LastError = err.Error()
+	}
+}
+
+func (c *Client) touch() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.LastMessageAt = time.Now()
 }
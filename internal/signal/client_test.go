@@ -0,0 +1,376 @@
+package signal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// recordingDB collects saved envelopes for assertions
+type recordingDB struct {
+	mu    sync.Mutex
+	saved []*Envelope
+}
+
+func (r *recordingDB) SaveMessage(msg *Envelope) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.saved = append(r.saved, msg)
+	return nil
+}
+
+func (r *recordingDB) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.saved)
+}
+
+func newTestClient(addr string, db DB) *Client {
+	c := NewClient(addr, "+15550000000", db)
+	c.initialBackoff = 10 * time.Millisecond
+	c.maxBackoff = 50 * time.Millisecond
+	return c
+}
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("condition not met within %s", timeout)
+}
+
+func TestListen_ReconnectsAfterServerDrop(t *testing.T) {
+	var connections atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		n := connections.Add(1)
+		if err := conn.Write(r.Context(), websocket.MessageText, []byte(sampleMessage)); err != nil {
+			return
+		}
+		if n == 1 {
+			// Simulate signal-cli restarting by dropping the first connection
+			_ = conn.Close(websocket.StatusGoingAway, "restart")
+			return
+		}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	db := &recordingDB{}
+	client := newTestClient(strings.TrimPrefix(srv.URL, "http://"), db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- client.Listen(ctx) }()
+
+	waitFor(t, 5*time.Second, func() bool { return db.count() >= 2 })
+	waitFor(t, 5*time.Second, func() bool { return client.Status().Connected })
+
+	status := client.Status()
+	if status.ReconnectCount < 1 {
+		t.Errorf("Expected at least one reconnect, got %d", status.ReconnectCount)
+	}
+	if status.LastMessageAt.IsZero() {
+		t.Error("Expected LastMessageAt to be set")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected nil error on shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Listen did not return after context cancellation")
+	}
+
+	if client.Status().Connected {
+		t.Error("Expected listener to report disconnected after shutdown")
+	}
+}
+
+func TestListen_KeepsRetryingWhenServerUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	srv.Close()
+
+	client := newTestClient(addr, &recordingDB{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	if err := client.Listen(ctx); err != nil {
+		t.Fatalf("Expected Listen to return nil after context timeout, got %v", err)
+	}
+
+	// Five attempts used to be the hard limit; the supervisor must go beyond it
+	if got := client.Status().ReconnectCount; got <= 5 {
+		t.Errorf("Expected more than 5 reconnect attempts, got %d", got)
+	}
+}
+
+func TestBackoff_IsBoundedAndJittered(t *testing.T) {
+	client := NewClient("localhost:0", "+15550000000", &recordingDB{})
+
+	for attempt := 0; attempt < 20; attempt++ {
+		d := client.backoff(attempt)
+		if d <= 0 {
+			t.Fatalf("attempt %d: expected positive delay, got %s", attempt, d)
+		}
+		if d > defaultMaxBackoff {
+			t.Fatalf("attempt %d: delay %s exceeds max %s", attempt, d, defaultMaxBackoff)
+		}
+	}
+
+	if d := client.backoff(0); d < defaultInitialBackoff/2 || d >= defaultInitialBackoff {
+		t.Errorf("Expected first delay in [%s, %s), got %s", defaultInitialBackoff/2, defaultInitialBackoff, d)
+	}
+}
+
+// groupRecordingDB also records group updates
+type groupRecordingDB struct {
+	recordingDB
+	updates []*GroupDetails
+}
+
+func (r *groupRecordingDB) SaveGroupUpdate(msg *Envelope, details *GroupDetails) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates = append(r.updates, details)
+	return nil
+}
+
+func TestSyncGroup_FetchesOnFirstSightAndUpdates(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/groups/+15550000000" {
+			http.NotFound(w, r)
+			return
+		}
+		requests.Add(1)
+		// A slow API must not hold up the receive loop
+		<-release
+		_, _ = w.Write([]byte(`[
+			{"id":"group.b3RoZXI=","internal_id":"other","name":"Other","members":["+1"]},
+			{"id":"group.Z3JvdXAtMQ==","internal_id":"group-1","name":"Book Club","description":"Monthly","members":["+1","+2"],"admins":["+1"]}
+		]`))
+	}))
+	defer srv.Close()
+
+	db := &groupRecordingDB{}
+	client := newTestClient(strings.TrimPrefix(srv.URL, "http://"), db)
+	client.groupSyncDelay = 50 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.startGroupSync(ctx)
+
+	env := func(groupType string) *Envelope {
+		return &Envelope{SourceUUID: "uuid-1", DataMessage: &DataMessage{GroupInfo: &GroupInfo{GroupID: "group-1", Type: groupType}}}
+	}
+	updates := func() int {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		return len(db.updates)
+	}
+
+	client.syncGroup(env("DELIVER"))
+	waitFor(t, 5*time.Second, func() bool { return requests.Load() == 1 })
+	// Seen groups are only fetched again on updates, and updates during a
+	// lookup coalesce into one more
+	client.syncGroup(env("DELIVER"))
+	client.syncGroup(env(GroupUpdateTypeUpdate))
+	client.syncGroup(env(GroupUpdateTypeUpdate))
+	close(release)
+
+	waitFor(t, 5*time.Second, func() bool { return updates() == 2 })
+	time.Sleep(150 * time.Millisecond)
+	if got := requests.Load(); got != 2 {
+		t.Errorf("Expected 2 group lookups (first sight and update), got %d", got)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if len(db.updates) != 2 {
+		t.Fatalf("Expected 2 saved updates, got %d", len(db.updates))
+	}
+	if d := db.updates[0]; d.Name != "Book Club" || len(d.Members) != 2 || d.Description != "Monthly" {
+		t.Errorf("Unexpected group details: %+v", d)
+	}
+}
+
+func TestPollingReceiver_SavesPolledMessages(t *testing.T) {
+	var polls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/receive/+15550000000" {
+			http.NotFound(w, r)
+			return
+		}
+		if polls.Add(1) == 1 {
+			_, _ = w.Write([]byte("[" + sampleMessage + "," + sampleMessage + "]"))
+			return
+		}
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	db := &recordingDB{}
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	client := newTestClient(addr, db)
+	client.receiver = NewPollingReceiver(addr, "+15550000000", 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = client.Listen(ctx) }()
+
+	waitFor(t, 5*time.Second, func() bool { return polls.Load() >= 3 })
+	if got := db.count(); got != 2 {
+		t.Errorf("Expected 2 saved messages, got %d", got)
+	}
+	db.mu.Lock()
+	account := db.saved[0].Account
+	db.mu.Unlock()
+	if account != "+15550000000" {
+		t.Errorf("Expected envelope to carry the receiving account, got %q", account)
+	}
+	if !client.Status().Connected {
+		t.Error("Expected polling receiver to report connected")
+	}
+}
+
+func TestJSONRPCReceiver_SavesReceiveNotifications(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	// signal-cli writes one JSON-RPC message per line
+	var envelope bytes.Buffer
+	if err := json.Compact(&envelope, []byte(sampleMessage)); err != nil {
+		t.Fatalf("Failed to compact sample message: %v", err)
+	}
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		lines := []string{
+			`{"jsonrpc":"2.0","method":"receive","params":` + envelope.String() + `}`,
+			`{"jsonrpc":"2.0","method":"receive","params":{"envelope":{"sourceUuid":"x","timestamp":1},"account":"+15559999999"}}`,
+			`{"jsonrpc":"2.0","id":1,"result":{}}`,
+			`not json`,
+		}
+		for _, line := range lines {
+			if _, err := conn.Write([]byte(line + "\n")); err != nil {
+				return
+			}
+		}
+		time.Sleep(time.Second)
+	}()
+
+	db := &recordingDB{}
+	client := newTestClient("localhost:0", db)
+	client.receiver = NewJSONRPCReceiver(ln.Addr().String(), "+18177392137")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = client.Listen(ctx) }()
+
+	waitFor(t, 5*time.Second, func() bool { return db.count() >= 1 })
+	time.Sleep(150 * time.Millisecond)
+	if got := db.count(); got != 1 {
+		t.Errorf("Expected only the notification for our account to be saved, got %d", got)
+	}
+}
+
+func TestNewJSONRPCReceiver_UnixSocket(t *testing.T) {
+	r := NewJSONRPCReceiver("unix:/run/signal-cli/socket", "+15550000000")
+	if r.network != "unix" || r.address != "/run/signal-cli/socket" {
+		t.Errorf("Unexpected network %q and address %q", r.network, r.address)
+	}
+}
+
+func TestSender_PostsStyledMessage(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v2/send" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"timestamp":"1754295444829"}`))
+	}))
+	defer srv.Close()
+
+	sender := NewSender(strings.TrimPrefix(srv.URL, "http://"))
+	ts, err := sender.Send(context.Background(), "+15550000000", []string{GroupRecipient("group-1")}, "**hi**")
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if ts != 1754295444829 {
+		t.Errorf("Expected sent timestamp, got %d", ts)
+	}
+	recipients, _ := body["recipients"].([]interface{})
+	if body["number"] != "+15550000000" || body["text_mode"] != "styled" || len(recipients) != 1 || recipients[0] != "group.Z3JvdXAtMQ==" {
+		t.Errorf("Unexpected request body: %v", body)
+	}
+}
+
+func TestHandleMessage_SkipsOtherConfiguredAccounts(t *testing.T) {
+	accounts := NewAccounts([]string{"+15550000000", "+15550000001"})
+	first, firstDB := newTestClient("localhost:0", &recordingDB{}), &recordingDB{}
+	first.db, first.accounts = firstDB, accounts
+	second, secondDB := newTestClient("localhost:0", &recordingDB{}), &recordingDB{}
+	second.number, second.db, second.accounts = "+15550000001", secondDB, accounts
+
+	frame := func(number, uuid string, sync bool) []byte {
+		env := map[string]interface{}{"sourceNumber": number, "sourceUuid": uuid, "timestamp": 1}
+		message := map[string]interface{}{"message": "summary", "groupInfo": map[string]string{"groupId": "group-1"}}
+		if sync {
+			env["syncMessage"] = map[string]interface{}{"sentMessage": message}
+		} else {
+			env["dataMessage"] = message
+		}
+		data, _ := json.Marshal(map[string]interface{}{"envelope": env})
+		return data
+	}
+
+	// The first account's own message arrives as a sync message and teaches
+	// its UUID, then the second account receives its summaries with and
+	// without the number
+	first.handleMessage(context.Background(), frame("+15550000000", "uuid-first", true))
+	second.handleMessage(context.Background(), frame("+15550000000", "uuid-first", false))
+	second.handleMessage(context.Background(), frame("", "uuid-first", false))
+	second.handleMessage(context.Background(), frame("+15550000002", "uuid-member", false))
+
+	if got := firstDB.count(); got != 1 {
+		t.Errorf("Expected the account's own message to be stored, got %d", got)
+	}
+	if got := secondDB.count(); got != 1 {
+		t.Fatalf("Expected only the member's message to be stored, got %d", got)
+	}
+	if secondDB.saved[0].SourceUUID != "uuid-member" {
+		t.Errorf("Unexpected stored message: %+v", secondDB.saved[0])
+	}
+}
@@ -0,0 +1,158 @@
+package signal
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// commandTimeout bounds a single command, including the LLM call.
+const commandTimeout = 5 * time.Minute
+
+// Command is a bot command typed into a Signal group, e.g. "!summary 6h".
+type Command struct {
+	Name    string
+	Args    []string
+	Account string
+	GroupID string
+	// Source is the UUID, or number, of the member who typed the command
+	Source    string
+	Timestamp int64
+}
+
+// CommandHandler runs a command and returns the reply, as markdown.
+type CommandHandler func(ctx context.Context, cmd Command) (string, error)
+
+// Replier posts a markdown reply into a conversation.
+type Replier interface {
+	Reply(ctx context.Context, account, recipient, text string) error
+}
+
+// CommandRouter intercepts group messages that start with a prefix and runs
+// the registered handler for the command. Only members on the allowlist may
+// run commands, and each group can run one command per interval.
+type CommandRouter struct {
+	prefix    string
+	allowlist map[string]bool
+	interval  time.Duration
+	replier   Replier
+	handlers  map[string]CommandHandler
+
+	mu      sync.Mutex
+	lastRun map[string]time.Time
+}
+
+// NewCommandRouter creates a router. Entries of the allowlist are phone
+// numbers or UUIDs; an empty allowlist denies every command.
+func NewCommandRouter(prefix string, allowlist []string, interval time.Duration, replier Replier) *CommandRouter {
+	allowed := make(map[string]bool, len(allowlist))
+	for _, a := range allowlist {
+		allowed[a] = true
+	}
+	return &CommandRouter{
+		prefix:    prefix,
+		allowlist: allowed,
+		interval:  interval,
+		replier:   replier,
+		handlers:  make(map[string]CommandHandler),
+		lastRun:   make(map[string]time.Time),
+	}
+}
+
+// Handle registers the handler for a command name, without the prefix.
+func (r *CommandRouter) Handle(name string, handler CommandHandler) {
+	r.handlers[strings.ToLower(name)] = handler
+}
+
+// Route runs the command carried by an envelope, if any, and reports whether
+// the envelope was a command. Commands are not stored as messages. Messages
+// that merely start with the prefix but name no known command are not
+// intercepted.
+func (r *CommandRouter) Route(ctx context.Context, account string, env *Envelope) bool {
+	cmd, ok := r.parse(account, env)
+	if !ok {
+		return false
+	}
+	handler, ok := r.handlers[cmd.Name]
+	if !ok {
+		return false
+	}
+
+	if !r.allowlist[env.SourceUUID] && !r.allowlist[env.SourceNumber] {
+		slog.Info("Ignoring command from member not on the allowlist", "command", cmd.Name, "source", cmd.Source)
+		return true
+	}
+	if !r.allow(cmd.GroupID) {
+		slog.Info("Ignoring rate limited command", "command", cmd.Name, "group", cmd.GroupID)
+		return true
+	}
+
+	slog.Info("Running command", "command", cmd.Name, "args", cmd.Args, "account", account)
+	// Commands can take a while; they must not block receiving, nor be
+	// cancelled when the connection drops
+	go r.run(context.WithoutCancel(ctx), handler, cmd)
+	return true
+}
+
+func (r *CommandRouter) parse(account string, env *Envelope) (Command, bool) {
+	var text string
+	var group *GroupInfo
+	switch {
+	case env.DataMessage != nil:
+		text, group = env.DataMessage.Message, env.DataMessage.GroupInfo
+	case env.SyncMessage != nil && env.SyncMessage.SentMessage != nil:
+		// Typed by the account owner on another device
+		text, group = env.SyncMessage.SentMessage.Message, env.SyncMessage.SentMessage.GroupInfo
+	}
+	if group == nil || group.GroupID == "" || !strings.HasPrefix(text, r.prefix) {
+		return Command{}, false
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(text, r.prefix))
+	if len(fields) == 0 {
+		return Command{}, false
+	}
+	source := env.SourceUUID
+	if source == "" {
+		source = env.SourceNumber
+	}
+	return Command{
+		Name:      strings.ToLower(fields[0]),
+		Args:      fields[1:],
+		Account:   account,
+		GroupID:   group.GroupID,
+		Source:    source,
+		Timestamp: env.Timestamp,
+	}, true
+}
+
+// allow reports whether a group may run a command now and records the run.
+func (r *CommandRouter) allow(groupID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if last, ok := r.lastRun[groupID]; ok && now.Sub(last) < r.interval {
+		return false
+	}
+	r.lastRun[groupID] = now
+	return true
+}
+
+func (r *CommandRouter) run(ctx context.Context, handler CommandHandler, cmd Command) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	reply, err := handler(ctx, cmd)
+	if err != nil {
+		slog.Error("Command failed", "command", cmd.Name, "error", err)
+		reply = "Sorry, the " + r.prefix + cmd.Name + " command failed."
+	}
+	if reply == "" {
+		return
+	}
+	if err := r.replier.Reply(ctx, cmd.Account, GroupRecipient(cmd.GroupID), reply); err != nil {
+		slog.Error("Failed to reply to command", "command", cmd.Name, "error", err)
+	}
+}
@@ -0,0 +1,91 @@
+package signal
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingReplier struct {
+	mu      sync.Mutex
+	replies []string
+}
+
+func (r *recordingReplier) Reply(ctx context.Context, account, recipient, text string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.replies = append(r.replies, account+"|"+recipient+"|"+text)
+	return nil
+}
+
+func (r *recordingReplier) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.replies)
+}
+
+func groupText(source, text string) *Envelope {
+	return &Envelope{
+		SourceUUID:  source,
+		Timestamp:   1000,
+		DataMessage: &DataMessage{Message: text, GroupInfo: &GroupInfo{GroupID: "group-1"}},
+	}
+}
+
+func TestCommandRouter(t *testing.T) {
+	replier := &recordingReplier{}
+	router := NewCommandRouter("!", []string{"uuid-allowed"}, time.Hour, replier)
+
+	var got Command
+	router.Handle("summary", func(ctx context.Context, cmd Command) (string, error) {
+		got = cmd
+		return "done", nil
+	})
+
+	if router.Route(context.Background(), "+15550000000", groupText("uuid-allowed", "hello")) {
+		t.Error("Plain messages must not be intercepted")
+	}
+	if router.Route(context.Background(), "+15550000000", groupText("uuid-allowed", "!important news")) {
+		t.Error("Unknown commands must not be intercepted")
+	}
+	if !router.Route(context.Background(), "+15550000000", groupText("uuid-other", "!summary")) {
+		t.Error("Commands from members not on the allowlist must be intercepted")
+	}
+
+	if !router.Route(context.Background(), "+15550000000", groupText("uuid-allowed", "!Summary since yesterday")) {
+		t.Fatal("Expected command to be intercepted")
+	}
+	waitFor(t, 5*time.Second, func() bool { return replier.count() == 1 })
+	if got.Name != "summary" || len(got.Args) != 2 || got.Args[0] != "since" || got.Source != "uuid-allowed" {
+		t.Errorf("Unexpected command: %+v", got)
+	}
+	if replier.replies[0] != "+15550000000|group.Z3JvdXAtMQ==|done" {
+		t.Errorf("Unexpected reply: %s", replier.replies[0])
+	}
+
+	// A second command in the same group within the interval is dropped
+	if !router.Route(context.Background(), "+15550000000", groupText("uuid-allowed", "!summary")) {
+		t.Error("Rate limited commands must still be intercepted")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if replier.count() != 1 {
+		t.Errorf("Expected rate limited command to be dropped, got %d replies", replier.count())
+	}
+}
+
+func TestCommandRouter_EmptyAllowlistDeniesAll(t *testing.T) {
+	replier := &recordingReplier{}
+	router := NewCommandRouter("!", nil, time.Hour, replier)
+	router.Handle("summary", func(ctx context.Context, cmd Command) (string, error) {
+		return "done", nil
+	})
+
+	if !router.Route(context.Background(), "+15550000000", groupText("uuid-member", "!summary")) {
+		t.Error("Denied commands must still be intercepted")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if replier.count() != 0 {
+		t.Errorf("Expected no reply without an allowlist, got %d", replier.count())
+	}
+}
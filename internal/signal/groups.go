@@ -0,0 +1,163 @@
+package signal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// groupSyncWorkers bounds the concurrent group lookups per account
+	groupSyncWorkers = 2
+	// groupSyncQueue bounds the groups waiting for a lookup
+	groupSyncQueue = 64
+	// defaultGroupSyncDelay lets a burst of updates to a group coalesce into
+	// one lookup
+	defaultGroupSyncDelay = 2 * time.Second
+)
+
+// GroupUpdateTypeUpdate marks envelopes that announce a change to a group
+// (members, title, description, avatar) rather than carry a message.
+const GroupUpdateTypeUpdate = "UPDATE"
+
+// GroupDetails is the current state of a group as reported by
+// GET /v1/groups/{number}. Members are phone numbers, or UUIDs for members
+// without a shared number.
+type GroupDetails struct {
+	ID          string   `json:"id"`
+	InternalID  string   `json:"internal_id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Members     []string `json:"members"`
+	Admins      []string `json:"admins"`
+}
+
+// GroupUpdateSaver is implemented by databases that track group membership.
+// The envelope that triggered the lookup is passed along so the change can be
+// attributed and timestamped.
+type GroupUpdateSaver interface {
+	SaveGroupUpdate(msg *Envelope, details *GroupDetails) error
+}
+
+// FetchGroup looks up the current state of a group by its internal ID, the
+// groupId carried in envelopes.
+func (c *Client) FetchGroup(ctx context.Context, internalID string) (*GroupDetails, error) {
+	endpoint := fmt.Sprintf("http://%s/v1/groups/%s", c.addr, url.PathEscape(c.number))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create groups request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Debug("Failed to close groups response body", "error", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list groups: status %d", resp.StatusCode)
+	}
+
+	var groups []GroupDetails
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&groups); err != nil {
+		return nil, fmt.Errorf("failed to decode groups: %w", err)
+	}
+	for i := range groups {
+		if groups[i].InternalID == internalID {
+			return &groups[i], nil
+		}
+	}
+	return nil, fmt.Errorf("group %s not found", internalID)
+}
+
+// syncGroup queues a refresh of the stored membership of the envelope's group
+// when it announces a change, or the first time the group is seen by this
+// process. Updates to a group that is already queued are coalesced.
+func (c *Client) syncGroup(env *Envelope) {
+	if _, ok := c.db.(GroupUpdateSaver); !ok || !c.syncGroups {
+		return
+	}
+	group := env.Group()
+	if group == nil || group.GroupID == "" {
+		return
+	}
+
+	_, seen := c.syncedGroups.LoadOrStore(group.GroupID, struct{}{})
+	if seen && group.Type != GroupUpdateTypeUpdate {
+		return
+	}
+
+	c.groupSyncMu.Lock()
+	_, queued := c.pendingGroups[group.GroupID]
+	c.pendingGroups[group.GroupID] = env
+	c.groupSyncMu.Unlock()
+	if queued {
+		return
+	}
+
+	time.AfterFunc(c.groupSyncDelay, func() {
+		select {
+		case c.groupSyncs <- group.GroupID:
+		default:
+			// Try again with the next envelope from this group
+			c.groupSyncMu.Lock()
+			delete(c.pendingGroups, group.GroupID)
+			c.groupSyncMu.Unlock()
+			c.syncedGroups.Delete(group.GroupID)
+			slog.Warn("Group sync queue is full, skipping group lookup", "account", c.number)
+		}
+	})
+}
+
+// startGroupSync starts the workers that fetch queued groups until ctx is
+// cancelled.
+func (c *Client) startGroupSync(ctx context.Context) {
+	saver, ok := c.db.(GroupUpdateSaver)
+	if !ok || !c.syncGroups {
+		return
+	}
+	for i := 0; i < groupSyncWorkers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case groupID := <-c.groupSyncs:
+					c.fetchGroup(ctx, saver, groupID)
+				}
+			}
+		}()
+	}
+}
+
+// fetchGroup looks up a queued group and saves its state. Updates arriving
+// during the lookup queue the group again.
+func (c *Client) fetchGroup(ctx context.Context, saver GroupUpdateSaver, groupID string) {
+	c.groupSyncMu.Lock()
+	env := c.pendingGroups[groupID]
+	delete(c.pendingGroups, groupID)
+	c.groupSyncMu.Unlock()
+	if env == nil {
+		return
+	}
+
+	details, err := c.FetchGroup(ctx, groupID)
+	if err != nil {
+		// Try again with the next envelope from this group
+		c.syncedGroups.Delete(groupID)
+		slog.Warn("Failed to fetch group details", "error", err)
+		return
+	}
+	if err := saver.SaveGroupUpdate(env, details); err != nil {
+		slog.Error("Error saving group update", "error", err)
+	}
+}
@@ -18,7 +18,12 @@ type Envelope struct {
 	ServerDeliveredTimestamp int64           `json:"serverDeliveredTimestamp"`
 	SyncMessage              *SyncMessage    `json:"syncMessage"`
 	DataMessage              *DataMessage    `json:"dataMessage"`
+	EditMessage              *EditMessage    `json:"editMessage"`
 	ReceiptMessage           *ReceiptMessage `json:"receiptMessage"`
+
+	// Account is the Signal number that received the envelope. It is set by
+	// the Client, not by signal-cli.
+	Account string `json:"-"`
 }
 
 // SyncMessage contains the actual message content.
@@ -28,22 +33,45 @@ type SyncMessage struct {
 
 // DataMessage contains the actual message content.
 type DataMessage struct {
-	Timestamp        int64      `json:"timestamp"`
-	Message          string     `json:"message"`
-	ExpiresInSeconds int        `json:"expiresInSeconds"`
-	ViewOnce         bool       `json:"viewOnce"`
-	GroupInfo        *GroupInfo `json:"groupInfo"`
-	Quote            *Quote     `json:"quote"`
-	Reaction         *Reaction  `json:"reaction"`
+	Timestamp        int64         `json:"timestamp"`
+	Message          string        `json:"message"`
+	ExpiresInSeconds int           `json:"expiresInSeconds"`
+	ViewOnce         bool          `json:"viewOnce"`
+	GroupInfo        *GroupInfo    `json:"groupInfo"`
+	Quote            *Quote        `json:"quote"`
+	Reaction         *Reaction     `json:"reaction"`
+	Attachments      []Attachment  `json:"attachments"`
+	Mentions         []Mention     `json:"mentions"`
+	RemoteDelete     *RemoteDelete `json:"remoteDelete"`
 }
 
 // SentMessage contains the details of the sent message.
 type SentMessage struct {
-	Destination string     `json:"destination"`
-	Timestamp   int64      `json:"timestamp"`
-	Message     string     `json:"message"`
-	GroupInfo   *GroupInfo `json:"groupInfo"`
-	Reaction    *Reaction  `json:"reaction"`
+	Destination       string        `json:"destination"`
+	DestinationNumber string        `json:"destinationNumber"`
+	DestinationUUID   string        `json:"destinationUuid"`
+	Timestamp         int64         `json:"timestamp"`
+	Message           string        `json:"message"`
+	ExpiresInSeconds  int           `json:"expiresInSeconds"`
+	ViewOnce          bool          `json:"viewOnce"`
+	GroupInfo         *GroupInfo    `json:"groupInfo"`
+	Reaction          *Reaction     `json:"reaction"`
+	Quote             *Quote        `json:"quote"`
+	Attachments       []Attachment  `json:"attachments"`
+	Mentions          []Mention     `json:"mentions"`
+	RemoteDelete      *RemoteDelete `json:"remoteDelete"`
+	EditMessage       *EditMessage  `json:"editMessage"`
+}
+
+// EditMessage replaces the content of a previously sent message.
+type EditMessage struct {
+	TargetSentTimestamp int64        `json:"targetSentTimestamp"`
+	DataMessage         *DataMessage `json:"dataMessage"`
+}
+
+// RemoteDelete asks recipients to delete a previously sent message.
+type RemoteDelete struct {
+	Timestamp int64 `json:"timestamp"`
 }
 
 // GroupInfo contains information about the group the message was sent to.
@@ -56,12 +84,36 @@ type GroupInfo struct {
 
 // Quote contains information about a quoted/replied-to message.
 type Quote struct {
-	ID           int64    `json:"id"`
-	Author       string   `json:"author"`
-	AuthorNumber string   `json:"authorNumber"`
-	AuthorUUID   string   `json:"authorUuid"`
-	Text         string   `json:"text"`
-	Attachments  []string `json:"attachments"`
+	ID           int64        `json:"id"`
+	Author       string       `json:"author"`
+	AuthorNumber string       `json:"authorNumber"`
+	AuthorUUID   string       `json:"authorUuid"`
+	Text         string       `json:"text"`
+	Attachments  []Attachment `json:"attachments"`
+}
+
+// Attachment contains metadata about a file sent with a message. The file
+// content itself stays in signal-cli; only metadata is persisted.
+type Attachment struct {
+	ID          string `json:"id"`
+	ContentType string `json:"contentType"`
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+	Caption     string `json:"caption"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	VoiceNote   bool   `json:"voiceNote"`
+}
+
+// Mention marks a span of the message body addressing a member. The body
+// holds a placeholder character (U+FFFC) at Start; Start and Length are
+// counted in UTF-16 code units.
+type Mention struct {
+	Name   string `json:"name"`
+	Number string `json:"number"`
+	UUID   string `json:"uuid"`
+	Start  int    `json:"start"`
+	Length int    `json:"length"`
 }
 
 // Reaction contains information about a message reaction.
@@ -90,3 +142,40 @@ func (e *Envelope) DisplayName() string {
 	}
 	return e.SourceUUID
 }
+
+// Group returns the group the envelope belongs to, if any.
+func (e *Envelope) Group() *GroupInfo {
+	if e.DataMessage != nil && e.DataMessage.GroupInfo != nil {
+		return e.DataMessage.GroupInfo
+	}
+	if e.SyncMessage != nil && e.SyncMessage.SentMessage != nil {
+		return e.SyncMessage.SentMessage.GroupInfo
+	}
+	return nil
+}
+
+// Edit returns the edit carried by the envelope, whether it was received from
+// another member or synced from one of our own devices.
+func (e *Envelope) Edit() *EditMessage {
+	if e.EditMessage != nil && e.EditMessage.DataMessage != nil {
+		return e.EditMessage
+	}
+	if e.SyncMessage != nil && e.SyncMessage.SentMessage != nil {
+		if edit := e.SyncMessage.SentMessage.EditMessage; edit != nil && edit.DataMessage != nil {
+			return edit
+		}
+	}
+	return nil
+}
+
+// Deletion returns the remote delete request carried by the envelope, if any,
+// together with the group it applies to.
+func (e *Envelope) Deletion() (*RemoteDelete, *GroupInfo) {
+	if e.DataMessage != nil && e.DataMessage.RemoteDelete != nil {
+		return e.DataMessage.RemoteDelete, e.DataMessage.GroupInfo
+	}
+	if e.SyncMessage != nil && e.SyncMessage.SentMessage != nil && e.SyncMessage.SentMessage.RemoteDelete != nil {
+		return e.SyncMessage.SentMessage.RemoteDelete, e.SyncMessage.SentMessage.GroupInfo
+	}
+	return nil, nil
+}
@@ -56,3 +56,62 @@ func TestUnmarshalMessage(t *testing.T) {
 		t.Errorf("Expected group name to be 'Trackers / Usenet Indexers', but got '%s'", msg.Envelope.DataMessage.GroupInfo.GroupName)
 	}
 }
+
+const attachmentMessage = `
+{
+    "envelope": {
+      "sourceUuid": "e1a8c050-2b12-440b-9814-f993c07a758e",
+      "sourceName": "PR",
+      "timestamp": 1754295444829,
+      "dataMessage": {
+        "timestamp": 1754295444829,
+        "message": null,
+        "attachments": [
+          {
+            "contentType": "image/jpeg",
+            "filename": "IMG_0042.jpg",
+            "id": "Kz9qvYHn1jT3b8dF0aQe.jpg",
+            "size": 183244,
+            "width": 1536,
+            "height": 2048,
+            "caption": "view from the top",
+            "uploadTimestamp": 1754295444000
+          }
+        ],
+        "quote": {
+          "id": 1754295000000,
+          "authorUuid": "0b5c9a6e-5e51-4a1e-9a6d-1f0a2c8d9e3f",
+          "text": null,
+          "attachments": [
+            {"contentType": "application/pdf", "filename": "itinerary.pdf", "thumbnail": null}
+          ]
+        },
+        "groupInfo": {
+          "groupId": "MvIF76urVKX1Zc2gPDciy/7V3P5xLtuQHk6zMkeTZtU=",
+          "type": "DELIVER"
+        }
+      }
+    },
+    "account": "+18177392137"
+}
+`
+
+func TestUnmarshalAttachments(t *testing.T) {
+	var msg EnvelopeWrapper
+	if err := json.Unmarshal([]byte(attachmentMessage), &msg); err != nil {
+		t.Fatalf("Failed to unmarshal JSON: %v", err)
+	}
+
+	atts := msg.Envelope.DataMessage.Attachments
+	if len(atts) != 1 {
+		t.Fatalf("Expected 1 attachment, got %d", len(atts))
+	}
+	if atts[0].ContentType != "image/jpeg" || atts[0].Size != 183244 || atts[0].Caption != "view from the top" {
+		t.Errorf("Unexpected attachment: %+v", atts[0])
+	}
+
+	quoted := msg.Envelope.DataMessage.Quote.Attachments
+	if len(quoted) != 1 || quoted[0].Filename != "itinerary.pdf" {
+		t.Errorf("Unexpected quoted attachments: %+v", quoted)
+	}
+}
@@ -0,0 +1,297 @@
+package signal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+const (
+	// Keepalive settings used to detect half-open connections
+	defaultPingInterval = 30 * time.Second
+	defaultPingTimeout  = 10 * time.Second
+
+	// DefaultPollInterval is the pause between two polls of the REST API
+	DefaultPollInterval = 5 * time.Second
+
+	// maxFrameSize bounds a single envelope. signal-cli can deliver large
+	// envelopes (e.g. long texts with previews).
+	maxFrameSize = 4 << 20
+)
+
+// Receive modes selectable with SIGNAL_RECEIVE_MODE.
+const (
+	ReceiveModeWebSocket = "websocket"
+	ReceiveModePoll      = "poll"
+	ReceiveModeJSONRPC   = "jsonrpc"
+)
+
+// Receiver delivers envelopes from signal-cli. Every frame passed to onFrame is
+// a JSON object in the EnvelopeWrapper format.
+type Receiver interface {
+	// Receive connects, calls onConnect once the connection is established and
+	// then delivers frames until the connection fails or ctx is cancelled.
+	Receive(ctx context.Context, onConnect func(), onFrame func(ctx context.Context, data []byte)) error
+	// String describes the receiver for logs and status.
+	String() string
+}
+
+// WebSocketReceiver streams envelopes from the websocket of
+// signal-cli-rest-api in json-rpc mode.
+type WebSocketReceiver struct {
+	url          string
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+}
+
+// NewWebSocketReceiver creates a receiver for the websocket at addr.
+func NewWebSocketReceiver(addr, number string) *WebSocketReceiver {
+	return &WebSocketReceiver{
+		url:          fmt.Sprintf("ws://%s/v1/receive/%s", addr, number),
+		pingInterval: defaultPingInterval,
+		pingTimeout:  defaultPingTimeout,
+	}
+}
+
+func (r *WebSocketReceiver) String() string {
+	return "websocket " + r.url
+}
+
+// Receive dials once and reads until the connection fails.
+func (r *WebSocketReceiver) Receive(ctx context.Context, onConnect func(), onFrame func(ctx context.Context, data []byte)) error {
+	conn, _, err := websocket.Dial(ctx, r.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to dial websocket: %w", err)
+	}
+	conn.SetReadLimit(maxFrameSize)
+
+	sessionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer func() {
+		if cerr := conn.Close(websocket.StatusNormalClosure, ""); cerr != nil {
+			slog.Debug("Failed to close websocket connection", "error", cerr)
+		}
+	}()
+
+	onConnect()
+	go r.keepalive(sessionCtx, cancel, conn)
+
+	for {
+		messageType, data, err := conn.Read(sessionCtx)
+		if err != nil {
+			if websocket.CloseStatus(err) == websocket.StatusNormalClosure {
+				return errors.New("connection closed by server")
+			}
+			return fmt.Errorf("failed to read message: %w", err)
+		}
+
+		if messageType != websocket.MessageText {
+			continue
+		}
+		onFrame(sessionCtx, data)
+	}
+}
+
+// keepalive pings the server periodically and tears the session down when a
+// ping is not answered in time, which unblocks the pending Read.
+func (r *WebSocketReceiver) keepalive(ctx context.Context, cancel context.CancelFunc, conn *websocket.Conn) {
+	ticker := time.NewTicker(r.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pingCtx, pingCancel := context.WithTimeout(ctx, r.pingTimeout)
+			err := conn.Ping(pingCtx)
+			pingCancel()
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("Signal WebSocket ping failed, dropping connection", "error", err)
+				}
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// PollingReceiver fetches envelopes with GET /v1/receive/{number} from
+// signal-cli-rest-api in normal or native mode, which have no websocket.
+type PollingReceiver struct {
+	url        string
+	interval   time.Duration
+	httpClient *http.Client
+}
+
+// NewPollingReceiver creates a receiver that polls the REST API at addr every
+// interval.
+func NewPollingReceiver(addr, number string, interval time.Duration) *PollingReceiver {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	return &PollingReceiver{
+		url:      fmt.Sprintf("http://%s/v1/receive/%s", addr, url.PathEscape(number)),
+		interval: interval,
+		// Receiving can take a while when many envelopes are queued
+		httpClient: &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+func (r *PollingReceiver) String() string {
+	return "poll " + r.url
+}
+
+// Receive polls until a request fails. The first successful poll counts as
+// connecting.
+func (r *PollingReceiver) Receive(ctx context.Context, onConnect func(), onFrame func(ctx context.Context, data []byte)) error {
+	connected := false
+	for {
+		frames, err := r.poll(ctx)
+		if err != nil {
+			return err
+		}
+		if !connected {
+			connected = true
+			onConnect()
+		}
+		for _, frame := range frames {
+			onFrame(ctx, frame)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+func (r *PollingReceiver) poll(ctx context.Context) ([]json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create receive request: %w", err)
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to poll messages: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Debug("Failed to close receive response", "error", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("receive returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var frames []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&frames); err != nil {
+		return nil, fmt.Errorf("failed to decode received messages: %w", err)
+	}
+	return frames, nil
+}
+
+// JSONRPCReceiver reads receive notifications from a signal-cli daemon
+// started with --tcp or --socket.
+type JSONRPCReceiver struct {
+	network string
+	address string
+	number  string
+}
+
+// NewJSONRPCReceiver creates a receiver for a signal-cli daemon. address is
+// either host:port or unix:/path/to/socket.
+func NewJSONRPCReceiver(address, number string) *JSONRPCReceiver {
+	r := &JSONRPCReceiver{network: "tcp", address: address, number: number}
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		r.network = "unix"
+		r.address = path
+	}
+	return r
+}
+
+func (r *JSONRPCReceiver) String() string {
+	return "jsonrpc " + r.network + ":" + r.address
+}
+
+// jsonRPCNotification is the subset of a JSON-RPC message the receiver needs.
+type jsonRPCNotification struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Receive connects to the daemon and reads newline-delimited JSON-RPC messages
+// until the connection fails.
+func (r *JSONRPCReceiver) Receive(ctx context.Context, onConnect func(), onFrame func(ctx context.Context, data []byte)) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, r.network, r.address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to signal-cli daemon: %w", err)
+	}
+	defer func() {
+		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			slog.Debug("Failed to close signal-cli connection", "error", err)
+		}
+	}()
+
+	// Closing the connection unblocks the pending read on shutdown
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	onConnect()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), maxFrameSize)
+	for scanner.Scan() {
+		var msg jsonRPCNotification
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			slog.Error("Error unmarshaling JSON-RPC message", "error", err)
+			continue
+		}
+		if msg.Error != nil {
+			slog.Warn("signal-cli reported an error", "error", msg.Error.Message)
+			continue
+		}
+		if msg.Method != "receive" || len(msg.Params) == 0 {
+			continue
+		}
+		if !r.forAccount(msg.Params) {
+			continue
+		}
+		onFrame(ctx, msg.Params)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read from signal-cli daemon: %w", err)
+	}
+	return errors.New("connection closed by signal-cli daemon")
+}
+
+// forAccount reports whether a notification belongs to the configured number.
+// A multi-account daemon sends notifications for every account it serves.
+func (r *JSONRPCReceiver) forAccount(params json.RawMessage) bool {
+	var p struct {
+		Account string `json:"account"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return false
+	}
+	return p.Account == "" || r.number == "" || p.Account == r.number
+}
@@ -0,0 +1,104 @@
+package signal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// textModeStyled makes signal-cli-rest-api turn *italic*, **bold**,
+// ~strikethrough~, ||spoiler|| and `monospace` into Signal text styles.
+const textModeStyled = "styled"
+
+// Sender posts messages through POST /v2/send of signal-cli-rest-api.
+type Sender struct {
+	addr       string
+	httpClient *http.Client
+}
+
+// NewSender creates a sender for the REST API at addr.
+func NewSender(addr string) *Sender {
+	return &Sender{
+		addr: addr,
+		// Sending to large groups takes a while
+		httpClient: &http.Client{Timeout: time.Minute},
+	}
+}
+
+type sendRequest struct {
+	Message    string   `json:"message"`
+	Number     string   `json:"number"`
+	Recipients []string `json:"recipients"`
+	TextMode   string   `json:"text_mode"`
+}
+
+// Send sends a styled text message from account to the recipients, which are
+// phone numbers, UUIDs or group IDs as returned by GroupRecipient. It returns
+// the timestamp of the sent message.
+func (s *Sender) Send(ctx context.Context, account string, recipients []string, message string) (int64, error) {
+	body, err := json.Marshal(sendRequest{
+		Message:    message,
+		Number:     account,
+		Recipients: recipients,
+		TextMode:   textModeStyled,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode send request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/v2/send", s.addr), bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create send request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send message: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Debug("Failed to close send response body", "error", err)
+		}
+	}()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read send response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return 0, fmt.Errorf("send failed with status %d: %s", resp.StatusCode, apiErr.Error)
+		}
+		return 0, fmt.Errorf("send failed with status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Timestamp string `json:"timestamp"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return 0, fmt.Errorf("failed to decode send response: %w", err)
+	}
+	timestamp, _ := strconv.ParseInt(result.Timestamp, 10, 64)
+	return timestamp, nil
+}
+
+// GroupRecipient converts the groupId carried in envelopes into the group ID
+// the REST API expects as a recipient.
+func GroupRecipient(internalID string) string {
+	if strings.HasPrefix(internalID, "group.") {
+		return internalID
+	}
+	return "group." + base64.StdEncoding.EncodeToString([]byte(internalID))
+}
@@ -8,7 +8,20 @@ CREATE TABLE IF NOT EXISTS users (
 CREATE TABLE IF NOT EXISTS groups (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     group_id TEXT UNIQUE,
-    name TEXT
+    name TEXT,
+    type TEXT DEFAULT 'group', -- 'group' or 'direct' (1:1 chat, group_id is 'direct:<account>:<contact uuid>')
+    description TEXT,
+    ephemeral_policy TEXT, -- NULL uses EPHEMERAL_POLICY
+    account TEXT, -- Signal number that first received the conversation
+    summary_delivery TEXT, -- where summaries are posted: NULL (nowhere), 'group', 'self' or 'digest'
+    summarized_until INTEGER, -- end of the last window the scheduler processed, in ms
+    summary_schedule TEXT, -- interval or cron expression, NULL uses SUMMARIZATION_SCHEDULE
+    summary_timezone TEXT, -- time zone of the schedule, NULL uses SUMMARIZATION_TIMEZONE
+    summary_quiet_hours TEXT, -- e.g. '22:00-07:00' or 'off', NULL uses SUMMARY_QUIET_HOURS
+    summary_min_messages INTEGER, -- NULL uses SUMMARY_MIN_MESSAGES
+    summary_min_participants INTEGER, -- NULL uses SUMMARY_MIN_PARTICIPANTS
+    summary_min_chars INTEGER, -- NULL uses SUMMARY_MIN_CHARS
+    summary_carry_from INTEGER -- start of windows rolled into the next one, in ms
 );
 
 CREATE TABLE IF NOT EXISTS messages (
@@ -31,12 +44,116 @@ CREATE TABLE IF NOT EXISTS messages (
     reaction_target_timestamp INTEGER,
     reaction_is_remove BOOLEAN DEFAULT FALSE,
     
+    -- Edit / remote delete state
+    edited_at INTEGER,
+    is_deleted BOOLEAN DEFAULT FALSE,
+    deleted_at INTEGER,
+    
+    -- Disappearing messages are purged once this time (ms) has passed
+    expires_at INTEGER,
+    
+    -- Signal number that received the message (the first one, if several did)
+    account TEXT,
+    
     user_id INTEGER,
     group_id INTEGER,
     FOREIGN KEY (user_id) REFERENCES users (id),
     FOREIGN KEY (group_id) REFERENCES groups (id)
 );
 
+-- Previous versions of edited messages
+CREATE TABLE IF NOT EXISTS message_edits (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_id INTEGER NOT NULL,
+    previous_text TEXT,
+    edited_at INTEGER,
+    FOREIGN KEY (message_id) REFERENCES messages (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_edits_message_id ON message_edits(message_id);
+
+-- @mentions (start/length are UTF-16 offsets into message_text)
+CREATE TABLE IF NOT EXISTS message_mentions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    start INTEGER NOT NULL,
+    length INTEGER NOT NULL,
+    FOREIGN KEY (message_id) REFERENCES messages (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_mentions_message_id ON message_mentions(message_id);
+
+-- Previous names of users and groups
+CREATE TABLE IF NOT EXISTS name_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    entity_type TEXT NOT NULL, -- 'user' or 'group'
+    entity_id INTEGER NOT NULL,
+    old_name TEXT,
+    new_name TEXT,
+    changed_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_name_history_entity ON name_history(entity_type, entity_id);
+
+-- Current members of each group (phone number or UUID as reported by signal-cli)
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id INTEGER NOT NULL,
+    member TEXT NOT NULL,
+    user_id INTEGER,
+    is_admin BOOLEAN DEFAULT FALSE,
+    PRIMARY KEY (group_id, member),
+    FOREIGN KEY (group_id) REFERENCES groups (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+-- Membership and settings changes, shown to the LLM as system lines
+CREATE TABLE IF NOT EXISTS group_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_id INTEGER NOT NULL,
+    event_type TEXT NOT NULL, -- 'member_joined', 'member_left', 'renamed', 'description_changed', 'updated'
+    user_id INTEGER, -- member who joined/left, or who made the change
+    detail TEXT,
+    timestamp INTEGER NOT NULL,
+    FOREIGN KEY (group_id) REFERENCES groups (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_events_group_timestamp ON group_events(group_id, timestamp);
+
+-- Per-group ingestion policy. Groups without a row store and summarize everything.
+CREATE TABLE IF NOT EXISTS group_settings (
+    group_id INTEGER PRIMARY KEY,
+    ingest BOOLEAN NOT NULL DEFAULT TRUE, -- store new messages
+    summarize BOOLEAN NOT NULL DEFAULT TRUE, -- send messages to the AI provider
+    FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE
+);
+
+-- Senders (UUID or phone number) whose messages a group neither stores nor summarizes
+CREATE TABLE IF NOT EXISTS group_excluded_senders (
+    group_id INTEGER NOT NULL,
+    sender TEXT NOT NULL,
+    PRIMARY KEY (group_id, sender),
+    FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE
+);
+
+-- Attachment metadata (file contents stay in signal-cli)
+CREATE TABLE IF NOT EXISTS attachments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_id INTEGER NOT NULL,
+    attachment_id TEXT,
+    content_type TEXT,
+    filename TEXT,
+    size INTEGER,
+    caption TEXT,
+    voice_note BOOLEAN DEFAULT FALSE,
+    is_quote BOOLEAN DEFAULT FALSE, -- attachment belongs to the quoted message
+    FOREIGN KEY (message_id) REFERENCES messages (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_message_id ON attachments(message_id);
+
 CREATE TABLE IF NOT EXISTS summaries (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     group_id INTEGER,
@@ -44,9 +161,75 @@ CREATE TABLE IF NOT EXISTS summaries (
     start_timestamp INTEGER,
     end_timestamp INTEGER,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    -- Posting the summary to Signal: NULL (not posted), 'sent' or 'failed'
+    delivery_status TEXT,
+    delivery_error TEXT,
+    delivered_at INTEGER,
+    -- Tokens of the prompts and completions that generated the summary
+    prompt_tokens INTEGER,
+    completion_tokens INTEGER,
+    -- AI provider of the fallback chain that generated the summary
+    provider TEXT,
     FOREIGN KEY (group_id) REFERENCES groups (id)
 );
 
+-- Earlier versions of summaries that were regenerated
+CREATE TABLE IF NOT EXISTS summary_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    summary_id INTEGER NOT NULL,
+    summary_text TEXT,
+    created_at DATETIME, -- when this version was generated
+    replaced_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (summary_id) REFERENCES summaries (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_summary_history_summary_id ON summary_history(summary_id);
+
+-- Summarization work. Scheduled jobs cover one window of a group each and run
+-- in window order. Manual jobs summarize a requested range, regenerate jobs
+-- replace summary_id. Failures are retried with backoff.
+CREATE TABLE IF NOT EXISTS summary_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL DEFAULT 'scheduled', -- 'scheduled', 'manual' or 'regenerate'
+    group_id INTEGER NOT NULL,
+    start_timestamp INTEGER NOT NULL,
+    end_timestamp INTEGER NOT NULL,
+    deliver BOOLEAN NOT NULL DEFAULT FALSE, -- post the summary to Signal
+    provider TEXT, -- AI provider override, NULL uses AI_PROVIDER
+    prompt TEXT, -- prompt override, NULL uses the default prompt
+    state TEXT NOT NULL DEFAULT 'pending', -- 'pending', 'running', 'done' or 'failed'
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    run_after INTEGER NOT NULL DEFAULT 0, -- earliest next attempt in ms
+    summary_id INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_summary_jobs_state ON summary_jobs(state, run_after);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_summary_jobs_window ON summary_jobs(group_id, start_timestamp, end_timestamp) WHERE kind = 'scheduled';
+
+-- Calls to AI providers with the tokens they used and what they cost.
+-- summary_id is set once the job of the call saved its summary.
+CREATE TABLE IF NOT EXISTS llm_calls (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_id INTEGER,
+    job_id INTEGER,
+    summary_id INTEGER,
+    provider TEXT NOT NULL,
+    model TEXT,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    cost REAL NOT NULL DEFAULT 0, -- USD from the price table
+    latency_ms INTEGER NOT NULL DEFAULT 0,
+    error TEXT, -- NULL for successful calls
+    created_at INTEGER NOT NULL -- ms
+);
+
+CREATE INDEX IF NOT EXISTS idx_llm_calls_created ON llm_calls(created_at);
+CREATE INDEX IF NOT EXISTS idx_llm_calls_job ON llm_calls(job_id);
+
 -- Authentication users table (separate from Signal users)
 CREATE TABLE IF NOT EXISTS auth_users (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
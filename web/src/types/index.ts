@@ -6,11 +6,15 @@ export interface Summary {
   start: string
   end: string
   created_at: string
+  delivery_status?: 'sent' | 'failed'
+  delivery_error?: string
 }
 
 export interface Group {
   id: number
   name: string
+  type?: 'group' | 'direct'
+  memberCount?: number
   description?: string
 }
 